@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/oranjParker/Rarefactor/internal/config"
+	"github.com/oranjParker/Rarefactor/internal/database"
+	"github.com/oranjParker/Rarefactor/internal/logging"
+	"github.com/oranjParker/Rarefactor/internal/sink"
+	"github.com/oranjParker/Rarefactor/internal/source"
+)
+
+// Backfill re-enqueues chunks whose enrichment is PENDING or FAILED to the
+// enrichment subject, e.g. after an outage of the LLM or embedding service
+// outlasted MaxDeliver. It runs once and exits.
+func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+		os.Exit(2)
+	}
+	logging.Setup("backfill", cfg.Log.Level, cfg.Log.Format)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pg, err := database.NewPool(ctx, cfg.Postgres)
+	if err != nil {
+		logging.Fatal("postgres connection failed", "error", err)
+	}
+	defer pg.Close()
+
+	nt, err := database.NewNatsConnection(cfg.NATS)
+	if err != nil {
+		logging.Fatal("nats connection failed", "error", err)
+	}
+	defer nt.Close()
+	if err := database.NewTopology(cfg.NATS).Provision(ctx, nt.JS); err != nil {
+		logging.Fatal("stream setup failed", "error", err)
+	}
+
+	backlog := source.NewChunkBacklog(pg)
+	backlog.MinAge = cfg.Enrichment.BackfillMinAge
+	backlog.Limit = cfg.Enrichment.BackfillLimit
+	enrichmentSink := sink.NewNatsSink(nt.JS, cfg.NATS.EnrichmentSubject)
+
+	chunks, err := backlog.Stream(ctx)
+	if err != nil {
+		logging.Fatal("backlog read failed", "error", err)
+	}
+
+	var enqueued, failed int
+	for doc := range chunks {
+		if err := enrichmentSink.Write(ctx, doc); err != nil {
+			slog.Warn("enqueue failed", append(doc.LogAttrs(), "error", err)...)
+			failed++
+			continue
+		}
+		if err := backlog.MarkPending(ctx, doc); err != nil {
+			slog.Warn("status update failed", append(doc.LogAttrs(), "error", err)...)
+		}
+		enqueued++
+	}
+
+	slog.Info("backfill finished", "enqueued", enqueued, "failed", failed)
+	if err := backlog.Err(); err != nil {
+		logging.Fatal("backfill stopped early", "error", err)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
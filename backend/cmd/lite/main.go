@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	pb "github.com/oranjParker/Rarefactor/generated/protos/v1"
+	"github.com/oranjParker/Rarefactor/internal/api/crawler"
+	"github.com/oranjParker/Rarefactor/internal/api/search"
+	"github.com/oranjParker/Rarefactor/internal/config"
+	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/database"
+	"github.com/oranjParker/Rarefactor/internal/frontier"
+	"github.com/oranjParker/Rarefactor/internal/health"
+	"github.com/oranjParker/Rarefactor/internal/llm_provider"
+	"github.com/oranjParker/Rarefactor/internal/logging"
+	"github.com/oranjParker/Rarefactor/internal/metrics"
+	"github.com/oranjParker/Rarefactor/internal/processor"
+	"github.com/oranjParker/Rarefactor/internal/sink"
+	"github.com/oranjParker/Rarefactor/internal/source"
+	"github.com/oranjParker/Rarefactor/internal/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+// Lite runs the crawl API, the discovery graph and the enrichment graph in a
+// single process. NATS is embedded and documents, jobs, vectors and politeness
+// state are kept in memory, so nothing needs to run alongside it.
+func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+		os.Exit(2)
+	}
+	logging.Setup("lite", cfg.Log.Level, cfg.Log.Format)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, "lite", cfg.Tracing.OTLPEndpoint)
+	if err != nil {
+		logging.Fatal("tracing setup failed", "error", err)
+	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = shutdownTracing(flushCtx)
+	}()
+
+	nt, err := database.NewEmbeddedNats(cfg.Lite.DataDir)
+	if err != nil {
+		logging.Fatal("embedded nats failed", "error", err)
+	}
+	defer nt.Close()
+
+	if err := database.NewTopology(cfg.NATS).Provision(ctx, nt.JS); err != nil {
+		logging.Fatal("stream setup failed", "error", err)
+	}
+
+	checker := health.NewChecker()
+	checker.AddCheck("nats", nt.Ping)
+
+	var store frontier.Store = frontier.NewMemoryStore()
+	if cfg.Lite.Frontier == "redis" {
+		rdb, err := database.NewRedisClient(ctx, cfg.Redis)
+		if err != nil {
+			logging.Fatal("redis frontier unavailable", "error", err)
+		}
+		defer rdb.Close()
+		checker.AddCheck("redis", func(ctx context.Context) error { return rdb.Ping(ctx).Err() })
+		store = frontier.NewRedisStore(rdb)
+	}
+
+	jobs := crawler.NewMemoryJobStore()
+	docs := sink.NewMemorySink()
+	index := database.NewMemoryVectorIndex()
+
+	var embeddingProc *processor.EmbeddingProcessor
+	if cfg.Embedding.URL != "" {
+		embeddingProc = processor.NewEmbeddingProcessor(cfg.Embedding.URL)
+		embeddingProc.Model = cfg.Embedding.Model
+	} else {
+		slog.Warn("no embedding service configured, using hashing embedder", "dims", cfg.Qdrant.VectorSize)
+		embeddingProc = processor.NewHashEmbeddingProcessor(int(cfg.Qdrant.VectorSize))
+	}
+
+	go func() {
+		listener, err := net.Listen("tcp", cfg.Server.GRPCAddr)
+		if err != nil {
+			logging.Fatal("failed to listen", "component", "control_plane", "addr", cfg.Server.GRPCAddr, "error", err)
+		}
+
+		grpcServer := grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler()))
+		crawlerService := crawler.NewCrawlerService(jobs, nt.JS)
+		crawlerService.Subject = cfg.NATS.JobsSubject
+		crawlerService.Shards = cfg.NATS.JobShards
+		pb.RegisterCrawlerServiceServer(grpcServer, crawlerService)
+		reflection.Register(grpcServer)
+
+		go func() {
+			<-ctx.Done()
+			grpcServer.GracefulStop()
+		}()
+
+		slog.Info("grpc api listening", "component", "control_plane", "addr", cfg.Server.GRPCAddr)
+		if err := grpcServer.Serve(listener); err != nil {
+			slog.Error("grpc server failed", "component", "control_plane", "error", err)
+		}
+	}()
+
+	go serveHTTP(ctx, cfg.Lite.SearchAddr, search.NewHandler(index, cfg.Qdrant.Collection, embeddingProc.EmbedQuery))
+
+	discovery := buildDiscovery(cfg, nt, store, docs)
+	enrichment, closeEnrichment := buildEnrichment(ctx, cfg, nt, docs, index, embeddingProc)
+	defer closeEnrichment()
+
+	go metrics.Serve(ctx, cfg.Server.MetricsAddr)
+	go health.Serve(ctx, cfg.Server.HealthAddr, checker)
+
+	slog.Info("lite topology constructed, starting engines", "search_addr", cfg.Lite.SearchAddr)
+
+	var wg sync.WaitGroup
+	for _, runner := range []*core.GraphRunner[*core.Document[string]]{discovery, enrichment} {
+		runner.Observer = metrics.GraphObserver{}
+		metrics.RegisterNodeStats(runner.Name, runner.Nodes)
+		checker.AddRunner(runner.Name, runner)
+
+		wg.Add(1)
+		go func(runner *core.GraphRunner[*core.Document[string]]) {
+			defer wg.Done()
+			if err := runner.Run(ctx); err != nil {
+				slog.Error("graph stopped", "graph", runner.Name, "error", err)
+			}
+		}(runner)
+	}
+	wg.Wait()
+
+	slog.Info("lite stopped", "documents", docs.Len(), "vectors", index.Len(cfg.Qdrant.Collection))
+}
+
+func buildDiscovery(cfg *config.Config, nt *database.NatsConn, store frontier.Store, docs *sink.MemorySink) *core.GraphRunner[*core.Document[string]] {
+	topology := database.NewTopology(cfg.NATS)
+	discoverySrc := source.NewNatsSource(nt.JS, cfg.NATS.FrontierStream, cfg.NATS.JobsSubject, "discovery-group")
+	discoverySrc.Limits = topology.Consumers
+	discoverySrc.DeadLetterSubject = topology.DeadLetterSubject(cfg.NATS.FrontierStream)
+	frontierSrc := source.NewFrontierSource(discoverySrc, cfg.NATS.JobsSubject, cfg.NATS.JobShards)
+
+	discoverySink := sink.NewNatsSink(nt.JS, cfg.NATS.JobsSubject)
+	discoverySink.SubjectFor = frontier.SubjectFor(cfg.NATS.JobsSubject, cfg.NATS.JobShards)
+	enrichmentSink := sink.NewNatsSink(nt.JS, cfg.NATS.EnrichmentSubject)
+
+	runner := core.NewGraphRunner("lite-discovery", frontierSrc, cfg.Discovery.Concurrency)
+
+	if err := runner.AddProcessor("start", processor.NewPolitenessProcessor(store, cfg.Discovery.UserAgent, cfg.Discovery.MaxDepth, cfg.Discovery.MaxPages, false)); err != nil {
+		logging.Fatal("failed to add node", "node", "start", "error", err)
+	}
+	if err := runner.AddProcessor("crawler", processor.NewSmartCrawlerProcessor()); err != nil {
+		logging.Fatal("failed to add node", "node", "crawler", "error", err)
+	}
+	if err := runner.AddHybrid("discovery", processor.NewDiscoveryProcessor(), discoverySink); err != nil {
+		logging.Fatal("failed to add node", "node", "discovery", "error", err)
+	}
+	// The page row is stored once here; the chunker's sink adds its chunks.
+	if err := runner.AddHybrid("security", processor.NewSecurityProcessor(cfg.Discovery.StrictSecurity), docs); err != nil {
+		logging.Fatal("failed to add node", "node", "security", "error", err)
+	}
+	if err := runner.AddHybrid("chunker", processor.NewChunkerProcessor(cfg.Discovery.ChunkSize, cfg.Discovery.ChunkOverlap), docs); err != nil {
+		logging.Fatal("failed to add node", "node", "chunker", "error", err)
+	}
+	if err := runner.AddHybrid("async_enrichment", processor.NewEnrichmentProcessor(), enrichmentSink); err != nil {
+		logging.Fatal("failed to add node", "node", "async_enrichment", "error", err)
+	}
+
+	if err := runner.SetRetryPolicy("crawler", core.DefaultRetryPolicy()); err != nil {
+		logging.Fatal("failed to set retry policy", "error", err)
+	}
+	if err := runner.SetTimeout("start", cfg.Discovery.PolitenessTimeout); err != nil {
+		logging.Fatal("failed to set node timeout", "error", err)
+	}
+	if err := runner.SetTimeout("crawler", cfg.Discovery.CrawlTimeout); err != nil {
+		logging.Fatal("failed to set node timeout", "error", err)
+	}
+
+	for _, edge := range [][2]string{
+		{"start", "crawler"},
+		{"crawler", "discovery"},
+		{"crawler", "security"},
+		{"security", "chunker"},
+		{"chunker", "async_enrichment"},
+	} {
+		if err := runner.Connect(edge[0], edge[1]); err != nil {
+			logging.Fatal("graph wiring failed", "error", err)
+		}
+	}
+	return runner
+}
+
+func buildEnrichment(ctx context.Context, cfg *config.Config, nt *database.NatsConn, docs *sink.MemorySink, index *database.MemoryVectorIndex, embeddingProc *processor.EmbeddingProcessor) (*core.GraphRunner[*core.Document[string]], func()) {
+	var llmProvider processor.LLMProvider
+	if cfg.LLM.GeminiAPIKey != "" {
+		slog.Info("using gemini llm provider")
+		llmProvider, _ = llm_provider.NewGeminiProvider(ctx, cfg.LLM.GeminiAPIKey)
+	} else if cfg.LLM.OllamaURL != "" {
+		slog.Info("using ollama llm provider", "model", cfg.LLM.OllamaModel)
+		llmProvider = llm_provider.NewOllamaProvider(cfg.LLM.OllamaURL, cfg.LLM.OllamaModel)
+	} else {
+		slog.Warn("no llm configured, using mock provider")
+		llmProvider = &llm_provider.MockProvider{}
+	}
+
+	llmBreaker := core.NewCircuitBreaker("llm", 5, 60*time.Second)
+	llmProvider = llm_provider.NewBreakerProvider(llmProvider, llmBreaker)
+
+	vectorBase := sink.NewQdrantSink(index, cfg.Qdrant.Collection)
+	vectorBase.Spec = database.EmbeddingSpec{Model: embeddingProc.Model, Dimension: cfg.Qdrant.VectorSize, Task: embeddingProc.Task}
+
+	topology := database.NewTopology(cfg.NATS)
+	enrichmentSrc := source.NewNatsSource(nt.JS, cfg.NATS.EnrichmentStream, cfg.NATS.EnrichmentSubject, "enrichment-group")
+	enrichmentSrc.Limits = topology.Consumers
+	enrichmentSrc.DeadLetterSubject = topology.DeadLetterSubject(cfg.NATS.EnrichmentStream)
+	enrichmentSrc.Gates = []core.Gate{llmBreaker, embeddingProc.Breaker, vectorBase.Breaker}
+
+	vectorSink := core.NewBatchingSink(vectorBase, cfg.Enrichment.QdrantBatchSize, cfg.Enrichment.QdrantBatchWait)
+	embedder := core.NewBatchingProcessor(embeddingProc, cfg.Embedding.BatchSize, cfg.Embedding.BatchWait)
+
+	runner := core.NewGraphRunner("lite-enrichment", enrichmentSrc, cfg.Enrichment.Concurrency)
+
+	if err := runner.AddProcessor("start", processor.NewMetadataProcessor(llmProvider)); err != nil {
+		logging.Fatal("failed to add node", "node", "metadata", "error", err)
+	}
+	if err := runner.AddHybrid("embedding", embedder, vectorSink); err != nil {
+		logging.Fatal("failed to add node", "node", "embedding", "error", err)
+	}
+	if err := runner.AddSink("persist", docs); err != nil {
+		logging.Fatal("failed to add node", "node", "persist", "error", err)
+	}
+
+	if err := runner.SetRetryPolicy("start", core.DefaultRetryPolicy()); err != nil {
+		logging.Fatal("failed to set retry policy", "error", err)
+	}
+	// Chunks the LLM cannot enrich are still embedded and indexed.
+	if err := runner.SetOptional("start"); err != nil {
+		logging.Fatal("failed to mark node optional", "error", err)
+	}
+	if err := runner.SetRetryPolicy("embedding", core.DefaultRetryPolicy()); err != nil {
+		logging.Fatal("failed to set retry policy", "error", err)
+	}
+	if err := runner.SetTimeout("start", cfg.Enrichment.MetadataTimeout); err != nil {
+		logging.Fatal("failed to set node timeout", "error", err)
+	}
+	if err := runner.SetTimeout("embedding", cfg.Enrichment.EmbeddingTimeout); err != nil {
+		logging.Fatal("failed to set node timeout", "error", err)
+	}
+
+	if err := runner.Connect("start", "embedding"); err != nil {
+		logging.Fatal("graph wiring failed", "error", err)
+	}
+	if err := runner.Connect("embedding", "persist"); err != nil {
+		logging.Fatal("graph wiring failed", "error", err)
+	}
+
+	return runner, func() {
+		_ = vectorSink.Close()
+		_ = embedder.Close()
+	}
+}
+
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) {
+	srv := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("search api listening", "component", "search", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("search server failed", "component", "search", "error", err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/oranjParker/Rarefactor/internal/config"
+	"github.com/oranjParker/Rarefactor/internal/database"
+	"github.com/oranjParker/Rarefactor/internal/logging"
+	"github.com/oranjParker/Rarefactor/internal/processor"
+	"github.com/oranjParker/Rarefactor/internal/reindex"
+	"github.com/oranjParker/Rarefactor/internal/sink"
+	"github.com/oranjParker/Rarefactor/internal/source"
+)
+
+// Reindex re-embeds every enriched chunk with embedding.model into a new
+// versioned collection (qdrant.collection + "_vN"), sized for whatever the
+// model returns, and points the qdrant.collection alias at it once complete.
+// Run it before rolling the enrichment workers onto the new model.
+func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+		os.Exit(2)
+	}
+	logging.Setup("reindex", cfg.Log.Level, cfg.Log.Format)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pg, err := database.NewPool(ctx, cfg.Postgres)
+	if err != nil {
+		logging.Fatal("postgres connection failed", "error", err)
+	}
+	defer pg.Close()
+
+	qdb, err := database.NewQdrantClient(ctx, cfg.Qdrant)
+	if err != nil {
+		logging.Fatal("qdrant connection failed", "error", err)
+	}
+	defer qdb.Close()
+
+	embeddingProc := processor.NewEmbeddingProcessor(cfg.Embedding.URL)
+	embeddingProc.Model = cfg.Embedding.Model
+
+	chunks := func(since time.Time) reindex.Chunks {
+		backlog := source.NewChunkBacklog(pg)
+		// A chunk the LLM stage failed on is still indexed, so it is
+		// re-embedded too.
+		backlog.Statuses = []string{sink.EnrichmentPending, sink.EnrichmentEnriched, sink.EnrichmentFailed}
+		backlog.Embedded = true
+		backlog.MinAge = 0
+		backlog.UpdatedSince = since
+		return backlog
+	}
+	r := reindex.NewReindexer(embeddingProc, qdb, reindex.NewPostgresJobStore(pg), chunks, cfg.Qdrant.Collection, cfg.Embedding.Model)
+	r.Task = embeddingProc.Task
+	catalog := sink.NewPostgresSink(pg, cfg.Postgres.BatchSize, cfg.Postgres.FlushInterval, cfg.Postgres.MaxBuffered)
+	defer catalog.Close()
+	r.Catalog = catalog
+	r.BatchSize = cfg.Embedding.BatchSize
+
+	job, err := r.Run(ctx)
+	if err != nil {
+		logging.Fatal("reindex failed", "job_id", job.ID, "collection", job.Collection, "error", err)
+	}
+	slog.Info("reindex finished", "job_id", job.ID, "alias", job.Alias, "collection", job.Collection, "dims", job.Dimension)
+}
@@ -3,79 +3,148 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/nats-io/nats.go/jetstream"
+	"github.com/oranjParker/Rarefactor/internal/config"
 	"github.com/oranjParker/Rarefactor/internal/core"
 	"github.com/oranjParker/Rarefactor/internal/database"
+	"github.com/oranjParker/Rarefactor/internal/health"
 	"github.com/oranjParker/Rarefactor/internal/llm_provider"
+	"github.com/oranjParker/Rarefactor/internal/logging"
+	"github.com/oranjParker/Rarefactor/internal/metrics"
 	"github.com/oranjParker/Rarefactor/internal/processor"
 	"github.com/oranjParker/Rarefactor/internal/sink"
 	"github.com/oranjParker/Rarefactor/internal/source"
+	"github.com/oranjParker/Rarefactor/internal/tracing"
 )
 
 func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+		os.Exit(2)
+	}
+	logging.Setup("enrichment", cfg.Log.Level, cfg.Log.Format)
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	deps, err := setupWorkerDependencies(ctx)
+	shutdownTracing, err := tracing.Setup(ctx, "enrichment", cfg.Tracing.OTLPEndpoint)
+	if err != nil {
+		logging.Fatal("tracing setup failed", "error", err)
+	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = shutdownTracing(flushCtx)
+	}()
+
+	deps, err := setupWorkerDependencies(ctx, cfg)
 	if err != nil {
-		log.Fatalf("Infrastructure failure: %v", err)
+		logging.Fatal("infrastructure failure", "error", err)
 	}
 	defer deps.Nats.Close()
 	defer deps.Postgres.Close()
 	defer deps.Qdrant.Close()
 
 	var llmProvider processor.LLMProvider
-	geminiKey := os.Getenv("GEMINI_API_KEY")
-	ollamaURL := os.Getenv("OLLAMA_URL")
-
-	if geminiKey != "" {
-		log.Println("[LLM] Using Gemini (Cloud Free Tier)")
-		llmProvider, _ = llm_provider.NewGeminiProvider(ctx, geminiKey)
-	} else if ollamaURL != "" {
-		log.Println("[LLM] Using Ollama (Local/Zero-Cost)")
-		llmProvider = llm_provider.NewOllamaProvider(ollamaURL, "mistral")
+	if cfg.LLM.GeminiAPIKey != "" {
+		slog.Info("using gemini llm provider")
+		llmProvider, _ = llm_provider.NewGeminiProvider(ctx, cfg.LLM.GeminiAPIKey)
+	} else if cfg.LLM.OllamaURL != "" {
+		slog.Info("using ollama llm provider", "model", cfg.LLM.OllamaModel)
+		llmProvider = llm_provider.NewOllamaProvider(cfg.LLM.OllamaURL, cfg.LLM.OllamaModel)
 	} else {
-		log.Println("[LLM] No LLM config found. Using Mock Provider for testing.")
+		slog.Warn("no llm configured, using mock provider")
 		llmProvider = &llm_provider.MockProvider{}
 	}
 
-	enrichmentSrc := source.NewNatsSource(deps.Nats.JS, "crawl.enrichment", "enrichment-group")
-	pgSink := sink.NewPostgresSink(deps.Postgres, 50, 5*time.Second)
+	llmBreaker := core.NewCircuitBreaker("llm", 5, 60*time.Second)
+	llmProvider = llm_provider.NewBreakerProvider(llmProvider, llmBreaker)
+
+	embeddingProc := processor.NewEmbeddingProcessor(cfg.Embedding.URL)
+	embeddingProc.Model = cfg.Embedding.Model
+	spec := database.EmbeddingSpec{Model: embeddingProc.Model, Dimension: cfg.Qdrant.VectorSize, Task: embeddingProc.Task}
+	if err := deps.Qdrant.EnsureCollection(ctx, cfg.Qdrant.Collection, spec); err != nil {
+		logging.Fatal("qdrant collection check failed", "error", err)
+	}
+	qdrantBase := sink.NewQdrantSink(deps.Qdrant, cfg.Qdrant.Collection)
+	qdrantBase.Spec = spec
+
+	topology := database.NewTopology(cfg.NATS)
+	enrichmentSrc := source.NewNatsSource(deps.Nats.JS, cfg.NATS.EnrichmentStream, cfg.NATS.EnrichmentSubject, "enrichment-group")
+	enrichmentSrc.Limits = topology.Consumers
+	enrichmentSrc.DeadLetterSubject = topology.DeadLetterSubject(cfg.NATS.EnrichmentStream)
+	enrichmentSrc.Gates = []core.Gate{llmBreaker, embeddingProc.Breaker, qdrantBase.Breaker}
+
+	pgSink := sink.NewPostgresSink(deps.Postgres, cfg.Postgres.BatchSize, cfg.Postgres.FlushInterval, cfg.Postgres.MaxBuffered)
+	pgSink.Ingest = sink.IngestMode(cfg.Postgres.Ingest)
 	defer pgSink.Close()
+	enrichmentSrc.Failures = pgSink
 
-	qdrantSink := sink.NewQdrantSink(deps.Qdrant, "documents")
+	qdrantSink := core.NewBatchingSink(qdrantBase, cfg.Enrichment.QdrantBatchSize, cfg.Enrichment.QdrantBatchWait)
+	defer qdrantSink.Close()
 
-	runner := core.NewGraphRunner("Rarefactor-V2", enrichmentSrc, 3)
+	embedder := core.NewBatchingProcessor(embeddingProc, cfg.Embedding.BatchSize, cfg.Embedding.BatchWait)
+	defer embedder.Close()
+
+	runner := core.NewGraphRunner("Rarefactor-V2", enrichmentSrc, cfg.Enrichment.Concurrency)
 
 	if err := runner.AddProcessor("start", processor.NewMetadataProcessor(llmProvider)); err != nil {
-		log.Fatalf("Failed to add node 'metadata': %v", err)
+		logging.Fatal("failed to add node", "node", "metadata", "error", err)
 	}
 
-	if err := runner.AddHybrid("embedding", processor.NewEmbeddingProcessor(os.Getenv("EMBEDDING_URL")), qdrantSink); err != nil {
-		log.Fatalf("Failed to add node 'embedding': %v", err)
+	if err := runner.AddHybrid("embedding", embedder, qdrantSink); err != nil {
+		logging.Fatal("failed to add node", "node", "embedding", "error", err)
 	}
 
 	if err := runner.AddSink("persist_pg", pgSink); err != nil {
-		log.Fatalf("Failed to add node 'persist_pg': %v", err)
+		logging.Fatal("failed to add node", "node", "persist_pg", "error", err)
+	}
+
+	if err := runner.SetRetryPolicy("start", core.DefaultRetryPolicy()); err != nil {
+		logging.Fatal("failed to set retry policy", "error", err)
+	}
+	// Chunks the LLM cannot enrich are still embedded and indexed.
+	if err := runner.SetOptional("start"); err != nil {
+		logging.Fatal("failed to mark node optional", "error", err)
+	}
+	if err := runner.SetRetryPolicy("embedding", core.DefaultRetryPolicy()); err != nil {
+		logging.Fatal("failed to set retry policy", "error", err)
+	}
+	if err := runner.SetTimeout("start", cfg.Enrichment.MetadataTimeout); err != nil {
+		logging.Fatal("failed to set node timeout", "error", err)
+	}
+	if err := runner.SetTimeout("embedding", cfg.Enrichment.EmbeddingTimeout); err != nil {
+		logging.Fatal("failed to set node timeout", "error", err)
 	}
 
 	if err := runner.Connect("start", "embedding"); err != nil {
-		log.Fatalf("Graph wiring failed: %v", err)
+		logging.Fatal("graph wiring failed", "error", err)
 	}
 	if err := runner.Connect("embedding", "persist_pg"); err != nil {
-		log.Fatalf("Graph wiring failed: %v", err)
+		logging.Fatal("graph wiring failed", "error", err)
 	}
 
-	log.Println("[Graph] Enrichment Topology constructed. Starting engine...")
+	runner.Observer = metrics.GraphObserver{}
+	metrics.RegisterNodeStats(runner.Name, runner.Nodes)
+	go metrics.Serve(ctx, cfg.Server.MetricsAddr)
+
+	checker := health.NewChecker()
+	checker.AddCheck("postgres", deps.Postgres.Ping)
+	checker.AddCheck("nats", deps.Nats.Ping)
+	checker.AddCheck("qdrant", deps.Qdrant.Ping)
+	checker.AddRunner("enrichment", runner)
+	go health.Serve(ctx, cfg.Server.HealthAddr, checker)
+
+	slog.Info("enrichment topology constructed, starting engine")
 	if err := runner.Run(ctx); err != nil {
-		log.Printf("Worker stopped: %v", err)
+		slog.Error("worker stopped", "error", err)
 	}
 }
 
@@ -85,7 +154,7 @@ type WorkerDependencies struct {
 	Qdrant   *database.QdrantClient
 }
 
-func setupWorkerDependencies(ctx context.Context) (*WorkerDependencies, error) {
+func setupWorkerDependencies(ctx context.Context, cfg *config.Config) (*WorkerDependencies, error) {
 	deadline := time.Now().Add(120 * time.Second)
 
 	var (
@@ -95,7 +164,7 @@ func setupWorkerDependencies(ctx context.Context) (*WorkerDependencies, error) {
 		err error
 	)
 
-	log.Println("[Init] Waiting for infrastructure (NATS, Postgres, Redis, Qdrant)...")
+	slog.Info("waiting for infrastructure")
 
 	for time.Now().Before(deadline) {
 		select {
@@ -105,44 +174,34 @@ func setupWorkerDependencies(ctx context.Context) (*WorkerDependencies, error) {
 		}
 
 		if pg == nil {
-			pg, err = database.NewPool(ctx)
+			pg, err = database.NewPool(ctx, cfg.Postgres)
 			if err != nil {
-				log.Printf("Postgres not ready: %v", err)
+				slog.Warn("dependency not ready", "dependency", "postgres", "error", err)
 				goto retry
 			}
 		}
 
 		if nt == nil {
-			nt, err = database.NewNatsConnection()
+			nt, err = database.NewNatsConnection(cfg.NATS)
 			if err != nil {
-				log.Printf("NATS not ready: %v", err)
+				slog.Warn("dependency not ready", "dependency", "nats", "error", err)
 				goto retry
 			}
 
-			_, err = nt.JS.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
-				Name:      "CRAWL_JOBS",
-				Subjects:  []string{"crawl.>"},
-				Retention: jetstream.WorkQueuePolicy,
-				MaxMsgs:   1000000,
-				MaxBytes:  10 * 1024 * 1024 * 1024,
-				Discard:   jetstream.DiscardOld,
-			})
+			err = database.NewTopology(cfg.NATS).Provision(ctx, nt.JS)
 			if err != nil {
-				log.Printf("Stream setup failed: %v", err)
+				slog.Warn("stream setup failed", "error", err)
 				nt.Close()
 				nt = nil
 				goto retry
 			}
 		}
 		if qdb == nil {
-			qdb, err = database.NewQdrantClient(ctx)
+			qdb, err = database.NewQdrantClient(ctx, cfg.Qdrant)
 			if err != nil {
-				log.Printf("Qdrant not ready: %v", err)
+				slog.Warn("dependency not ready", "dependency", "qdrant", "error", err)
 				goto retry
 			}
-			if err := qdb.EnsureCollection(ctx, "documents"); err != nil {
-				log.Printf("Qdrant collection warning: %v", err)
-			}
 		}
 
 		return &WorkerDependencies{
@@ -3,7 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"os/signal"
@@ -11,106 +11,163 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/nats-io/nats.go/jetstream"
 	pb "github.com/oranjParker/Rarefactor/generated/protos/v1"
 	"github.com/oranjParker/Rarefactor/internal/api/crawler"
+	"github.com/oranjParker/Rarefactor/internal/config"
 	"github.com/oranjParker/Rarefactor/internal/core"
 	"github.com/oranjParker/Rarefactor/internal/database"
+	"github.com/oranjParker/Rarefactor/internal/frontier"
+	"github.com/oranjParker/Rarefactor/internal/health"
+	"github.com/oranjParker/Rarefactor/internal/logging"
+	"github.com/oranjParker/Rarefactor/internal/metrics"
 	"github.com/oranjParker/Rarefactor/internal/processor"
 	"github.com/oranjParker/Rarefactor/internal/sink"
 	"github.com/oranjParker/Rarefactor/internal/source"
+	"github.com/oranjParker/Rarefactor/internal/tracing"
 	"github.com/redis/go-redis/v9"
-
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 )
 
-const GRPC_PORT = ":50051"
-
 func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+		os.Exit(2)
+	}
+	logging.Setup("web-discovery", cfg.Log.Level, cfg.Log.Format)
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	deps, err := setupWorkerDependencies(ctx)
+	shutdownTracing, err := tracing.Setup(ctx, "web-discovery", cfg.Tracing.OTLPEndpoint)
+	if err != nil {
+		logging.Fatal("tracing setup failed", "error", err)
+	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = shutdownTracing(flushCtx)
+	}()
+
+	deps, err := setupWorkerDependencies(ctx, cfg)
 	if err != nil {
-		log.Fatalf("Infrastructure failure: %v", err)
+		logging.Fatal("infrastructure failure", "error", err)
 	}
 	defer deps.Nats.Close()
 	defer deps.Redis.Close()
 	defer deps.Postgres.Close()
 
+	checker := health.NewChecker()
+	checker.AddCheck("postgres", deps.Postgres.Ping)
+	checker.AddCheck("redis", func(ctx context.Context) error { return deps.Redis.Ping(ctx).Err() })
+	checker.AddCheck("nats", deps.Nats.Ping)
+
 	// =========================================================================
 	// CONTROL PLANE: Start gRPC Server (Simulated API Pod)
 	// =========================================================================
 	go func() {
-		listener, err := net.Listen("tcp", GRPC_PORT)
+		listener, err := net.Listen("tcp", cfg.Server.GRPCAddr)
 		if err != nil {
-			log.Fatalf("[Control Plane] Failed to listen on %s: %v", GRPC_PORT, err)
+			logging.Fatal("failed to listen", "component", "control_plane", "addr", cfg.Server.GRPCAddr, "error", err)
 		}
 
-		grpcServer := grpc.NewServer()
-		crawlerService := crawler.NewCrawlerService(deps.Postgres, deps.Nats.JS)
+		grpcServer := grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler()))
+		crawlerService := crawler.NewCrawlerService(crawler.NewPostgresJobStore(deps.Postgres), deps.Nats.JS)
+		crawlerService.Subject = cfg.NATS.JobsSubject
+		crawlerService.Shards = cfg.NATS.JobShards
 		pb.RegisterCrawlerServiceServer(grpcServer, crawlerService)
 
+		healthServer := grpchealth.NewServer()
+		healthpb.RegisterHealthServer(grpcServer, healthServer)
+		go health.WatchGRPC(ctx, healthServer, checker, 10*time.Second, pb.CrawlerService_ServiceDesc.ServiceName)
+
 		reflection.Register(grpcServer)
 
-		log.Printf("[Control Plane] gRPC API listening on %s", GRPC_PORT)
+		slog.Info("grpc api listening", "component", "control_plane", "addr", cfg.Server.GRPCAddr)
 		if err := grpcServer.Serve(listener); err != nil {
-			log.Printf("[Control Plane] gRPC server error: %v", err)
+			slog.Error("grpc server failed", "component", "control_plane", "error", err)
 		}
 	}()
 
 	// =========================================================================
 	// DATA PLANE: Start Graph Runner (Simulated Worker Pods)
 	// =========================================================================
-	discoverySrc := source.NewNatsSource(deps.Nats.JS, "crawl.jobs", "discovery-group")
-	pgSink := sink.NewPostgresSink(deps.Postgres, 50, 5*time.Second)
+	topology := database.NewTopology(cfg.NATS)
+	discoverySrc := source.NewNatsSource(deps.Nats.JS, cfg.NATS.FrontierStream, cfg.NATS.JobsSubject, "discovery-group")
+	discoverySrc.Limits = topology.Consumers
+	discoverySrc.DeadLetterSubject = topology.DeadLetterSubject(cfg.NATS.FrontierStream)
+	frontierSrc := source.NewFrontierSource(discoverySrc, cfg.NATS.JobsSubject, cfg.NATS.JobShards)
+	pgSink := sink.NewPostgresSink(deps.Postgres, cfg.Postgres.BatchSize, cfg.Postgres.FlushInterval, cfg.Postgres.MaxBuffered)
+	pgSink.Ingest = sink.IngestMode(cfg.Postgres.Ingest)
 	defer pgSink.Close()
 
-	discoverySink := sink.NewNatsSink(deps.Nats.JS, "crawl.jobs")
-	enrichmentSink := sink.NewNatsSink(deps.Nats.JS, "crawl.enrichment")
+	discoverySink := sink.NewNatsSink(deps.Nats.JS, cfg.NATS.JobsSubject)
+	discoverySink.SubjectFor = frontier.SubjectFor(cfg.NATS.JobsSubject, cfg.NATS.JobShards)
+	enrichmentSink := sink.NewNatsSink(deps.Nats.JS, cfg.NATS.EnrichmentSubject)
 
-	runner := core.NewGraphRunner("Rarefactor-V2", discoverySrc, 5)
+	runner := core.NewGraphRunner("Rarefactor-V2", frontierSrc, cfg.Discovery.Concurrency)
 
-	if err := runner.AddProcessor("start", processor.NewPolitenessProcessor(deps.Redis, "RarefactorBot/2.0", 3, 1000, false)); err != nil {
-		log.Fatalf("Failed to add node 'start': %v", err)
+	if err := runner.AddProcessor("start", processor.NewPolitenessProcessor(frontier.NewRedisStore(deps.Redis), cfg.Discovery.UserAgent, cfg.Discovery.MaxDepth, cfg.Discovery.MaxPages, false)); err != nil {
+		logging.Fatal("failed to add node", "node", "start", "error", err)
 	}
 	if err := runner.AddProcessor("crawler", processor.NewSmartCrawlerProcessor()); err != nil {
-		log.Fatalf("Failed to add node 'crawler': %v", err)
+		logging.Fatal("failed to add node", "node", "crawler", "error", err)
 	}
 	if err := runner.AddHybrid("discovery", processor.NewDiscoveryProcessor(), discoverySink); err != nil {
-		log.Fatalf("Failed to add node 'discovery': %v", err)
+		logging.Fatal("failed to add node", "node", "discovery", "error", err)
 	}
-	if err := runner.AddProcessor("security", processor.NewSecurityProcessor(false)); err != nil { // false = don't fail, just flag
-		log.Fatalf("Failed to add node 'security': %v", err)
+	// The page row is stored once here; the chunker's sink adds its chunks.
+	if err := runner.AddHybrid("security", processor.NewSecurityProcessor(cfg.Discovery.StrictSecurity), pgSink); err != nil {
+		logging.Fatal("failed to add node", "node", "security", "error", err)
 	}
-	if err := runner.AddHybrid("chunker", processor.NewChunkerProcessor(4000, 400), pgSink); err != nil {
-		log.Fatalf("Failed to add node 'chunker': %v", err)
+	if err := runner.AddHybrid("chunker", processor.NewChunkerProcessor(cfg.Discovery.ChunkSize, cfg.Discovery.ChunkOverlap), pgSink); err != nil {
+		logging.Fatal("failed to add node", "node", "chunker", "error", err)
 	}
 
 	if err := runner.AddHybrid("async_enrichment", processor.NewEnrichmentProcessor(), enrichmentSink); err != nil {
-		log.Fatalf("Failed to add node 'async_enrichment': %v", err)
+		logging.Fatal("failed to add node", "node", "async_enrichment", "error", err)
+	}
+
+	if err := runner.SetRetryPolicy("crawler", core.DefaultRetryPolicy()); err != nil {
+		logging.Fatal("failed to set retry policy", "error", err)
+	}
+	if err := runner.SetTimeout("start", cfg.Discovery.PolitenessTimeout); err != nil {
+		logging.Fatal("failed to set node timeout", "error", err)
+	}
+	if err := runner.SetTimeout("crawler", cfg.Discovery.CrawlTimeout); err != nil {
+		logging.Fatal("failed to set node timeout", "error", err)
 	}
 
 	if err := runner.Connect("start", "crawler"); err != nil {
-		log.Fatalf("Graph wiring failed: %v", err)
+		logging.Fatal("graph wiring failed", "error", err)
 	}
 	if err := runner.Connect("crawler", "discovery"); err != nil {
-		log.Fatalf("Graph wiring failed: %v", err)
+		logging.Fatal("graph wiring failed", "error", err)
 	}
 	if err := runner.Connect("crawler", "security"); err != nil {
-		log.Fatalf("Graph wiring failed: %v", err)
+		logging.Fatal("graph wiring failed", "error", err)
 	}
 	if err := runner.Connect("security", "chunker"); err != nil {
-		log.Fatalf("Graph wiring failed: %v", err)
+		logging.Fatal("graph wiring failed", "error", err)
 	}
 	if err := runner.Connect("chunker", "async_enrichment"); err != nil {
-		log.Fatalf("Graph wiring failed: %v", err)
+		logging.Fatal("graph wiring failed", "error", err)
 	}
 
-	log.Println("[Graph] Worker Topology constructed. Starting engine...")
+	runner.Observer = metrics.GraphObserver{}
+	metrics.RegisterNodeStats(runner.Name, runner.Nodes)
+	go metrics.Serve(ctx, cfg.Server.MetricsAddr)
+
+	checker.AddRunner("discovery", runner)
+	go health.Serve(ctx, cfg.Server.HealthAddr, checker)
+
+	slog.Info("worker topology constructed, starting engine")
 	if err := runner.Run(ctx); err != nil {
-		log.Printf("[Graph] Worker stopped: %v", err)
+		slog.Error("worker stopped", "error", err)
 	}
 }
 
@@ -120,7 +177,7 @@ type WorkerDependencies struct {
 	Postgres *pgxpool.Pool
 }
 
-func setupWorkerDependencies(ctx context.Context) (*WorkerDependencies, error) {
+func setupWorkerDependencies(ctx context.Context, cfg *config.Config) (*WorkerDependencies, error) {
 	deadline := time.Now().Add(120 * time.Second)
 
 	var (
@@ -130,7 +187,7 @@ func setupWorkerDependencies(ctx context.Context) (*WorkerDependencies, error) {
 		err error
 	)
 
-	log.Println("[Init] Waiting for infrastructure (NATS, Postgres, Redis, Qdrant)...")
+	slog.Info("waiting for infrastructure")
 
 	for time.Now().Before(deadline) {
 		select {
@@ -140,38 +197,31 @@ func setupWorkerDependencies(ctx context.Context) (*WorkerDependencies, error) {
 		}
 
 		if pg == nil {
-			pg, err = database.NewPool(ctx)
+			pg, err = database.NewPool(ctx, cfg.Postgres)
 			if err != nil {
-				log.Printf("Postgres not ready: %v", err)
+				slog.Warn("dependency not ready", "dependency", "postgres", "error", err)
 				goto retry
 			}
 		}
 
 		if rdb == nil {
-			rdb, err = database.NewRedisClient(ctx)
+			rdb, err = database.NewRedisClient(ctx, cfg.Redis)
 			if err != nil {
-				log.Printf("Redis not ready: %v", err)
+				slog.Warn("dependency not ready", "dependency", "redis", "error", err)
 				goto retry
 			}
 		}
 
 		if nt == nil {
-			nt, err = database.NewNatsConnection()
+			nt, err = database.NewNatsConnection(cfg.NATS)
 			if err != nil {
-				log.Printf("NATS not ready: %v", err)
+				slog.Warn("dependency not ready", "dependency", "nats", "error", err)
 				goto retry
 			}
 
-			_, err = nt.JS.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
-				Name:      "CRAWL_JOBS",
-				Subjects:  []string{"crawl.>"},
-				Retention: jetstream.WorkQueuePolicy,
-				MaxMsgs:   1000000,
-				MaxBytes:  10 * 1024 * 1024 * 1024,
-				Discard:   jetstream.DiscardOld,
-			})
+			err = database.NewTopology(cfg.NATS).Provision(ctx, nt.JS)
 			if err != nil {
-				log.Printf("Stream setup failed: %v", err)
+				slog.Warn("stream setup failed", "error", err)
 				nt.Close()
 				nt = nil
 				goto retry
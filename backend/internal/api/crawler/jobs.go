@@ -0,0 +1,101 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type Job struct {
+	ID        string
+	SeedURL   string
+	MaxDepth  int32
+	CrawlMode string
+	Namespace string
+	Status    string
+	CreatedAt time.Time
+}
+
+// JobStore records crawl jobs submitted through the API.
+type JobStore interface {
+	Create(ctx context.Context, job Job) error
+	MarkFailed(ctx context.Context, id string) error
+	Cancel(ctx context.Context, id string) error
+}
+
+type PostgresJobStore struct {
+	db DBExecutor
+}
+
+func NewPostgresJobStore(db DBExecutor) *PostgresJobStore {
+	return &PostgresJobStore{db: db}
+}
+
+func (s *PostgresJobStore) Create(ctx context.Context, job Job) error {
+	query := `
+		INSERT INTO crawl_jobs (id, seed_url, max_depth, crawl_mode, namespace, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, 'PENDING', NOW())
+	`
+	_, err := s.db.Exec(ctx, query, job.ID, job.SeedURL, job.MaxDepth, job.CrawlMode, job.Namespace)
+	return err
+}
+
+func (s *PostgresJobStore) MarkFailed(ctx context.Context, id string) error {
+	_, err := s.db.Exec(ctx, "UPDATE crawl_jobs SET status = 'FAILED' WHERE id = $1", id)
+	return err
+}
+
+func (s *PostgresJobStore) Cancel(ctx context.Context, id string) error {
+	_, err := s.db.Exec(ctx, "UPDATE crawl_jobs SET status = 'CANCELLED' WHERE id = $1", id)
+	return err
+}
+
+// MemoryJobStore keeps jobs in process for the Lite profile.
+type MemoryJobStore struct {
+	mu   sync.RWMutex
+	jobs map[string]Job
+}
+
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{jobs: make(map[string]Job)}
+}
+
+func (s *MemoryJobStore) Create(ctx context.Context, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.jobs[job.ID]; exists {
+		return fmt.Errorf("job %s already exists", job.ID)
+	}
+	job.Status = "PENDING"
+	job.CreatedAt = time.Now()
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *MemoryJobStore) MarkFailed(ctx context.Context, id string) error {
+	return s.setStatus(id, "FAILED")
+}
+
+func (s *MemoryJobStore) Cancel(ctx context.Context, id string) error {
+	return s.setStatus(id, "CANCELLED")
+}
+
+func (s *MemoryJobStore) Get(id string) (Job, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	return job, ok
+}
+
+func (s *MemoryJobStore) setStatus(id, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return fmt.Errorf("job %s not found", id)
+	}
+	job.Status = status
+	s.jobs[id] = job
+	return nil
+}
@@ -4,15 +4,21 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 	pb "github.com/oranjParker/Rarefactor/generated/protos/v1"
 	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/frontier"
+	"github.com/oranjParker/Rarefactor/internal/logging"
+	"github.com/oranjParker/Rarefactor/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type DBExecutor interface {
@@ -22,19 +28,25 @@ type DBExecutor interface {
 }
 
 type JetStreamPublisher interface {
-	Publish(ctx context.Context, subj string, data []byte, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error)
+	PublishMsg(ctx context.Context, msg *nats.Msg, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error)
 }
 
 type CrawlerService struct {
 	pb.UnimplementedCrawlerServiceServer
-	db   DBExecutor
+	jobs JobStore
 	nats JetStreamPublisher
+	// Subject and Shards must match the discovery workers' nats.jobs_subject
+	// and nats.job_shards.
+	Subject string
+	Shards  int
 }
 
-func NewCrawlerService(db DBExecutor, nats JetStreamPublisher) *CrawlerService {
+func NewCrawlerService(jobs JobStore, nats JetStreamPublisher) *CrawlerService {
 	return &CrawlerService{
-		db:   db,
-		nats: nats,
+		jobs:    jobs,
+		nats:    nats,
+		Subject: frontier.DefaultSubject,
+		Shards:  frontier.DefaultShards,
 	}
 }
 
@@ -44,14 +56,25 @@ func (s *CrawlerService) Crawl(ctx context.Context, req *pb.CrawlRequest) (*pb.C
 	}
 
 	jobID := uuid.New().String()
-
-	query := `
-		INSERT INTO crawl_jobs (id, seed_url, max_depth, crawl_mode, namespace, status, created_at)
-		VALUES ($1, $2, $3, $4, $5, 'PENDING', NOW())
-	`
-	_, err := s.db.Exec(ctx, query, jobID, req.SeedUrl, req.MaxDepth, req.CrawlMode, "test")
+	namespace := "test"
+
+	ctx, span := tracing.Tracer().Start(ctx, "Crawl", trace.WithAttributes(
+		attribute.String("job_id", jobID),
+		attribute.String("seed_url", req.SeedUrl),
+	))
+	defer span.End()
+
+	err := s.jobs.Create(ctx, Job{
+		ID:        jobID,
+		SeedURL:   req.SeedUrl,
+		MaxDepth:  req.MaxDepth,
+		CrawlMode: req.CrawlMode,
+		Namespace: namespace,
+	})
 	if err != nil {
-		log.Printf("[API] Failed to persist job: %v", err)
+		logging.FromContext(ctx).Error("failed to persist job", "job_id", jobID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "persist failed")
 		return nil, fmt.Errorf("internal database error")
 	}
 
@@ -62,8 +85,10 @@ func (s *CrawlerService) Crawl(ctx context.Context, req *pb.CrawlRequest) (*pb.C
 		CreatedAt: time.Now(),
 		Metadata: map[string]any{
 			"job_id":    jobID,
+			"namespace": namespace,
 			"max_depth": req.MaxDepth,
 			"mode":      req.CrawlMode,
+			"priority":  req.Priority,
 		},
 	}
 
@@ -72,12 +97,17 @@ func (s *CrawlerService) Crawl(ctx context.Context, req *pb.CrawlRequest) (*pb.C
 		return nil, fmt.Errorf("failed to marshal job payload: %w", err)
 	}
 
-	if _, err := s.nats.Publish(ctx, "crawl.jobs", payload); err != nil {
-		_, _ = s.db.Exec(ctx, "UPDATE crawl_jobs SET status = 'FAILED' WHERE id = $1", jobID)
+	msg := &nats.Msg{Subject: frontier.SubjectFor(s.Subject, s.Shards)(seedDoc), Data: payload, Header: nats.Header{}}
+	tracing.Inject(ctx, msg.Header)
+
+	if _, err := s.nats.PublishMsg(ctx, msg); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "queue failed")
+		_ = s.jobs.MarkFailed(ctx, jobID)
 		return nil, fmt.Errorf("failed to queue job: %w", err)
 	}
 
-	log.Printf("[API] Job Queued: %s -> %s", jobID, req.SeedUrl)
+	logging.FromContext(ctx).Info("job queued", "job_id", jobID, "seed_url", req.SeedUrl)
 
 	return &pb.CrawlResponse{
 		JobId:  jobID,
@@ -86,8 +116,7 @@ func (s *CrawlerService) Crawl(ctx context.Context, req *pb.CrawlRequest) (*pb.C
 }
 
 func (s *CrawlerService) CancelJob(ctx context.Context, req *pb.CancelJobRequest) (*pb.CancelJobResponse, error) {
-	_, err := s.db.Exec(ctx, "UPDATE crawl_jobs SET status = 'CANCELLED' WHERE id = $1", req.JobId)
-	if err != nil {
+	if err := s.jobs.Cancel(ctx, req.JobId); err != nil {
 		return nil, fmt.Errorf("failed to cancel job: %w", err)
 	}
 
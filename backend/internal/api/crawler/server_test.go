@@ -7,21 +7,29 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 	pb "github.com/oranjParker/Rarefactor/generated/protos/v1"
 	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/frontier"
 	"github.com/pashagolub/pgxmock/v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 type mockJetStream struct {
 	jetstream.JetStream
 	publishedSubject string
 	publishedData    []byte
+	publishedHeader  nats.Header
 }
 
-func (m *mockJetStream) Publish(ctx context.Context, subj string, data []byte, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
-	m.publishedSubject = subj
-	m.publishedData = data
+func (m *mockJetStream) PublishMsg(ctx context.Context, msg *nats.Msg, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+	m.publishedSubject = msg.Subject
+	m.publishedData = msg.Data
+	m.publishedHeader = msg.Header
 	return &jetstream.PubAck{Sequence: 1, Stream: "CRAWL_JOBS"}, nil
 }
 
@@ -34,8 +42,9 @@ func TestCrawl_Success(t *testing.T) {
 
 	jsMock := &mockJetStream{}
 	service := &CrawlerService{
-		db:   mockDB,
-		nats: jsMock,
+		jobs:    NewPostgresJobStore(mockDB),
+		nats:    jsMock,
+		Subject: frontier.DefaultSubject,
 	}
 
 	seedURL := "https://rarefactor.io"
@@ -58,8 +67,8 @@ func TestCrawl_Success(t *testing.T) {
 		t.Errorf("Unexpected response: %+v", resp)
 	}
 
-	if jsMock.publishedSubject != "crawl.jobs" {
-		t.Errorf("Expected subject crawl.jobs, got %s", jsMock.publishedSubject)
+	if jsMock.publishedSubject != "crawl.jobs.p1.0" {
+		t.Errorf("Expected seed on the default priority subject crawl.jobs.p1.0, got %s", jsMock.publishedSubject)
 	}
 
 	var doc core.Document[string]
@@ -70,6 +79,9 @@ func TestCrawl_Success(t *testing.T) {
 	if doc.ID != seedURL {
 		t.Errorf("Expected URL %s in payload, got %s", seedURL, doc.ID)
 	}
+	if doc.Metadata["namespace"] != "test" {
+		t.Errorf("Expected the job namespace in the seed metadata, got %v", doc.Metadata["namespace"])
+	}
 
 	if err := mockDB.ExpectationsWereMet(); err != nil {
 		t.Errorf("Unmet DB expectations: %v", err)
@@ -84,7 +96,7 @@ func TestCrawl_Validation(t *testing.T) {
 	defer mock.Close()
 
 	service := &CrawlerService{
-		db:   mock,
+		jobs: NewPostgresJobStore(mock),
 		nats: nil,
 	}
 
@@ -105,7 +117,7 @@ func TestCancelJob_Success(t *testing.T) {
 	defer mockDB.Close()
 
 	service := &CrawlerService{
-		db:   mockDB,
+		jobs: NewPostgresJobStore(mockDB),
 		nats: nil,
 	}
 
@@ -138,7 +150,7 @@ func TestCancelJob_Failure(t *testing.T) {
 	defer mockDB.Close()
 
 	service := &CrawlerService{
-		db:   mockDB,
+		jobs: NewPostgresJobStore(mockDB),
 		nats: nil,
 	}
 
@@ -162,7 +174,7 @@ func TestCancelJob_Failure(t *testing.T) {
 func TestCrawl_DBFailure(t *testing.T) {
 	mockDB, _ := pgxmock.NewPool()
 	defer mockDB.Close()
-	service := &CrawlerService{db: mockDB, nats: &mockJetStream{}}
+	service := &CrawlerService{jobs: NewPostgresJobStore(mockDB), nats: &mockJetStream{}}
 
 	mockDB.ExpectExec("INSERT INTO crawl_jobs").
 		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
@@ -178,7 +190,7 @@ func TestCrawl_NatsFailure(t *testing.T) {
 	mockDB, _ := pgxmock.NewPool()
 	defer mockDB.Close()
 	jsMock := &mockJetStreamFail{}
-	service := &CrawlerService{db: mockDB, nats: jsMock}
+	service := &CrawlerService{jobs: NewPostgresJobStore(mockDB), nats: jsMock}
 
 	mockDB.ExpectExec("INSERT INTO crawl_jobs").
 		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
@@ -205,7 +217,7 @@ func TestCrawl_NatsFailure_DBUpdateFailure(t *testing.T) {
 	mockDB, _ := pgxmock.NewPool()
 	defer mockDB.Close()
 	jsMock := &mockJetStreamFail{}
-	service := &CrawlerService{db: mockDB, nats: jsMock}
+	service := &CrawlerService{jobs: NewPostgresJobStore(mockDB), nats: jsMock}
 
 	mockDB.ExpectExec("INSERT INTO crawl_jobs").
 		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
@@ -229,6 +241,85 @@ type mockJetStreamFail struct {
 	jetstream.JetStream
 }
 
-func (m *mockJetStreamFail) Publish(ctx context.Context, subj string, data []byte, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+func (m *mockJetStreamFail) PublishMsg(ctx context.Context, msg *nats.Msg, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
 	return nil, fmt.Errorf("nats error")
 }
+
+func TestCrawl_PropagatesTraceContext(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetTextMapPropagator(prevProp)
+	}()
+
+	mockDB, _ := pgxmock.NewPool()
+	defer mockDB.Close()
+	jsMock := &mockJetStream{}
+	service := &CrawlerService{jobs: NewPostgresJobStore(mockDB), nats: jsMock}
+
+	mockDB.ExpectExec("INSERT INTO crawl_jobs").
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	if _, err := service.Crawl(context.Background(), &pb.CrawlRequest{SeedUrl: "http://test.com"}); err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "Crawl" {
+		t.Fatalf("expected a single Crawl span, got %v", spans)
+	}
+
+	traceparent := propagation.HeaderCarrier(jsMock.publishedHeader).Get("traceparent")
+	if !strings.Contains(traceparent, spans[0].SpanContext.TraceID().String()) {
+		t.Errorf("expected published headers to carry trace %s, got %q", spans[0].SpanContext.TraceID(), traceparent)
+	}
+}
+
+func TestCrawl_MemoryJobStore(t *testing.T) {
+	jobs := NewMemoryJobStore()
+	service := NewCrawlerService(jobs, &mockJetStream{})
+
+	resp, err := service.Crawl(context.Background(), &pb.CrawlRequest{SeedUrl: "http://test.com", MaxDepth: 1})
+	if err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+	if job, ok := jobs.Get(resp.JobId); !ok || job.Status != "PENDING" || job.SeedURL != "http://test.com" {
+		t.Fatalf("expected a pending job to be recorded, got %+v", job)
+	}
+
+	if _, err := service.CancelJob(context.Background(), &pb.CancelJobRequest{JobId: resp.JobId}); err != nil {
+		t.Fatalf("CancelJob failed: %v", err)
+	}
+	if job, _ := jobs.Get(resp.JobId); job.Status != "CANCELLED" {
+		t.Errorf("expected job to be cancelled, got %s", job.Status)
+	}
+
+	if _, err := service.CancelJob(context.Background(), &pb.CancelJobRequest{JobId: "missing"}); err == nil {
+		t.Error("expected an error cancelling an unknown job")
+	}
+}
+
+func TestCrawl_PrioritySubject(t *testing.T) {
+	jsMock := &mockJetStream{}
+	service := NewCrawlerService(NewMemoryJobStore(), jsMock)
+	service.Subject, service.Shards = "tenant.jobs", 4
+
+	if _, err := service.Crawl(context.Background(), &pb.CrawlRequest{SeedUrl: "http://test.com", Priority: 2}); err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+	if want := frontier.Subject("tenant.jobs", 0, frontier.Shard("http://test.com", 4)); jsMock.publishedSubject != want {
+		t.Errorf("expected a high priority seed on %s, got %s", want, jsMock.publishedSubject)
+	}
+
+	var doc core.Document[string]
+	if err := json.Unmarshal(jsMock.publishedData, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Metadata["priority"] != float64(2) {
+		t.Errorf("expected job priority to ride along with the seed, got %v", doc.Metadata["priority"])
+	}
+}
@@ -0,0 +1,124 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/oranjParker/Rarefactor/internal/database"
+	"github.com/oranjParker/Rarefactor/internal/logging"
+)
+
+const (
+	defaultLimit = 10
+	maxLimit     = 100
+)
+
+type Index interface {
+	Search(ctx context.Context, collection string, vector []float32, limit int, filter database.SearchFilter) ([]database.ScoredPoint, error)
+}
+
+// Result and Response mirror the protos.v1.SearchResponse JSON served by the
+// gateway at /v1/search, plus the page each chunk belongs to.
+type Result struct {
+	URL     string  `json:"url"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"`
+	Score   float32 `json:"score"`
+	PageURL string  `json:"page_url,omitempty"`
+}
+
+type Response struct {
+	Results    []Result `json:"results"`
+	TotalHits  int32    `json:"total_hits"`
+	DurationMs float64  `json:"duration_ms"`
+}
+
+// NewHandler serves GET /v1/search?query=...&limit=... straight from a vector
+// index, embedding the query with the same function used at index time.
+// namespace, domain, job_id, language, page_url, crawled_after and
+// crawled_before (RFC 3339) narrow the results.
+func NewHandler(index Index, collection string, embed func(ctx context.Context, text string) ([]float32, error)) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/search", func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+
+		query := r.URL.Query().Get("query")
+		if query == "" {
+			http.Error(w, "query is required", http.StatusBadRequest)
+			return
+		}
+
+		limit := defaultLimit
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, maxLimit)
+		}
+
+		filter, err := parseFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		vector, err := embed(r.Context(), query)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("query embedding failed", "component", "search", "error", err)
+			http.Error(w, "embedding unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		points, err := index.Search(r.Context(), collection, vector, limit, filter)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("search failed", "component", "search", "error", err)
+			http.Error(w, "search failed", http.StatusInternalServerError)
+			return
+		}
+
+		resp := Response{Results: make([]Result, 0, len(points)), TotalHits: int32(len(points))}
+		for _, p := range points {
+			resp.Results = append(resp.Results, Result{URL: p.URL, Title: p.Title, Snippet: p.Snippet, Score: p.Score, PageURL: p.PageURL})
+		}
+		resp.DurationMs = float64(time.Since(started).Microseconds()) / 1000
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+	return mux
+}
+
+func parseFilter(q url.Values) (database.SearchFilter, error) {
+	filter := database.SearchFilter{
+		Namespace: q.Get("namespace"),
+		Domain:    q.Get("domain"),
+		JobID:     q.Get("job_id"),
+		Language:  q.Get("language"),
+		PageURL:   q.Get("page_url"),
+	}
+	for _, bound := range []struct {
+		param string
+		dst   *time.Time
+	}{
+		{"crawled_after", &filter.CrawledAfter},
+		{"crawled_before", &filter.CrawledBefore},
+	} {
+		raw := q.Get(bound.param)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be an RFC 3339 time", bound.param)
+		}
+		*bound.dst = t
+	}
+	return filter, nil
+}
@@ -0,0 +1,96 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oranjParker/Rarefactor/internal/database"
+	"github.com/oranjParker/Rarefactor/internal/processor"
+)
+
+func hashEmbed(ctx context.Context, text string) ([]float32, error) {
+	return processor.HashEmbed(text, 128), nil
+}
+
+func TestHandler_RanksByVectorSimilarity(t *testing.T) {
+	index := database.NewMemoryVectorIndex()
+	_ = index.UpsertBatch(context.Background(), "documents", []database.QdrantPoint{
+		{URL: "https://a.example/gardening", Title: "Gardening", Vector: processor.HashEmbed("tomato soil compost watering", 128)},
+		{URL: "https://b.example/golang", Title: "Go", Vector: processor.HashEmbed("golang goroutines channels concurrency", 128)},
+	})
+
+	h := NewHandler(index, "documents", hashEmbed)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/search?query=goroutines+and+channels&limit=1", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp Response
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if resp.TotalHits != 1 || resp.Results[0].URL != "https://b.example/golang" {
+		t.Errorf("expected the golang page as the single hit, got %+v", resp)
+	}
+}
+
+func TestHandler_FiltersByPayload(t *testing.T) {
+	index := database.NewMemoryVectorIndex()
+	_ = index.UpsertBatch(context.Background(), "documents", []database.QdrantPoint{
+		{URL: "https://a.example/go#chunk0", PageURL: "https://a.example/go", Namespace: "blog", Vector: processor.HashEmbed("golang goroutines", 128)},
+		{URL: "https://b.example/go#chunk0", PageURL: "https://b.example/go", Namespace: "docs", Vector: processor.HashEmbed("golang channels", 128)},
+	})
+
+	rec := httptest.NewRecorder()
+	NewHandler(index, "documents", hashEmbed).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/search?query=golang&namespace=docs", nil))
+
+	var resp Response
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if resp.TotalHits != 1 || resp.Results[0].PageURL != "https://b.example/go" {
+		t.Errorf("expected only the docs chunk with its page, got %+v", resp)
+	}
+}
+
+func TestHandler_Validation(t *testing.T) {
+	h := NewHandler(database.NewMemoryVectorIndex(), "documents", hashEmbed)
+
+	for _, target := range []string{"/v1/search", "/v1/search?query=x&limit=0", "/v1/search?query=x&limit=abc", "/v1/search?query=x&crawled_after=yesterday"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, rec.Code)
+		}
+	}
+}
+
+func TestHandler_RefusesMismatchedEmbedding(t *testing.T) {
+	index := database.NewMemoryVectorIndex()
+	ctx := context.Background()
+	if err := index.UpsertBatch(ctx, "documents", []database.QdrantPoint{
+		{URL: "https://a.example/", Model: "hashing-128", Vector: processor.HashEmbed("tomato soil", 128)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	err := index.UpsertBatch(ctx, "documents", []database.QdrantPoint{
+		{URL: "https://b.example/", Model: "other-model", Vector: processor.HashEmbed("golang", 128)},
+	})
+	if !errors.Is(err, database.ErrEmbeddingMismatch) {
+		t.Errorf("expected a second model to be refused, got %v", err)
+	}
+
+	small := func(ctx context.Context, text string) ([]float32, error) {
+		return processor.HashEmbed(text, 64), nil
+	}
+	rec := httptest.NewRecorder()
+	NewHandler(index, "documents", small).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/search?query=tomato", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected a query of the wrong size to fail, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,429 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// Config is the full worker configuration. Values are resolved in order:
+// defaults, the YAML file named by -config or CONFIG_FILE, environment
+// variables (env tags) and finally command line flags, named after the YAML
+// path (e.g. -discovery.concurrency=8).
+type Config struct {
+	Log        Log        `yaml:"log"`
+	Server     Server     `yaml:"server"`
+	Tracing    Tracing    `yaml:"tracing"`
+	Postgres   Postgres   `yaml:"postgres"`
+	Redis      Redis      `yaml:"redis"`
+	NATS       NATS       `yaml:"nats"`
+	Qdrant     Qdrant     `yaml:"qdrant"`
+	LLM        LLM        `yaml:"llm"`
+	Embedding  Embedding  `yaml:"embedding"`
+	Discovery  Discovery  `yaml:"discovery"`
+	Enrichment Enrichment `yaml:"enrichment"`
+	Lite       Lite       `yaml:"lite"`
+}
+
+type Log struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL"`
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
+
+type Server struct {
+	GRPCAddr    string `yaml:"grpc_addr" env:"GRPC_ADDR"`
+	MetricsAddr string `yaml:"metrics_addr" env:"METRICS_ADDR"`
+	HealthAddr  string `yaml:"health_addr" env:"HEALTH_ADDR"`
+}
+
+type Tracing struct {
+	OTLPEndpoint string `yaml:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+}
+
+type Postgres struct {
+	URL           string        `yaml:"url" env:"DATABASE_URL"`
+	MaxConns      int32         `yaml:"max_conns" env:"POSTGRES_MAX_CONNS"`
+	MinConns      int32         `yaml:"min_conns" env:"POSTGRES_MIN_CONNS"`
+	BatchSize     int           `yaml:"batch_size" env:"POSTGRES_BATCH_SIZE"`
+	FlushInterval time.Duration `yaml:"flush_interval" env:"POSTGRES_FLUSH_INTERVAL"`
+	// MaxBuffered caps documents queued or in flight in the sink; writers
+	// block beyond it.
+	MaxBuffered int `yaml:"max_buffered" env:"POSTGRES_MAX_BUFFERED"`
+	// Ingest is "batch" (one upsert per document) or "copy" (COPY into a
+	// staging table and one merge per flush).
+	Ingest string `yaml:"ingest" env:"POSTGRES_INGEST"`
+}
+
+type Redis struct {
+	URL          string `yaml:"url" env:"REDIS_URL"`
+	PoolSize     int    `yaml:"pool_size" env:"REDIS_POOL_SIZE"`
+	MinIdleConns int    `yaml:"min_idle_conns" env:"REDIS_MIN_IDLE_CONNS"`
+}
+
+// NATS describes the JetStream topology. The frontier stream keeps the
+// historical CRAWL_JOBS name so existing deployments are narrowed in place.
+type NATS struct {
+	URL               string `yaml:"url" env:"NATS_URL"`
+	FrontierStream    string `yaml:"frontier_stream" env:"NATS_FRONTIER_STREAM"`
+	EnrichmentStream  string `yaml:"enrichment_stream" env:"NATS_ENRICHMENT_STREAM"`
+	ControlStream     string `yaml:"control_stream" env:"NATS_CONTROL_STREAM"`
+	DLQStream         string `yaml:"dlq_stream" env:"NATS_DLQ_STREAM"`
+	JobsSubject       string `yaml:"jobs_subject" env:"NATS_JOBS_SUBJECT"`
+	EnrichmentSubject string `yaml:"enrichment_subject" env:"NATS_ENRICHMENT_SUBJECT"`
+	ControlSubject    string `yaml:"control_subject" env:"NATS_CONTROL_SUBJECT"`
+	DLQSubject        string `yaml:"dlq_subject" env:"NATS_DLQ_SUBJECT"`
+	// JobShards partitions each frontier priority level by host hash.
+	JobShards int `yaml:"job_shards" env:"NATS_JOB_SHARDS"`
+
+	// Work stream limits. With discard_new a full stream rejects publishes
+	// instead of silently dropping the oldest queued work.
+	MaxMsgs    int64 `yaml:"max_msgs" env:"NATS_MAX_MSGS"`
+	MaxBytes   int64 `yaml:"max_bytes" env:"NATS_MAX_BYTES"`
+	DiscardNew bool  `yaml:"discard_new" env:"NATS_DISCARD_NEW"`
+	// DuplicateWindow is how long work streams remember Nats-Msg-Id values.
+	DuplicateWindow time.Duration `yaml:"duplicate_window" env:"NATS_DUPLICATE_WINDOW"`
+
+	// Consumer limits. A message failing its max_deliver-th delivery is moved
+	// to the DLQ stream. Pending messages are heartbeated every ack_wait/3.
+	MaxDeliver    int           `yaml:"max_deliver" env:"NATS_MAX_DELIVER"`
+	AckWait       time.Duration `yaml:"ack_wait" env:"NATS_ACK_WAIT"`
+	MaxAckPending int           `yaml:"max_ack_pending" env:"NATS_MAX_ACK_PENDING"`
+}
+
+type Qdrant struct {
+	URL        string `yaml:"url" env:"QDRANT_URL"`
+	Collection string `yaml:"collection" env:"QDRANT_COLLECTION"`
+	VectorSize uint64 `yaml:"vector_size" env:"QDRANT_VECTOR_SIZE"`
+}
+
+type LLM struct {
+	GeminiAPIKey string `yaml:"gemini_api_key" env:"GEMINI_API_KEY"`
+	OllamaURL    string `yaml:"ollama_url" env:"OLLAMA_URL"`
+	OllamaModel  string `yaml:"ollama_model" env:"OLLAMA_MODEL"`
+}
+
+type Embedding struct {
+	URL string `yaml:"url" env:"EMBEDDING_URL"`
+	// Model is requested from the embedding service. Changing it needs a
+	// reindex (cmd/reindex): vectors from different models do not compare.
+	Model     string        `yaml:"model" env:"EMBEDDING_MODEL"`
+	BatchSize int           `yaml:"batch_size" env:"EMBEDDING_BATCH_SIZE"`
+	BatchWait time.Duration `yaml:"batch_wait" env:"EMBEDDING_BATCH_WAIT"`
+}
+
+type Discovery struct {
+	Concurrency       int           `yaml:"concurrency" env:"DISCOVERY_CONCURRENCY"`
+	UserAgent         string        `yaml:"user_agent" env:"CRAWLER_USER_AGENT"`
+	MaxDepth          int           `yaml:"max_depth" env:"CRAWL_MAX_DEPTH"`
+	MaxPages          int           `yaml:"max_pages" env:"CRAWL_MAX_PAGES"`
+	ChunkSize         int           `yaml:"chunk_size" env:"CHUNK_SIZE"`
+	ChunkOverlap      int           `yaml:"chunk_overlap" env:"CHUNK_OVERLAP"`
+	StrictSecurity    bool          `yaml:"strict_security" env:"STRICT_SECURITY"`
+	PolitenessTimeout time.Duration `yaml:"politeness_timeout" env:"POLITENESS_TIMEOUT"`
+	CrawlTimeout      time.Duration `yaml:"crawl_timeout" env:"CRAWL_TIMEOUT"`
+}
+
+type Enrichment struct {
+	Concurrency      int           `yaml:"concurrency" env:"ENRICHMENT_CONCURRENCY"`
+	MetadataTimeout  time.Duration `yaml:"metadata_timeout" env:"METADATA_TIMEOUT"`
+	EmbeddingTimeout time.Duration `yaml:"embedding_timeout" env:"EMBEDDING_TIMEOUT"`
+	QdrantBatchSize  int           `yaml:"qdrant_batch_size" env:"QDRANT_BATCH_SIZE"`
+	QdrantBatchWait  time.Duration `yaml:"qdrant_batch_wait" env:"QDRANT_BATCH_WAIT"`
+	// BackfillMinAge is how long a chunk must have sat PENDING or FAILED
+	// before cmd/backfill re-enqueues it; BackfillLimit caps one run, zero
+	// meaning no cap.
+	BackfillMinAge time.Duration `yaml:"backfill_min_age" env:"BACKFILL_MIN_AGE"`
+	BackfillLimit  int           `yaml:"backfill_limit" env:"BACKFILL_LIMIT"`
+}
+
+// Lite configures the single-binary profile (cmd/lite). An empty data_dir
+// keeps JetStream files in a temporary directory; frontier selects where
+// politeness state lives, "memory" or "redis".
+type Lite struct {
+	DataDir    string `yaml:"data_dir" env:"LITE_DATA_DIR"`
+	Frontier   string `yaml:"frontier" env:"LITE_FRONTIER"`
+	SearchAddr string `yaml:"search_addr" env:"LITE_SEARCH_ADDR"`
+}
+
+func Default() *Config {
+	return &Config{
+		Log:    Log{Level: "info", Format: "json"},
+		Server: Server{GRPCAddr: ":50051", MetricsAddr: ":9090", HealthAddr: ":8081"},
+		Postgres: Postgres{
+			MaxConns:      20,
+			MinConns:      5,
+			BatchSize:     50,
+			FlushInterval: 5 * time.Second,
+			MaxBuffered:   500,
+			Ingest:        "batch",
+		},
+		Redis: Redis{URL: "redis://localhost:6379", PoolSize: 20, MinIdleConns: 5},
+		NATS: NATS{
+			URL:               "nats://127.0.0.1:4222",
+			FrontierStream:    "CRAWL_JOBS",
+			EnrichmentStream:  "CRAWL_ENRICHMENT",
+			ControlStream:     "CRAWL_CONTROL",
+			DLQStream:         "CRAWL_DLQ",
+			JobsSubject:       "crawl.jobs",
+			EnrichmentSubject: "crawl.enrichment",
+			ControlSubject:    "crawl.control",
+			DLQSubject:        "crawl.dlq",
+			JobShards:         8,
+			MaxMsgs:           1000000,
+			MaxBytes:          10 * 1024 * 1024 * 1024,
+			DiscardNew:        true,
+			DuplicateWindow:   2 * time.Minute,
+			MaxDeliver:        10,
+			AckWait:           2 * time.Minute,
+			MaxAckPending:     1000,
+		},
+		Qdrant:    Qdrant{URL: "localhost:6334", Collection: "documents", VectorSize: 768},
+		LLM:       LLM{OllamaModel: "mistral"},
+		Embedding: Embedding{Model: "nomic-ai/nomic-embed-text-v1.5", BatchSize: 32, BatchWait: 50 * time.Millisecond},
+		Discovery: Discovery{
+			Concurrency:       5,
+			UserAgent:         "RarefactorBot/2.0",
+			MaxDepth:          3,
+			MaxPages:          1000,
+			ChunkSize:         4000,
+			ChunkOverlap:      400,
+			PolitenessTimeout: 15 * time.Second,
+			CrawlTimeout:      90 * time.Second,
+		},
+		Enrichment: Enrichment{
+			Concurrency:      3,
+			MetadataTimeout:  120 * time.Second,
+			EmbeddingTimeout: 30 * time.Second,
+			QdrantBatchSize:  64,
+			QdrantBatchWait:  100 * time.Millisecond,
+			BackfillMinAge:   10 * time.Minute,
+		},
+		Lite: Lite{Frontier: "memory", SearchAddr: ":8080"},
+	}
+}
+
+// Load resolves the configuration for a binary invoked with args.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("rarefactor", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	overrides := map[string]*override{}
+	walk(reflect.ValueOf(cfg).Elem(), "", func(name, _ string, v reflect.Value) {
+		o := &override{isBool: v.Kind() == reflect.Bool}
+		overrides[name] = o
+		fs.Var(o, name, fmt.Sprintf("override %s (default %v)", name, v.Interface()))
+	})
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *path != "" {
+		data, err := os.ReadFile(*path)
+		if err != nil {
+			return nil, fmt.Errorf("read config file: %w", err)
+		}
+		if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+			return nil, fmt.Errorf("parse config file %s: %w", *path, err)
+		}
+	}
+
+	var errs []error
+	walk(reflect.ValueOf(cfg).Elem(), "", func(name, env string, v reflect.Value) {
+		if env == "" {
+			return
+		}
+		if raw, ok := os.LookupEnv(env); ok && raw != "" {
+			if err := set(v, raw); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", env, err))
+			}
+		}
+	})
+	fs.Visit(func(f *flag.Flag) {
+		raw, ok := overrides[f.Name]
+		if !ok {
+			return
+		}
+		walk(reflect.ValueOf(cfg).Elem(), "", func(name, _ string, v reflect.Value) {
+			if name == f.Name {
+				if err := set(v, raw.raw); err != nil {
+					errs = append(errs, fmt.Errorf("-%s: %w", f.Name, err))
+				}
+			}
+		})
+	})
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+	positive := func(name string, v int64) {
+		if v <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %d", name, v))
+		}
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "warning", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level %q is not one of debug, info, warn, error", c.Log.Level))
+	}
+	switch strings.ToLower(c.Log.Format) {
+	case "json", "text":
+	default:
+		errs = append(errs, fmt.Errorf("log.format %q is not one of json, text", c.Log.Format))
+	}
+
+	positive("postgres.max_conns", int64(c.Postgres.MaxConns))
+	if c.Postgres.MinConns < 0 || c.Postgres.MinConns > c.Postgres.MaxConns {
+		errs = append(errs, fmt.Errorf("postgres.min_conns must be between 0 and max_conns"))
+	}
+	positive("postgres.batch_size", int64(c.Postgres.BatchSize))
+	positive("postgres.flush_interval", int64(c.Postgres.FlushInterval))
+	if c.Postgres.MaxBuffered < c.Postgres.BatchSize {
+		errs = append(errs, fmt.Errorf("postgres.max_buffered must be at least batch_size (%d), got %d", c.Postgres.BatchSize, c.Postgres.MaxBuffered))
+	}
+	if c.Postgres.Ingest != "batch" && c.Postgres.Ingest != "copy" {
+		errs = append(errs, fmt.Errorf("postgres.ingest must be batch or copy, got %q", c.Postgres.Ingest))
+	}
+	positive("redis.pool_size", int64(c.Redis.PoolSize))
+	positive("nats.job_shards", int64(c.NATS.JobShards))
+	if c.NATS.FrontierStream == "" || c.NATS.EnrichmentStream == "" || c.NATS.ControlStream == "" || c.NATS.DLQStream == "" {
+		errs = append(errs, errors.New("nats stream names must be set"))
+	}
+	if c.NATS.JobsSubject == "" || c.NATS.EnrichmentSubject == "" || c.NATS.ControlSubject == "" || c.NATS.DLQSubject == "" {
+		errs = append(errs, errors.New("nats subjects must be set"))
+	}
+	positive("nats.max_msgs", c.NATS.MaxMsgs)
+	positive("nats.max_bytes", c.NATS.MaxBytes)
+	positive("nats.duplicate_window", int64(c.NATS.DuplicateWindow))
+	positive("nats.ack_wait", int64(c.NATS.AckWait))
+	positive("nats.max_ack_pending", int64(c.NATS.MaxAckPending))
+	if c.NATS.MaxDeliver == 0 || c.NATS.MaxDeliver < -1 {
+		errs = append(errs, fmt.Errorf("nats.max_deliver must be positive or -1 for unlimited, got %d", c.NATS.MaxDeliver))
+	}
+	if c.Qdrant.Collection == "" {
+		errs = append(errs, errors.New("qdrant.collection must be set"))
+	}
+	positive("qdrant.vector_size", int64(c.Qdrant.VectorSize))
+	if c.Embedding.Model == "" {
+		errs = append(errs, errors.New("embedding.model must be set"))
+	}
+	positive("embedding.batch_size", int64(c.Embedding.BatchSize))
+
+	positive("discovery.concurrency", int64(c.Discovery.Concurrency))
+	if c.Discovery.UserAgent == "" {
+		errs = append(errs, errors.New("discovery.user_agent must be set"))
+	}
+	positive("discovery.max_depth", int64(c.Discovery.MaxDepth))
+	positive("discovery.max_pages", int64(c.Discovery.MaxPages))
+	positive("discovery.chunk_size", int64(c.Discovery.ChunkSize))
+	if c.Discovery.ChunkOverlap < 0 || c.Discovery.ChunkOverlap >= c.Discovery.ChunkSize {
+		errs = append(errs, fmt.Errorf("discovery.chunk_overlap must be between 0 and chunk_size"))
+	}
+
+	positive("enrichment.concurrency", int64(c.Enrichment.Concurrency))
+	positive("enrichment.qdrant_batch_size", int64(c.Enrichment.QdrantBatchSize))
+	if c.Enrichment.BackfillMinAge < 0 || c.Enrichment.BackfillLimit < 0 {
+		errs = append(errs, errors.New("enrichment.backfill_min_age and backfill_limit must not be negative"))
+	}
+
+	switch c.Lite.Frontier {
+	case "memory", "redis":
+	default:
+		errs = append(errs, fmt.Errorf("lite.frontier %q is not one of memory, redis", c.Lite.Frontier))
+	}
+
+	return errors.Join(errs...)
+}
+
+// walk visits every leaf field with its dotted YAML path and env name.
+// override holds a flag's raw value until it is applied over the file and
+// environment. Bool fields take the bare form, so -nats.discard_new means true.
+type override struct {
+	raw    string
+	isBool bool
+}
+
+func (o *override) String() string {
+	if o == nil {
+		return ""
+	}
+	return o.raw
+}
+
+func (o *override) Set(raw string) error {
+	o.raw = raw
+	return nil
+}
+
+func (o *override) IsBoolFlag() bool { return o.isBool }
+
+func walk(v reflect.Value, prefix string, fn func(name, env string, field reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		if f.Type.Kind() == reflect.Struct {
+			walk(v.Field(i), name, fn)
+			continue
+		}
+		fn(name, f.Tag.Get("env"), v.Field(i))
+	}
+}
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+func set(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	default:
+		return fmt.Errorf("unsupported config type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("defaults should be valid: %v", err)
+	}
+	if cfg.Discovery.Concurrency != 5 || cfg.Discovery.UserAgent != "RarefactorBot/2.0" || cfg.Qdrant.Collection != "documents" {
+		t.Errorf("unexpected defaults: %+v", cfg.Discovery)
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	file := `
+discovery:
+  concurrency: 8
+  max_pages: 200
+postgres:
+  flush_interval: 2s
+qdrant:
+  collection: from-file
+`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CRAWL_MAX_PAGES", "300")
+	t.Setenv("QDRANT_COLLECTION", "from-env")
+
+	cfg, err := Load([]string{"-config", path, "-qdrant.collection=from-flag"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Discovery.Concurrency != 8 {
+		t.Errorf("file should override default concurrency, got %d", cfg.Discovery.Concurrency)
+	}
+	if cfg.Postgres.FlushInterval != 2*time.Second {
+		t.Errorf("file should set durations, got %v", cfg.Postgres.FlushInterval)
+	}
+	if cfg.Discovery.MaxPages != 300 {
+		t.Errorf("env should override file, got %d", cfg.Discovery.MaxPages)
+	}
+	if cfg.Qdrant.Collection != "from-flag" {
+		t.Errorf("flag should override env, got %q", cfg.Qdrant.Collection)
+	}
+	if cfg.Discovery.ChunkSize != 4000 {
+		t.Errorf("unset values should keep defaults, got %d", cfg.Discovery.ChunkSize)
+	}
+}
+
+func TestLoad_BoolFlags(t *testing.T) {
+	t.Setenv("NATS_DISCARD_NEW", "false")
+	cfg, err := Load([]string{"-nats.discard_new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.NATS.DiscardNew {
+		t.Error("a bare bool flag should set the field to true")
+	}
+
+	cfg, err = Load([]string{"-nats.discard_new=false"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.NATS.DiscardNew {
+		t.Error("an explicit false should clear the field")
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	t.Run("Unknown file key", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		_ = os.WriteFile(path, []byte("discovery:\n  concurrenci: 3\n"), 0o600)
+		if _, err := Load([]string{"-config", path}); err == nil {
+			t.Error("expected typo in config file to be rejected")
+		}
+	})
+
+	t.Run("Bad env value", func(t *testing.T) {
+		t.Setenv("DISCOVERY_CONCURRENCY", "many")
+		if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "DISCOVERY_CONCURRENCY") {
+			t.Errorf("expected env parse error, got %v", err)
+		}
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		_, err := Load([]string{"-discovery.chunk_overlap=5000", "-log.level=loud"})
+		if err == nil {
+			t.Fatal("expected validation failure")
+		}
+		for _, want := range []string{"chunk_overlap", "log.level"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("expected %q in error: %v", want, err)
+			}
+		}
+	})
+}
+
+func TestConfigExampleIsValid(t *testing.T) {
+	if _, err := Load([]string{"-config", "../../config.example.yaml"}); err != nil {
+		t.Errorf("config.example.yaml should load: %v", err)
+	}
+}
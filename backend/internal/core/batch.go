@@ -0,0 +1,242 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBatchSize = 32
+	DefaultBatchWait = 50 * time.Millisecond
+)
+
+var ErrBatcherClosed = errors.New("batcher closed")
+
+// BatchProcessor handles a slice of inputs in one call. The returned slice must
+// line up with inputs: results[i] holds the outputs produced for inputs[i].
+type BatchProcessor[In any, Out any] interface {
+	ProcessBatch(ctx context.Context, inputs []In) ([][]Out, error)
+}
+
+type BatchSink[T any] interface {
+	WriteBatch(ctx context.Context, items []T) error
+	Close() error
+}
+
+type batchResult[R any] struct {
+	value R
+	err   error
+}
+
+type batchRequest[In any, R any] struct {
+	ctx   context.Context
+	item  In
+	reply chan batchResult[R]
+}
+
+// batcher collects items submitted from concurrent graph workers and hands
+// them to flush once size items are queued or wait has elapsed since the first.
+// Each submitter blocks until its own result is ready, so the item continues
+// down the graph on its original goroutine and CompletionTracker accounting is
+// unchanged.
+type batcher[In any, R any] struct {
+	size     int
+	wait     time.Duration
+	flush    func(ctx context.Context, items []In) ([]R, error)
+	requests chan batchRequest[In, R]
+	done     chan struct{}
+	once     sync.Once
+	wg       sync.WaitGroup
+}
+
+func newBatcher[In any, R any](size int, wait time.Duration, flush func(ctx context.Context, items []In) ([]R, error)) *batcher[In, R] {
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	if wait <= 0 {
+		wait = DefaultBatchWait
+	}
+	b := &batcher[In, R]{
+		size:     size,
+		wait:     wait,
+		flush:    flush,
+		requests: make(chan batchRequest[In, R]),
+		done:     make(chan struct{}),
+	}
+	b.wg.Add(1)
+	go b.loop()
+	return b
+}
+
+func (b *batcher[In, R]) submit(ctx context.Context, item In) (R, error) {
+	var zero R
+	req := batchRequest[In, R]{ctx: ctx, item: item, reply: make(chan batchResult[R], 1)}
+
+	select {
+	case b.requests <- req:
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	case <-b.done:
+		return zero, ErrBatcherClosed
+	}
+
+	select {
+	case res := <-req.reply:
+		return res.value, res.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+func (b *batcher[In, R]) loop() {
+	defer b.wg.Done()
+
+	var pending []batchRequest[In, R]
+	timer := time.NewTimer(b.wait)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case req := <-b.requests:
+			pending = append(pending, req)
+			if len(pending) == 1 {
+				timer.Reset(b.wait)
+			}
+			if len(pending) >= b.size {
+				timer.Stop()
+				b.run(pending)
+				pending = nil
+			}
+		case <-timer.C:
+			b.run(pending)
+			pending = nil
+		case <-b.done:
+			b.run(pending)
+			return
+		}
+	}
+}
+
+func (b *batcher[In, R]) run(pending []batchRequest[In, R]) {
+	if len(pending) == 0 {
+		return
+	}
+
+	items := make([]In, len(pending))
+	for i, req := range pending {
+		items[i] = req.item
+	}
+
+	ctx, cancel := batchContext(pending)
+	defer cancel()
+	results, err := b.safeFlush(ctx, items)
+	var itemErrs ItemErrors
+	if errors.As(err, &itemErrs) {
+		err = nil
+	}
+	if err == nil && len(results) != len(items) {
+		err = fmt.Errorf("batch returned %d results for %d items", len(results), len(items))
+	}
+
+	for i, req := range pending {
+		if err != nil {
+			req.reply <- batchResult[R]{err: err}
+			continue
+		}
+		if itemErr, ok := itemErrs[i]; ok {
+			req.reply <- batchResult[R]{err: itemErr}
+			continue
+		}
+		req.reply <- batchResult[R]{value: results[i]}
+	}
+}
+
+// batchContext is the context a batch runs on. It outlives any single
+// submitter, since one caller timing out or giving up must not fail the
+// items of the others, and ends at the latest submitter deadline. Values
+// such as the logger and trace come from the first submitter.
+func batchContext[In any, R any](pending []batchRequest[In, R]) (context.Context, context.CancelFunc) {
+	var latest time.Time
+	for _, req := range pending {
+		deadline, ok := req.ctx.Deadline()
+		if !ok {
+			return context.WithCancel(context.WithoutCancel(pending[0].ctx))
+		}
+		if deadline.After(latest) {
+			latest = deadline
+		}
+	}
+	return context.WithDeadline(context.WithoutCancel(pending[0].ctx), latest)
+}
+
+func (b *batcher[In, R]) safeFlush(ctx context.Context, items []In) (results []R, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			results, err = nil, &PanicError{Node: "batch", Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return b.flush(ctx, items)
+}
+
+func (b *batcher[In, R]) close() {
+	b.once.Do(func() { close(b.done) })
+	b.wg.Wait()
+}
+
+// BatchingProcessor exposes a BatchProcessor as a regular per-item Processor so
+// it can sit in any graph node.
+type BatchingProcessor[In any, Out any] struct {
+	b *batcher[In, []Out]
+}
+
+func NewBatchingProcessor[In any, Out any](proc BatchProcessor[In, Out], size int, wait time.Duration) *BatchingProcessor[In, Out] {
+	return &BatchingProcessor[In, Out]{
+		b: newBatcher(size, wait, proc.ProcessBatch),
+	}
+}
+
+func (p *BatchingProcessor[In, Out]) Process(ctx context.Context, input In) ([]Out, error) {
+	return p.b.submit(ctx, input)
+}
+
+func (p *BatchingProcessor[In, Out]) Close() error {
+	p.b.close()
+	return nil
+}
+
+// BatchingSink exposes a BatchSink as a regular per-item Sink. Write returns once
+// the batch containing the item has been written. A sink returning ItemErrors
+// fails only the writes of the items it names.
+type BatchingSink[T any] struct {
+	sink BatchSink[T]
+	b    *batcher[T, struct{}]
+}
+
+func NewBatchingSink[T any](sink BatchSink[T], size int, wait time.Duration) *BatchingSink[T] {
+	return &BatchingSink[T]{
+		sink: sink,
+		b: newBatcher(size, wait, func(ctx context.Context, items []T) ([]struct{}, error) {
+			err := sink.WriteBatch(ctx, items)
+			var itemErrs ItemErrors
+			if err != nil && !errors.As(err, &itemErrs) {
+				return nil, err
+			}
+			return make([]struct{}, len(items)), err
+		}),
+	}
+}
+
+func (s *BatchingSink[T]) Write(ctx context.Context, item T) error {
+	_, err := s.b.submit(ctx, item)
+	return err
+}
+
+func (s *BatchingSink[T]) Close() error {
+	s.b.close()
+	return s.sink.Close()
+}
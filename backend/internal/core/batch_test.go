@@ -0,0 +1,260 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockBatchProcessor struct {
+	mu      sync.Mutex
+	batches [][]string
+	err     error
+}
+
+func (p *mockBatchProcessor) ProcessBatch(ctx context.Context, inputs []string) ([][]string, error) {
+	p.mu.Lock()
+	p.batches = append(p.batches, append([]string(nil), inputs...))
+	p.mu.Unlock()
+
+	if p.err != nil {
+		return nil, p.err
+	}
+	out := make([][]string, len(inputs))
+	for i, in := range inputs {
+		out[i] = []string{in + "-batched"}
+	}
+	return out, nil
+}
+
+type mockBatchSink struct {
+	mu      sync.Mutex
+	batches [][]string
+	closed  bool
+}
+
+func (s *mockBatchSink) WriteBatch(ctx context.Context, items []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, append([]string(nil), items...))
+	return nil
+}
+
+func (s *mockBatchSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestBatchingProcessor_FlushOnSize(t *testing.T) {
+	inner := &mockBatchProcessor{}
+	proc := NewBatchingProcessor[string, string](inner, 4, time.Hour)
+	defer proc.Close()
+
+	var wg sync.WaitGroup
+	results := make([]string, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			out, err := proc.Process(context.Background(), fmt.Sprintf("item-%d", i))
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			results[i] = out[0]
+		}(i)
+	}
+	wg.Wait()
+
+	if len(inner.batches) != 1 || len(inner.batches[0]) != 4 {
+		t.Fatalf("expected a single batch of 4, got %v", inner.batches)
+	}
+	for i, r := range results {
+		if r != fmt.Sprintf("item-%d-batched", i) {
+			t.Errorf("result %d routed to wrong caller: %s", i, r)
+		}
+	}
+}
+
+func TestBatchingProcessor_FlushOnTimeout(t *testing.T) {
+	inner := &mockBatchProcessor{}
+	proc := NewBatchingProcessor[string, string](inner, 100, 10*time.Millisecond)
+	defer proc.Close()
+
+	out, err := proc.Process(context.Background(), "lonely")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != "lonely-batched" {
+		t.Errorf("unexpected output: %v", out)
+	}
+}
+
+func TestBatchingProcessor_ErrorFansOut(t *testing.T) {
+	inner := &mockBatchProcessor{err: errors.New("gpu down")}
+	proc := NewBatchingProcessor[string, string](inner, 2, time.Hour)
+	defer proc.Close()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = proc.Process(context.Background(), "x")
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err == nil || err.Error() != "gpu down" {
+			t.Errorf("caller %d expected batch error, got %v", i, err)
+		}
+	}
+}
+
+type blockingBatchProcessor struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingBatchProcessor) ProcessBatch(ctx context.Context, inputs []string) ([][]string, error) {
+	close(p.started)
+	<-p.release
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	out := make([][]string, len(inputs))
+	for i, in := range inputs {
+		out[i] = []string{in + "-batched"}
+	}
+	return out, nil
+}
+
+func TestBatchingProcessor_FirstSubmitterCancelled(t *testing.T) {
+	inner := &blockingBatchProcessor{started: make(chan struct{}), release: make(chan struct{})}
+	proc := NewBatchingProcessor[string, string](inner, 2, time.Hour)
+	defer proc.Close()
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := proc.Process(firstCtx, "first")
+		firstErr <- err
+	}()
+	// Let the first item reach the batcher before the second fills the batch.
+	time.Sleep(20 * time.Millisecond)
+
+	type result struct {
+		out []string
+		err error
+	}
+	second := make(chan result, 1)
+	go func() {
+		out, err := proc.Process(context.Background(), "second")
+		second <- result{out, err}
+	}()
+
+	<-inner.started
+	cancelFirst()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cancelled submitter to give up, got %v", err)
+	}
+	close(inner.release)
+
+	res := <-second
+	if res.err != nil || len(res.out) != 1 || res.out[0] != "second-batched" {
+		t.Errorf("expected the other item to succeed, got %v %v", res.out, res.err)
+	}
+}
+
+type partialBatchSink struct{}
+
+func (s *partialBatchSink) WriteBatch(ctx context.Context, items []string) error {
+	failed := ItemErrors{}
+	for i, item := range items {
+		if item == "bad" {
+			failed[i] = &PermanentError{Err: errors.New("rejected")}
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+func (s *partialBatchSink) Close() error { return nil }
+
+func TestBatchingSink_ItemErrors(t *testing.T) {
+	sink := NewBatchingSink[string](&partialBatchSink{}, 3, time.Hour)
+	defer sink.Close()
+
+	items := []string{"good", "bad", "good"}
+	errs := make([]error, len(items))
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		go func(i int, item string) {
+			defer wg.Done()
+			errs[i] = sink.Write(context.Background(), item)
+		}(i, item)
+	}
+	wg.Wait()
+
+	for i, item := range items {
+		var pe *PermanentError
+		if item == "bad" && !errors.As(errs[i], &pe) {
+			t.Errorf("expected the bad item to get its own error, got %v", errs[i])
+		}
+		if item == "good" && errs[i] != nil {
+			t.Errorf("expected good items to succeed, got %v", errs[i])
+		}
+	}
+}
+
+func TestBatchingProcessor_Closed(t *testing.T) {
+	proc := NewBatchingProcessor[string, string](&mockBatchProcessor{}, 2, time.Hour)
+	_ = proc.Close()
+
+	if _, err := proc.Process(context.Background(), "late"); !errors.Is(err, ErrBatcherClosed) {
+		t.Errorf("expected ErrBatcherClosed, got %v", err)
+	}
+}
+
+func TestBatchingSink_InGraph(t *testing.T) {
+	itemCount := 20
+	items := make([]string, itemCount)
+	for i := range items {
+		items[i] = fmt.Sprintf("data-%d", i)
+	}
+
+	inner := &mockBatchSink{}
+	batched := NewBatchingSink[string](inner, 5, 10*time.Millisecond)
+
+	runner := NewGraphRunner("batch-graph", &mockSource{items: items}, 10)
+	_ = runner.AddProcessor("start", &mockProcessor{})
+	_ = runner.AddSink("end", batched)
+	_ = runner.Connect("start", "end")
+
+	if err := runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	_ = batched.Close()
+
+	total := 0
+	for _, b := range inner.batches {
+		if len(b) > 5 {
+			t.Errorf("batch exceeded max size: %d", len(b))
+		}
+		total += len(b)
+	}
+	if total != itemCount {
+		t.Errorf("expected %d items written, got %d", itemCount, total)
+	}
+	if !inner.closed {
+		t.Error("closing the batching sink should close the wrapped sink")
+	}
+}
@@ -0,0 +1,223 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Gate reports whether a downstream dependency can accept work. Sources block
+// on WaitReady instead of pulling items that would only fail.
+type Gate interface {
+	Ready() bool
+	WaitReady(ctx context.Context) error
+}
+
+// CircuitBreaker trips after FailureThreshold consecutive failures and fails
+// fast for OpenTimeout. It then lets a single probe through (half-open): success
+// closes the circuit, failure re-opens it.
+type CircuitBreaker struct {
+	Name             string
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	// IsFailure decides which errors count against the dependency. Defaults to
+	// everything except PermanentError and context cancellation.
+	IsFailure func(err error) bool
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	// probeAt is when the current probe was let through. A probe still
+	// outstanding after OpenTimeout is presumed lost and another is allowed.
+	probeAt time.Time
+	changed chan struct{}
+	now     func() time.Time
+}
+
+func NewCircuitBreaker(name string, threshold int, openTimeout time.Duration) *CircuitBreaker {
+	if threshold <= 0 {
+		threshold = 5
+	}
+	if openTimeout <= 0 {
+		openTimeout = 30 * time.Second
+	}
+	return &CircuitBreaker{
+		Name:             name,
+		FailureThreshold: threshold,
+		OpenTimeout:      openTimeout,
+		changed:          make(chan struct{}),
+		now:              time.Now,
+	}
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Execute runs fn if the circuit allows it and records the outcome. A panic
+// in fn counts as a failure and is re-raised, so a panicking half-open probe
+// cannot leave the circuit waiting on a probe that will never report back.
+func (b *CircuitBreaker) Execute(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	completed := false
+	defer func() {
+		if !completed {
+			b.record(fmt.Errorf("%s: call panicked", b.Name))
+		}
+	}()
+	err = fn(ctx)
+	completed = true
+	b.record(err)
+	return err
+}
+
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		remaining := b.OpenTimeout - b.now().Sub(b.openedAt)
+		if remaining > 0 {
+			return &RetryableError{Err: fmt.Errorf("%s: %w", b.Name, ErrCircuitOpen), RetryAfter: remaining}
+		}
+		b.transition(BreakerHalfOpen)
+		b.probing, b.probeAt = true, b.now()
+		return nil
+	case BreakerHalfOpen:
+		if wait := b.probeWait(); wait > 0 {
+			return &RetryableError{Err: fmt.Errorf("%s: %w", b.Name, ErrCircuitOpen), RetryAfter: wait}
+		}
+		b.probing, b.probeAt = true, b.now()
+		return nil
+	default:
+		return nil
+	}
+}
+
+func (b *CircuitBreaker) record(err error) {
+	isFailure := b.IsFailure
+	if isFailure == nil {
+		isFailure = defaultBreakerFailure
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil || !isFailure(err) {
+		b.failures = 0
+		b.probing = false
+		if b.state != BreakerClosed {
+			b.transition(BreakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+	b.probing = false
+	if b.state == BreakerHalfOpen || b.failures >= b.FailureThreshold {
+		b.openedAt = b.now()
+		b.transition(BreakerOpen)
+	}
+}
+
+// probeWait is how long until another probe may start while half-open, zero
+// if one may start now. It must be called with mu held.
+func (b *CircuitBreaker) probeWait() time.Duration {
+	if !b.probing {
+		return 0
+	}
+	return max(b.OpenTimeout-b.now().Sub(b.probeAt), 0)
+}
+
+// transition must be called with mu held.
+func (b *CircuitBreaker) transition(to BreakerState) {
+	if b.state == to {
+		return
+	}
+	b.state = to
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// Ready reports whether a call would currently be let through.
+func (b *CircuitBreaker) Ready() bool {
+	ready, _, _ := b.readiness()
+	return ready
+}
+
+// WaitReady blocks until the circuit would let a call through or ctx is done.
+func (b *CircuitBreaker) WaitReady(ctx context.Context) error {
+	for {
+		ready, wait, changed := b.readiness()
+		if ready {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+func (b *CircuitBreaker) readiness() (bool, time.Duration, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		remaining := b.OpenTimeout - b.now().Sub(b.openedAt)
+		if remaining <= 0 {
+			return true, 0, b.changed
+		}
+		return false, remaining, b.changed
+	case BreakerHalfOpen:
+		wait := b.probeWait()
+		return wait == 0, wait, b.changed
+	default:
+		return true, 0, b.changed
+	}
+}
+
+func defaultBreakerFailure(err error) bool {
+	var pe *PermanentError
+	if errors.As(err, &pe) {
+		return false
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, ErrCircuitOpen)
+}
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestBreaker(threshold int, timeout time.Duration) (*CircuitBreaker, *time.Time) {
+	now := time.Now()
+	b := NewCircuitBreaker("test", threshold, timeout)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestCircuitBreaker_Transitions(t *testing.T) {
+	ctx := context.Background()
+	fail := func(ctx context.Context) error { return errors.New("down") }
+	ok := func(ctx context.Context) error { return nil }
+
+	b, now := newTestBreaker(2, 10*time.Second)
+
+	_ = b.Execute(ctx, fail)
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected closed after 1 failure, got %s", b.State())
+	}
+	_ = b.Execute(ctx, fail)
+	if b.State() != BreakerOpen {
+		t.Fatalf("expected open after threshold, got %s", b.State())
+	}
+
+	called := false
+	err := b.Execute(ctx, func(ctx context.Context) error { called = true; return nil })
+	if called || !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected fast failure while open, called=%v err=%v", called, err)
+	}
+	if retry, wait := IsRetryable(err); !retry || wait != 10*time.Second {
+		t.Errorf("open error should be retryable after the remaining cooldown, got %v %v", retry, wait)
+	}
+	if b.Ready() {
+		t.Error("breaker should not be ready while open")
+	}
+
+	*now = now.Add(11 * time.Second)
+	if !b.Ready() {
+		t.Error("breaker should allow a probe after the cooldown")
+	}
+
+	if err := b.Execute(ctx, fail); err == nil || b.State() != BreakerOpen {
+		t.Fatalf("failed probe should re-open the circuit, got %s", b.State())
+	}
+
+	*now = now.Add(11 * time.Second)
+	if err := b.Execute(ctx, ok); err != nil || b.State() != BreakerClosed {
+		t.Fatalf("successful probe should close the circuit, got %s (err=%v)", b.State(), err)
+	}
+}
+
+func TestCircuitBreaker_IgnoresPermanentErrors(t *testing.T) {
+	b, _ := newTestBreaker(1, time.Minute)
+	_ = b.Execute(context.Background(), func(ctx context.Context) error {
+		return &PermanentError{Err: errors.New("bad request")}
+	})
+	if b.State() != BreakerClosed {
+		t.Errorf("permanent errors should not trip the breaker, got %s", b.State())
+	}
+}
+
+func TestCircuitBreaker_SingleProbe(t *testing.T) {
+	b, now := newTestBreaker(1, time.Second)
+	_ = b.Execute(context.Background(), func(ctx context.Context) error { return errors.New("down") })
+	*now = now.Add(2 * time.Second)
+
+	probeStarted := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		_ = b.Execute(context.Background(), func(ctx context.Context) error {
+			close(probeStarted)
+			<-release
+			return nil
+		})
+	}()
+	<-probeStarted
+
+	if err := b.Execute(context.Background(), func(ctx context.Context) error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("only one probe may run while half-open, got %v", err)
+	}
+	close(release)
+}
+
+func TestCircuitBreaker_PanickingProbe(t *testing.T) {
+	b, now := newTestBreaker(1, time.Second)
+	_ = b.Execute(context.Background(), func(ctx context.Context) error { return errors.New("down") })
+	*now = now.Add(2 * time.Second)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected the probe's panic to be re-raised")
+			}
+		}()
+		_ = b.Execute(context.Background(), func(ctx context.Context) error { panic("boom") })
+	}()
+	if b.State() != BreakerOpen {
+		t.Fatalf("expected a panicking probe to re-open the circuit, got %s", b.State())
+	}
+
+	*now = now.Add(2 * time.Second)
+	if err := b.Execute(context.Background(), func(ctx context.Context) error { return nil }); err != nil || b.State() != BreakerClosed {
+		t.Errorf("expected the next probe to close the circuit, got %s (err=%v)", b.State(), err)
+	}
+}
+
+func TestCircuitBreaker_LostProbe(t *testing.T) {
+	b, now := newTestBreaker(1, time.Second)
+	_ = b.Execute(context.Background(), func(ctx context.Context) error { return errors.New("down") })
+	*now = now.Add(2 * time.Second)
+
+	// A probe that never returns must not hold the circuit half-open forever.
+	if err := b.allow(); err != nil {
+		t.Fatal(err)
+	}
+	if b.Ready() {
+		t.Error("expected no second probe while the first is outstanding")
+	}
+	*now = now.Add(2 * time.Second)
+	if !b.Ready() {
+		t.Error("expected another probe once the first outlived OpenTimeout")
+	}
+	if err := b.Execute(context.Background(), func(ctx context.Context) error { return nil }); err != nil || b.State() != BreakerClosed {
+		t.Errorf("expected the replacement probe to close the circuit, got %s (err=%v)", b.State(), err)
+	}
+}
+
+func TestCircuitBreaker_WaitReady(t *testing.T) {
+	b := NewCircuitBreaker("wait", 1, 20*time.Millisecond)
+	_ = b.Execute(context.Background(), func(ctx context.Context) error { return errors.New("down") })
+
+	start := time.Now()
+	if err := b.WaitReady(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 10*time.Millisecond {
+		t.Error("WaitReady returned before the cooldown elapsed")
+	}
+
+	_ = b.Execute(context.Background(), func(ctx context.Context) error { return errors.New("down") })
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := b.WaitReady(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context error, got %v", err)
+	}
+}
@@ -1,11 +1,22 @@
 package core
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/oranjParker/Rarefactor/internal/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 // =========================================================================
@@ -397,3 +408,407 @@ func (s *mockSinkDoc) Write(ctx context.Context, item *Document[string]) error {
 	return s.sink.Write(ctx, item.ID)
 }
 func (s *mockSinkDoc) Close() error { return nil }
+
+func TestGraphRunner_TypedStages(t *testing.T) {
+	src := &mockSource{items: []string{"abc", "hello"}}
+	runner := NewGraphRunner("typed-test", src, 1)
+
+	sink := &mockSink{}
+
+	length, err := AddStage(runner, "start", ProcessorFunc[string, int](func(ctx context.Context, in string) ([]int, error) {
+		return []int{len(in)}, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	format, err := AddStage(runner, "format", ProcessorFunc[int, string](func(ctx context.Context, in int) ([]string, error) {
+		return []string{fmt.Sprintf("len=%d", in)}, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	end, err := AddStageSink[string, string](runner, "end", sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Link(length, format)
+	Link(format, end)
+
+	if err := runner.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	expected := []string{"len=3", "len=5"}
+	if len(sink.received) != len(expected) {
+		t.Fatalf("expected %d items, got %v", len(expected), sink.received)
+	}
+	for i, v := range expected {
+		if sink.received[i] != v {
+			t.Errorf("mismatch at index %d: expected %s, got %s", i, v, sink.received[i])
+		}
+	}
+}
+
+func TestGraphRunner_TypedStageErrors(t *testing.T) {
+	t.Run("Connect Type Mismatch", func(t *testing.T) {
+		runner := NewGraphRunner("mismatch", &mockSource{}, 1)
+		_, _ = AddStage(runner, "start", ProcessorFunc[string, int](func(ctx context.Context, in string) ([]int, error) {
+			return []int{len(in)}, nil
+		}))
+		_ = runner.AddSink("end", &mockSink{})
+
+		err := runner.Connect("start", "end")
+		if err == nil || !strings.Contains(err.Error(), "does not accept") {
+			t.Errorf("expected type mismatch error, got: %v", err)
+		}
+	})
+
+	t.Run("Start Does Not Accept Source", func(t *testing.T) {
+		runner := NewGraphRunner("bad-start", &mockSource{items: []string{"x"}}, 1)
+		_, _ = AddStage(runner, "start", ProcessorFunc[int, int](func(ctx context.Context, in int) ([]int, error) {
+			return []int{in}, nil
+		}))
+
+		err := runner.Run(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "does not accept source items") {
+			t.Errorf("expected start type error, got: %v", err)
+		}
+	})
+
+	t.Run("Duplicate Stage", func(t *testing.T) {
+		runner := NewGraphRunner("dup", &mockSource{}, 1)
+		_ = runner.AddSink("end", &mockSink{})
+		if _, err := AddStageSink[string, string](runner, "end", &mockSink{}); err == nil {
+			t.Error("expected error when adding duplicate stage")
+		}
+	})
+}
+
+func TestRetype(t *testing.T) {
+	ct := NewCompletionTracker(nil, nil)
+	doc := &Document[string]{
+		ID:       "page",
+		Depth:    2,
+		Content:  "text",
+		Metadata: map[string]any{"title": "t"},
+		CT:       ct,
+	}
+
+	vec := Retype(doc, []float32{0.5})
+	if vec.ID != "page" || vec.Depth != 2 || vec.CT != ct {
+		t.Errorf("envelope not preserved: %+v", vec)
+	}
+	if vec.Content[0] != 0.5 {
+		t.Errorf("expected new content, got %v", vec.Content)
+	}
+
+	vec.Metadata["title"] = "changed"
+	if doc.Metadata["title"] != "t" {
+		t.Error("retyped metadata must not alias the original")
+	}
+
+	var nilDoc *Document[string]
+	if Retype(nilDoc, 1) != nil {
+		t.Error("retyping nil document should return nil")
+	}
+}
+
+type panicProcessor struct{}
+
+func (p *panicProcessor) Process(ctx context.Context, in *Document[string]) ([]*Document[string], error) {
+	var m map[string]any
+	_ = m["x"].(string) // type assertion on nil interface panics
+	return nil, nil
+}
+
+type hangingProcessor struct{}
+
+func (p *hangingProcessor) Process(ctx context.Context, in *Document[string]) ([]*Document[string], error) {
+	select {} // ignores ctx entirely
+}
+
+// stragglingProcessor overruns its deadline and then writes to the document,
+// as a processor that ignores ctx would.
+type stragglingProcessor struct {
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (p *stragglingProcessor) Process(ctx context.Context, in *Document[string]) ([]*Document[string], error) {
+	p.calls.Add(1)
+	<-p.release
+	in.Content = "late"
+	return []*Document[string]{in}, nil
+}
+
+type errProcessorDoc struct {
+	err error
+}
+
+func (p *errProcessorDoc) Process(ctx context.Context, in *Document[string]) ([]*Document[string], error) {
+	return nil, p.err
+}
+
+func runTrackedDoc(t *testing.T, configure func(r *GraphRunner[*Document[string]])) (acked, nacked bool, retryAfter time.Duration) {
+	t.Helper()
+
+	done := make(chan struct{})
+	var ct *CompletionTracker
+	ct = NewCompletionTracker(
+		func() { acked = true; close(done) },
+		func() { nacked = true; retryAfter = ct.RetryAfter(); close(done) },
+	)
+	src := &mockSourceDoc{items: []*Document[string]{{ID: "doc", CT: ct}}}
+	runner := NewGraphRunner[*Document[string]]("tracked", src, 1)
+	configure(runner)
+
+	if err := runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("completion tracker was never finished")
+	}
+	return acked, nacked, retryAfter
+}
+
+func TestGraphRunner_PanicIsolation(t *testing.T) {
+	acked, nacked, _ := runTrackedDoc(t, func(r *GraphRunner[*Document[string]]) {
+		_ = r.AddProcessor("start", &panicProcessor{})
+	})
+	if acked || !nacked {
+		t.Errorf("panicking node should nack the item, acked=%v nacked=%v", acked, nacked)
+	}
+}
+
+func TestGraphRunner_NodeTimeout(t *testing.T) {
+	var runner *GraphRunner[*Document[string]]
+	start := time.Now()
+	_, nacked, _ := runTrackedDoc(t, func(r *GraphRunner[*Document[string]]) {
+		runner = r
+		_ = r.AddProcessor("start", &hangingProcessor{})
+		if err := r.SetTimeout("start", 20*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if !nacked {
+		t.Error("timed out node should nack the item")
+	}
+	if time.Since(start) > time.Second {
+		t.Error("hung processor held the worker past its deadline")
+	}
+	if runner.Nodes["start"].Stats().Timeouts.Load() != 1 {
+		t.Error("expected timeout to be counted")
+	}
+	if err := runner.SetTimeout("missing", time.Second); err == nil {
+		t.Error("expected error for unknown node")
+	}
+}
+
+func TestGraphRunner_NodeTimeoutNotRetried(t *testing.T) {
+	proc := &stragglingProcessor{release: make(chan struct{})}
+	defer close(proc.release)
+	_, nacked, _ := runTrackedDoc(t, func(r *GraphRunner[*Document[string]]) {
+		_ = r.AddProcessor("start", proc)
+		_ = r.SetTimeout("start", 20*time.Millisecond)
+		_ = r.SetRetryPolicy("start", RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+	})
+
+	if !nacked {
+		t.Error("timed out node should nack the item for redelivery")
+	}
+	if n := proc.calls.Load(); n != 1 {
+		t.Errorf("expected no retry on the item the timed out attempt still holds, got %d calls", n)
+	}
+}
+
+func TestGraphRunner_OptionalNodeRecordsError(t *testing.T) {
+	done := make(chan bool, 1)
+	ct := NewCompletionTracker(func() { done <- true }, func() { done <- false })
+	runner := NewGraphRunner[*Document[string]]("optional", &mockSourceDoc{items: []*Document[string]{{ID: "doc", CT: ct}}}, 1)
+	_ = runner.AddProcessor("start", &errProcessorDoc{err: errors.New("llm down")})
+	_ = runner.SetOptional("start")
+	if err := runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if acked := <-done; !acked {
+		t.Error("expected the degraded item to complete")
+	}
+	if err := ct.Err(); err == nil || err.Error() != "llm down" {
+		t.Errorf("expected the skipped stage's error on the tracker, got %v", err)
+	}
+}
+
+func TestGraphRunner_CompletionSemantics(t *testing.T) {
+	t.Run("Success Acks", func(t *testing.T) {
+		acked, nacked, _ := runTrackedDoc(t, func(r *GraphRunner[*Document[string]]) {
+			_ = r.AddProcessor("start", &mockProcessorDoc{})
+		})
+		if !acked || nacked {
+			t.Errorf("expected ack, acked=%v nacked=%v", acked, nacked)
+		}
+	})
+
+	t.Run("Permanent Rejection Acks", func(t *testing.T) {
+		acked, _, _ := runTrackedDoc(t, func(r *GraphRunner[*Document[string]]) {
+			_ = r.AddProcessor("start", &errProcessorDoc{err: ErrRobotsDisallowed})
+		})
+		if !acked {
+			t.Error("non-retryable rejection should ack so the message is not redelivered")
+		}
+	})
+
+	t.Run("Retryable Failure Nacks With Delay", func(t *testing.T) {
+		_, nacked, retryAfter := runTrackedDoc(t, func(r *GraphRunner[*Document[string]]) {
+			_ = r.AddProcessor("start", &errProcessorDoc{err: &RetryableError{Err: errors.New("busy"), RetryAfter: 3 * time.Second}})
+		})
+		if !nacked || retryAfter != 3*time.Second {
+			t.Errorf("expected delayed nack, nacked=%v retryAfter=%v", nacked, retryAfter)
+		}
+	})
+}
+
+type recordingObserver struct {
+	mu       sync.Mutex
+	started  map[string]int
+	outputs  map[string]int
+	failures map[string]string
+}
+
+func (o *recordingObserver) ItemStarted(graph, node string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.started[graph+"/"+node]++
+}
+
+func (o *recordingObserver) ItemFinished(graph, node string, outputs int, elapsed time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.outputs[graph+"/"+node] += outputs
+	if err != nil {
+		o.failures[graph+"/"+node] = ErrorClass(err)
+	}
+}
+
+func TestGraphRunner_Observer(t *testing.T) {
+	obs := &recordingObserver{started: map[string]int{}, outputs: map[string]int{}, failures: map[string]string{}}
+	runner := NewGraphRunner[string]("observed", &mockSource{items: []string{"a", "b"}}, 2)
+	runner.Observer = obs
+
+	_ = runner.AddProcessor("start", &mockProcessor{suffix: "-1"})
+	_ = runner.AddProcessor("broken", &mockProcessor{err: &PermanentError{Err: errors.New("bad input")}})
+	_ = runner.Connect("start", "broken")
+
+	if err := runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if obs.started["observed/start"] != 2 || obs.outputs["observed/start"] != 2 {
+		t.Errorf("unexpected start events: started=%d outputs=%d", obs.started["observed/start"], obs.outputs["observed/start"])
+	}
+	if obs.started["observed/broken"] != 2 || obs.outputs["observed/broken"] != 0 {
+		t.Errorf("unexpected broken events: started=%d outputs=%d", obs.started["observed/broken"], obs.outputs["observed/broken"])
+	}
+	if obs.failures["observed/broken"] != "permanent" {
+		t.Errorf("expected permanent failure class, got %q", obs.failures["observed/broken"])
+	}
+}
+
+func TestGraphRunner_Tracing(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	const upstreamTrace = "4bf92f3577b34da6a3ce929d0e0e4736"
+	doc := &Document[string]{ID: "doc", Trace: propagation.MapCarrier{
+		"traceparent": "00-" + upstreamTrace + "-00f067aa0ba902b7-01",
+	}}
+
+	runner := NewGraphRunner[*Document[string]]("traced", &mockSourceDoc{items: []*Document[string]{doc}}, 1)
+	runner.TracerProvider = tp
+	_ = runner.AddProcessor("start", &mockProcessorDoc{})
+	_ = runner.AddProcessor("broken", ProcessorFunc[*Document[string], *Document[string]](func(ctx context.Context, in *Document[string]) ([]*Document[string], error) {
+		return nil, &PermanentError{Err: errors.New("bad input")}
+	}))
+	_ = runner.Connect("start", "broken")
+
+	if err := runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("expected graph span and two node spans, got %d", len(spans))
+	}
+
+	byName := map[string]tracetest.SpanStub{}
+	for _, s := range spans {
+		if s.SpanContext.TraceID().String() != upstreamTrace {
+			t.Errorf("span %s did not continue the upstream trace", s.Name)
+		}
+		byName[s.Name] = s
+	}
+
+	if byName["start"].Parent.SpanID() != byName["traced"].SpanContext.SpanID() {
+		t.Error("start span should be a child of the graph span")
+	}
+	if byName["broken"].Parent.SpanID() != byName["start"].SpanContext.SpanID() {
+		t.Error("downstream node span should be a child of its upstream node")
+	}
+	if len(byName["broken"].Events) == 0 {
+		t.Error("expected failing node to record its error")
+	}
+}
+
+func TestGraphRunner_ContextLogger(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := logging.WithLogger(context.Background(), logging.New(&buf, "info", "json"))
+
+	doc := &Document[string]{ID: "https://example.com", Metadata: map[string]any{"job_id": "job-42"}}
+	runner := NewGraphRunner[*Document[string]]("logged", &mockSourceDoc{items: []*Document[string]{doc}}, 1)
+	_ = runner.AddProcessor("start", ProcessorFunc[*Document[string], *Document[string]](func(ctx context.Context, in *Document[string]) ([]*Document[string], error) {
+		logging.FromContext(ctx).Info("processing")
+		return nil, nil
+	}))
+
+	if err := runner.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected a single JSON record, got %q: %v", buf.String(), err)
+	}
+	for key, want := range map[string]any{"graph": "logged", "worker_id": float64(0), "doc_id": "https://example.com", "job_id": "job-42", "node": "start"} {
+		if record[key] != want {
+			t.Errorf("log record %s = %v, want %v", key, record[key], want)
+		}
+	}
+}
+
+func TestGraphRunner_Progress(t *testing.T) {
+	runner := NewGraphRunner[string]("progress", &mockSource{items: []string{"a", "b"}}, 1)
+	_ = runner.AddProcessor("start", &mockProcessor{suffix: "-1"})
+
+	if _, last := runner.Progress(); !last.IsZero() {
+		t.Error("expected no progress before Run")
+	}
+
+	before := time.Now()
+	if err := runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	inFlight, last := runner.Progress()
+	if inFlight != 0 {
+		t.Errorf("expected no items in flight after Run, got %d", inFlight)
+	}
+	if last.Before(before) {
+		t.Error("expected last progress to be recorded during Run")
+	}
+}
@@ -1,7 +1,9 @@
 package core
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -10,6 +12,7 @@ var (
 	ErrSecurityViolation = errors.New("security policy violation: potential prompt injection")
 	ErrQuotaExceeded     = errors.New("domain crawl quota exceeded")
 	ErrDelayRequired     = errors.New("politeness delay required")
+	ErrNodeTimeout       = errors.New("node execution timed out")
 )
 
 type RetryableError struct {
@@ -25,6 +28,47 @@ func (e *RetryableError) Unwrap() error {
 	return e.Err
 }
 
+// PermanentError marks a failure that will not go away on retry (e.g. HTTP 404).
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// PanicError is a recovered panic from a node, kept with its stack trace.
+type PanicError struct {
+	Node  string
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in node %s: %v", e.Node, e.Value)
+}
+
+// ItemErrors is returned by a BatchSink whose batch partly failed. It maps
+// the index of each failed item to its error; the other items were written.
+type ItemErrors map[int]error
+
+func (e ItemErrors) Error() string {
+	first := -1
+	for i := range e {
+		if first < 0 || i < first {
+			first = i
+		}
+	}
+	if first < 0 {
+		return "no items failed"
+	}
+	return fmt.Sprintf("%d items failed, first item %d: %v", len(e), first, e[first])
+}
+
 func IsRetryable(err error) (bool, time.Duration) {
 	if err == nil {
 		return false, 0
@@ -35,6 +79,26 @@ func IsRetryable(err error) (bool, time.Duration) {
 		return true, re.RetryAfter
 	}
 
+	var pe *PermanentError
+	if errors.As(err, &pe) {
+		return false, 0
+	}
+
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		return false, 0
+	}
+
+	// The timed-out attempt may still be running against the item, so a
+	// retry would race with it. Redelivery hands over a fresh copy instead.
+	if errors.Is(err, ErrNodeTimeout) {
+		return false, 0
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return false, 0
+	}
+
 	if errors.Is(err, ErrDelayRequired) {
 		return true, 5 * time.Second
 	}
@@ -45,3 +109,33 @@ func IsRetryable(err error) (bool, time.Duration) {
 
 	return true, 0
 }
+
+// ErrorClass buckets an error into a small, stable set of labels for metrics.
+func ErrorClass(err error) string {
+	var pe *PanicError
+	var perm *PermanentError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &pe):
+		return "panic"
+	case errors.Is(err, ErrNodeTimeout):
+		return "timeout"
+	case errors.Is(err, ErrCircuitOpen):
+		return "circuit_open"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	case errors.Is(err, ErrRobotsDisallowed):
+		return "robots"
+	case errors.Is(err, ErrQuotaExceeded):
+		return "quota"
+	case errors.Is(err, ErrDelayRequired):
+		return "delay"
+	case errors.Is(err, ErrSecurityViolation):
+		return "security"
+	case errors.As(err, &perm):
+		return "permanent"
+	default:
+		return "retryable"
+	}
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"testing"
@@ -19,6 +20,9 @@ func TestIsRetryable(t *testing.T) {
 		{ErrSecurityViolation, false, false, "Security violation should never be retried"},
 		{errors.New("random error"), true, false, "Unknown errors should be retried by default (safe bet)"},
 		{fmt.Errorf("wrapped: %w", ErrDelayRequired), true, true, "Wrapped retryable errors should be detected with wait"},
+		{&PermanentError{Err: errors.New("status 404")}, false, false, "Permanent errors are never retried"},
+		{fmt.Errorf("shutdown: %w", context.Canceled), false, false, "Cancelled work should not be retried"},
+		{fmt.Errorf("%w: node n", ErrNodeTimeout), false, false, "Timed out attempts are redelivered, not retried in place"},
 	}
 
 	for _, tt := range tests {
@@ -67,3 +71,25 @@ func TestErrorMessages(t *testing.T) {
 		t.Error("ErrSecurityViolation message mismatch")
 	}
 }
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{nil, ""},
+		{&PanicError{Node: "n", Value: "boom"}, "panic"},
+		{fmt.Errorf("%w: node n", ErrNodeTimeout), "timeout"},
+		{&RetryableError{Err: fmt.Errorf("llm: %w", ErrCircuitOpen)}, "circuit_open"},
+		{context.Canceled, "canceled"},
+		{ErrRobotsDisallowed, "robots"},
+		{&PermanentError{Err: errors.New("status 404")}, "permanent"},
+		{errors.New("connection reset"), "retryable"},
+	}
+
+	for _, tt := range tests {
+		if got := ErrorClass(tt.err); got != tt.expected {
+			t.Errorf("ErrorClass(%v) = %q, want %q", tt.err, got, tt.expected)
+		}
+	}
+}
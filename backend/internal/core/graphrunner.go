@@ -2,27 +2,118 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oranjParker/Rarefactor/internal/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
-type Node[T any] struct {
-	Name       string
-	Processor  Processor[T, T]
-	Downstream []*Node[T]
-	Sink       Sink[T]
+const tracerName = "github.com/oranjParker/Rarefactor/internal/core"
+
+// Vertex is the type-erased view of a node, letting a single graph hold
+// stages whose input and output types differ.
+type Vertex interface {
+	NodeName() string
+	IsSink() bool
+	Stats() *NodeStats
+	link(to Vertex) error
+	setRetryPolicy(policy RetryPolicy)
+	setTimeout(timeout time.Duration)
+	setOptional(optional bool)
+	bind(graph string, obs Observer, tracer trace.Tracer)
+}
+
+// inlet is a vertex that can be fed items of type T.
+type inlet[T any] interface {
+	Vertex
+	execute(ctx context.Context, item T)
+}
+
+type Node[In any, Out any] struct {
+	Name      string
+	Processor Processor[In, Out]
+	Sink      Sink[Out]
+	Retry     RetryPolicy
+	Timeout   time.Duration
+	// Optional passes the input on unchanged once the processor has
+	// exhausted its retries, instead of failing the item. The error is still
+	// recorded on the item's tracker.
+	Optional   bool
+	downstream []inlet[Out]
+	stats      NodeStats
+	graph      string
+	observer   Observer
+	tracer     trace.Tracer
+}
+
+func (n *Node[In, Out]) NodeName() string {
+	return n.Name
 }
 
-func (n *Node[T]) IsSink() bool {
+func (n *Node[In, Out]) IsSink() bool {
 	return n.Sink != nil
 }
 
+func (n *Node[In, Out]) Stats() *NodeStats {
+	return &n.stats
+}
+
+func (n *Node[In, Out]) setRetryPolicy(policy RetryPolicy) {
+	n.Retry = policy
+}
+
+func (n *Node[In, Out]) setTimeout(timeout time.Duration) {
+	n.Timeout = timeout
+}
+
+func (n *Node[In, Out]) setOptional(optional bool) {
+	n.Optional = optional
+}
+
+func (n *Node[In, Out]) bind(graph string, obs Observer, tracer trace.Tracer) {
+	n.graph = graph
+	n.observer = obs
+	n.tracer = tracer
+}
+
+func (n *Node[In, Out]) link(to Vertex) error {
+	next, ok := to.(inlet[Out])
+	if !ok {
+		return fmt.Errorf("connection failed: node %s emits %v which node %s does not accept", n.Name, reflect.TypeFor[Out](), to.NodeName())
+	}
+	n.downstream = append(n.downstream, next)
+	return nil
+}
+
+// ProcessorFunc adapts a plain function to the Processor interface.
+type ProcessorFunc[In any, Out any] func(ctx context.Context, input In) ([]Out, error)
+
+func (f ProcessorFunc[In, Out]) Process(ctx context.Context, input In) ([]Out, error) {
+	return f(ctx, input)
+}
+
 type GraphRunner[T any] struct {
 	Name        string
 	Source      Source[T]
-	Nodes       map[string]*Node[T]
+	Nodes       map[string]Vertex
 	Concurrency int
-	wg          sync.WaitGroup
+	Observer    Observer
+	// TracerProvider defaults to the global OpenTelemetry provider.
+	TracerProvider trace.TracerProvider
+	tracer         trace.Tracer
+	inFlight       atomic.Int64
+	lastProgress   atomic.Int64
+	wg             sync.WaitGroup
 }
 
 func NewGraphRunner[T any](name string, src Source[T], concurrency int) *GraphRunner[T] {
@@ -32,7 +123,7 @@ func NewGraphRunner[T any](name string, src Source[T], concurrency int) *GraphRu
 	return &GraphRunner[T]{
 		Name:        name,
 		Source:      src,
-		Nodes:       make(map[string]*Node[T]),
+		Nodes:       make(map[string]Vertex),
 		Concurrency: concurrency,
 	}
 }
@@ -42,37 +133,99 @@ func (g *GraphRunner[T]) nodeExists(name string) bool {
 	return ok
 }
 
-func (g *GraphRunner[T]) AddProcessor(name string, proc Processor[T, T]) error {
-	if g.nodeExists(name) {
-		return fmt.Errorf("node %s already exists in graph", name)
+func (g *GraphRunner[T]) addNode(v Vertex) error {
+	if g.nodeExists(v.NodeName()) {
+		return fmt.Errorf("node %s already exists in graph", v.NodeName())
 	}
-	g.Nodes[name] = &Node[T]{Name: name, Processor: proc}
+	g.Nodes[v.NodeName()] = v
 	return nil
 }
 
+func (g *GraphRunner[T]) AddProcessor(name string, proc Processor[T, T]) error {
+	return g.addNode(&Node[T, T]{Name: name, Processor: proc})
+}
+
 func (g *GraphRunner[T]) AddSink(name string, sink Sink[T]) error {
-	if g.nodeExists(name) {
-		return fmt.Errorf("node %s already exists in graph", name)
-	}
-	g.Nodes[name] = &Node[T]{Name: name, Sink: sink}
-	return nil
+	return g.addNode(&Node[T, T]{Name: name, Sink: sink})
 }
 
 func (g *GraphRunner[T]) AddHybrid(name string, proc Processor[T, T], sink Sink[T]) error {
-	if g.nodeExists(name) {
-		return fmt.Errorf("node %s already exists in graph", name)
+	return g.addNode(&Node[T, T]{Name: name, Processor: proc, Sink: sink})
+}
+
+// AddStage registers a processor whose output type may differ from its input.
+// The returned node can be wired with Link for compile-time checked edges.
+func AddStage[T, In, Out any](g *GraphRunner[T], name string, proc Processor[In, Out]) (*Node[In, Out], error) {
+	n := &Node[In, Out]{Name: name, Processor: proc}
+	if err := g.addNode(n); err != nil {
+		return nil, err
 	}
-	g.Nodes[name] = &Node[T]{Name: name, Processor: proc, Sink: sink}
-	return nil
+	return n, nil
+}
+
+// AddStageHybrid is AddStage with a sink that receives every output item.
+func AddStageHybrid[T, In, Out any](g *GraphRunner[T], name string, proc Processor[In, Out], sink Sink[Out]) (*Node[In, Out], error) {
+	n := &Node[In, Out]{Name: name, Processor: proc, Sink: sink}
+	if err := g.addNode(n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// AddStageSink registers a terminal sink for items of type In.
+func AddStageSink[T, In any](g *GraphRunner[T], name string, sink Sink[In]) (*Node[In, In], error) {
+	n := &Node[In, In]{Name: name, Sink: sink}
+	if err := g.addNode(n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Link wires two typed nodes. The compiler rejects edges whose types do not line up.
+func Link[A, B, C any](from *Node[A, B], to *Node[B, C]) {
+	from.downstream = append(from.downstream, to)
 }
 
+// Connect wires two nodes by name, checking at runtime that the target accepts
+// what the source emits.
 func (g *GraphRunner[T]) Connect(from, to string) error {
 	f, ok1 := g.Nodes[from]
 	t, ok2 := g.Nodes[to]
 	if !ok1 || !ok2 {
 		return fmt.Errorf("connection failed: node %s or %s not found", from, to)
 	}
-	f.Downstream = append(f.Downstream, t)
+	return f.link(t)
+}
+
+// SetRetryPolicy applies policy to both the processor and sink of the named node.
+func (g *GraphRunner[T]) SetRetryPolicy(name string, policy RetryPolicy) error {
+	v, ok := g.Nodes[name]
+	if !ok {
+		return fmt.Errorf("node %s not found", name)
+	}
+	v.setRetryPolicy(policy)
+	return nil
+}
+
+// SetTimeout bounds each attempt of the named node. A processor that ignores
+// its context is abandoned once the deadline passes so the worker is freed.
+func (g *GraphRunner[T]) SetTimeout(name string, timeout time.Duration) error {
+	v, ok := g.Nodes[name]
+	if !ok {
+		return fmt.Errorf("node %s not found", name)
+	}
+	v.setTimeout(timeout)
+	return nil
+}
+
+// SetOptional marks the named node as best effort: when its processor still
+// fails after retries, the item continues downstream without that stage.
+func (g *GraphRunner[T]) SetOptional(name string) error {
+	v, ok := g.Nodes[name]
+	if !ok {
+		return fmt.Errorf("node %s not found", name)
+	}
+	v.setOptional(true)
 	return nil
 }
 
@@ -82,17 +235,36 @@ func (g *GraphRunner[T]) Run(ctx context.Context) error {
 		return fmt.Errorf("source error: %w", err)
 	}
 
-	startNode, ok := g.Nodes["start"]
+	v, ok := g.Nodes["start"]
 	if !ok {
 		return fmt.Errorf("graph execution error: no 'start' node found")
 	}
+	startNode, ok := v.(inlet[T])
+	if !ok {
+		return fmt.Errorf("graph execution error: 'start' node does not accept source items of type %v", reflect.TypeFor[T]())
+	}
+
+	var obs Observer = noopObserver{}
+	if g.Observer != nil {
+		obs = g.Observer
+	}
+	tp := g.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	g.tracer = tp.Tracer(tracerName)
+	for _, node := range g.Nodes {
+		node.bind(g.Name, obs, g.tracer)
+	}
 
+	g.lastProgress.Store(time.Now().UnixNano())
 	for i := 0; i < g.Concurrency; i++ {
 		g.wg.Add(1)
 		go func(workerID int) {
 			defer g.wg.Done()
+			workerCtx := logging.With(ctx, "graph", g.Name, "worker_id", workerID)
 			for item := range stream {
-				g.executeNode(ctx, startNode, item)
+				g.dispatch(workerCtx, startNode, item)
 			}
 		}(i)
 	}
@@ -101,50 +273,234 @@ func (g *GraphRunner[T]) Run(ctx context.Context) error {
 	return nil
 }
 
-func (g *GraphRunner[T]) executeNode(ctx context.Context, node *Node[T], item T) {
+// Progress reports how many source items are executing and when the runner
+// last finished one (or started, if it has not finished any yet).
+func (g *GraphRunner[T]) Progress() (inFlight int64, last time.Time) {
+	if ns := g.lastProgress.Load(); ns != 0 {
+		last = time.Unix(0, ns)
+	}
+	return g.inFlight.Load(), last
+}
+
+// dispatch runs one source item through the graph. The runner holds the item's
+// CompletionTracker open while the graph executes; asynchronous sinks add their
+// own holds, so the item is acked or nacked only once every branch is settled.
+// Items carrying an upstream trace context continue that trace.
+func (g *GraphRunner[T]) dispatch(ctx context.Context, start inlet[T], item T) {
+	g.inFlight.Add(1)
+	defer func() {
+		g.lastProgress.Store(time.Now().UnixNano())
+		g.inFlight.Add(-1)
+	}()
+
+	if t, ok := any(item).(Traced); ok {
+		if carrier := t.TraceCarrier(); carrier != nil {
+			ctx = otel.GetTextMapPropagator().Extract(ctx, carrier)
+		}
+	}
+	ctx, span := g.tracer.Start(ctx, g.Name, trace.WithSpanKind(trace.SpanKindConsumer))
+	defer span.End()
+	if l, ok := any(item).(Loggable); ok {
+		ctx = logging.With(ctx, l.LogAttrs()...)
+	}
+
+	ct := trackerOf(item)
+	if ct != nil {
+		ct.Add(1)
+	}
+
+	start.execute(ctx, item)
+
+	if ct != nil {
+		if ctx.Err() != nil {
+			ct.Fail()
+		}
+		ct.Done()
+		go ct.WaitAndFinish()
+	}
+}
+
+func trackerOf(item any) *CompletionTracker {
+	if t, ok := item.(Tracked); ok {
+		return t.Tracker()
+	}
+	return nil
+}
+
+// failItem records err on the item's tracker and marks it failed when the
+// error is worth a redelivery. Permanent rejections (robots, quota, 404) are
+// left to ack.
+func failItem(item any, err error) {
+	ct := trackerOf(item)
+	if ct == nil {
+		return
+	}
+	ct.SetErr(err)
+	var pe *PanicError
+	retry, wait := IsRetryable(err)
+	switch {
+	case retry && wait > 0:
+		ct.FailAfter(wait)
+	case retry || errors.As(err, &pe) || errors.Is(err, ErrNodeTimeout):
+		ct.Fail()
+	}
+}
+
+func (n *Node[In, Out]) execute(ctx context.Context, item In) {
 	select {
 	case <-ctx.Done():
 		return
 	default:
 	}
 
-	currentItems := []T{item}
+	obs := n.observer
+	if obs == nil {
+		obs = noopObserver{}
+	}
+	tracer := n.tracer
+	if tracer == nil {
+		tracer = noop.Tracer{}
+	}
+	ctx, span := tracer.Start(ctx, n.Name, trace.WithAttributes(
+		attribute.String("graph", n.graph),
+		attribute.String("node", n.Name),
+	))
+
+	ctx = logging.With(ctx, "node", n.Name)
+	logger := logging.FromContext(ctx)
+
+	obs.ItemStarted(n.graph, n.Name)
+	started := time.Now()
+	var nodeErr error
 
-	if node.Processor != nil {
-		results, err := node.Processor.Process(ctx, item)
-		if err != nil {
-			fmt.Printf("[%s] Processor Failure: %v\n", node.Name, err)
+	var currentItems []Out
+
+	if n.Processor != nil {
+		var results []Out
+		err := n.Retry.Do(ctx, &n.stats, func(ctx context.Context) error {
+			var procErr error
+			results, procErr = n.guard(ctx, func(ctx context.Context) ([]Out, error) {
+				return n.Processor.Process(ctx, item)
+			})
+			return procErr
+		})
+		passThrough, canSkip := any(item).(Out)
+		switch {
+		case err == nil:
+		case n.Optional && canSkip && ctx.Err() == nil:
+			logger.Warn("optional processor failed, passing item on", "error", err, "class", ErrorClass(err))
+			// The item still completes, but carries why it is degraded.
+			if ct := trackerOf(item); ct != nil {
+				ct.SetErr(err)
+			}
+			results = []Out{passThrough}
+			nodeErr = err
+		default:
+			logger.Warn("processor failed", "error", err, "class", ErrorClass(err))
+			failItem(item, err)
+			nodeErr = err
 		}
 		currentItems = results
+	} else if passThrough, ok := any(item).(Out); ok {
+		currentItems = []Out{passThrough}
 	}
 
-	if node.Sink != nil {
+	if n.Sink != nil {
 		for _, resultItem := range currentItems {
-			if err := node.Sink.Write(ctx, resultItem); err != nil {
-				fmt.Printf("[%s] Sink error: %v\n", node.Name, err)
+			err := n.Retry.Do(ctx, &n.stats, func(ctx context.Context) error {
+				_, sinkErr := n.guard(ctx, func(ctx context.Context) ([]Out, error) {
+					return nil, n.Sink.Write(ctx, resultItem)
+				})
+				return sinkErr
+			})
+			if err != nil {
+				logger.Warn("sink failed", "error", err, "class", ErrorClass(err))
+				failItem(resultItem, err)
+				if nodeErr == nil {
+					nodeErr = err
+				}
 			}
 		}
 	}
 
+	obs.ItemFinished(n.graph, n.Name, len(currentItems), time.Since(started), nodeErr)
+	span.SetAttributes(attribute.Int("outputs", len(currentItems)))
+	if nodeErr != nil {
+		span.RecordError(nodeErr)
+		span.SetStatus(codes.Error, ErrorClass(nodeErr))
+	}
+	span.End()
+
 	for _, res := range currentItems {
-		if len(node.Downstream) > 1 {
+		if len(n.downstream) > 1 {
 			var executionGroup sync.WaitGroup
-			for i := 0; i < len(node.Downstream); i++ {
+			for i := 0; i < len(n.downstream); i++ {
 				executionGroup.Add(1)
-				var passItem T
-				if cloner, ok := any(res).(interface{ Clone() T }); ok {
+				var passItem Out
+				if cloner, ok := any(res).(interface{ Clone() Out }); ok {
 					passItem = cloner.Clone()
 				} else {
 					passItem = res
 				}
-				go func(i int, passItem T) {
+				go func(i int, passItem Out) {
 					defer executionGroup.Done()
-					g.executeNode(ctx, node.Downstream[i], passItem)
+					n.downstream[i].execute(ctx, passItem)
 				}(i, passItem)
 			}
 			executionGroup.Wait()
-		} else if len(node.Downstream) == 1 {
-			g.executeNode(ctx, node.Downstream[0], res)
+		} else if len(n.downstream) == 1 {
+			n.downstream[0].execute(ctx, res)
+		}
+	}
+}
+
+// guard runs a single attempt of fn with panic isolation and, if configured,
+// the node's deadline.
+func (n *Node[In, Out]) guard(ctx context.Context, fn func(ctx context.Context) ([]Out, error)) ([]Out, error) {
+	if n.Timeout <= 0 {
+		return n.recoverCall(ctx, fn)
+	}
+
+	nodeCtx, cancel := context.WithTimeout(ctx, n.Timeout)
+	defer cancel()
+
+	type result struct {
+		items []Out
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		items, err := n.recoverCall(nodeCtx, fn)
+		done <- result{items: items, err: err}
+	}()
+
+	timedOut := func() ([]Out, error) {
+		n.stats.Timeouts.Add(1)
+		return nil, fmt.Errorf("%w: node %s exceeded %v", ErrNodeTimeout, n.Name, n.Timeout)
+	}
+
+	select {
+	case r := <-done:
+		if r.err != nil && ctx.Err() == nil && errors.Is(nodeCtx.Err(), context.DeadlineExceeded) {
+			return timedOut()
+		}
+		return r.items, r.err
+	case <-nodeCtx.Done():
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
 		}
+		return timedOut()
 	}
 }
+
+func (n *Node[In, Out]) recoverCall(ctx context.Context, fn func(ctx context.Context) ([]Out, error)) (items []Out, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			stack := debug.Stack()
+			n.stats.Panics.Add(1)
+			logging.FromContext(ctx).Error("recovered panic", "panic", r, "stack", string(stack))
+			items, err = nil, &PanicError{Node: n.Name, Value: r, Stack: stack}
+		}
+	}()
+	return fn(ctx)
+}
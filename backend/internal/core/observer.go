@@ -0,0 +1,16 @@
+package core
+
+import "time"
+
+// Observer receives per-node execution events from a GraphRunner. It keeps the
+// core free of any particular telemetry backend.
+type Observer interface {
+	ItemStarted(graph, node string)
+	ItemFinished(graph, node string, outputs int, elapsed time.Duration, err error)
+}
+
+type noopObserver struct{}
+
+func (noopObserver) ItemStarted(graph, node string) {}
+
+func (noopObserver) ItemFinished(graph, node string, outputs int, elapsed time.Duration, err error) {}
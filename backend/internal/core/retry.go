@@ -0,0 +1,121 @@
+package core
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy describes how the GraphRunner re-attempts a failing node. The
+// zero value performs a single attempt.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter randomises each delay by up to this fraction (0.2 = ±20%).
+	Jitter float64
+	// RetryOn decides whether an error is worth another attempt and may return
+	// a server-provided wait. Defaults to IsRetryable.
+	RetryOn func(err error) (bool, time.Duration)
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 1 * time.Second,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// NodeStats counts executions of a node. Attempts includes retries.
+type NodeStats struct {
+	Attempts atomic.Int64
+	Retries  atomic.Int64
+	Failures atomic.Int64
+	Panics   atomic.Int64
+	Timeouts atomic.Int64
+}
+
+// Do runs fn until it succeeds, the policy is exhausted, the error is not
+// retryable or ctx is done. A RetryAfter hint longer than MaxBackoff ends the
+// loop so the item can be redelivered later instead of pinning a worker.
+func (p RetryPolicy) Do(ctx context.Context, stats *NodeStats, fn func(ctx context.Context) error) error {
+	maxAttempts := p.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	retryOn := p.RetryOn
+	if retryOn == nil {
+		retryOn = IsRetryable
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if stats != nil {
+			stats.Attempts.Add(1)
+			if attempt > 1 {
+				stats.Retries.Add(1)
+			}
+		}
+
+		if err = fn(ctx); err == nil {
+			return nil
+		}
+
+		if attempt >= maxAttempts {
+			break
+		}
+		retry, hint := retryOn(err)
+		if !retry {
+			break
+		}
+
+		delay := p.backoff(attempt)
+		if hint > 0 {
+			if p.MaxBackoff > 0 && hint > p.MaxBackoff {
+				break
+			}
+			delay = hint
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if stats != nil {
+				stats.Failures.Add(1)
+			}
+			return err
+		case <-timer.C:
+		}
+	}
+
+	if stats != nil {
+		stats.Failures.Add(1)
+	}
+	return err
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return time.Duration(delay)
+}
@@ -0,0 +1,206 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func fastPolicy(attempts int) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    attempts,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		Multiplier:     2,
+	}
+}
+
+func TestRetryPolicy_Do(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Succeeds After Transient Failures", func(t *testing.T) {
+		var stats NodeStats
+		calls := 0
+		err := fastPolicy(3).Do(ctx, &stats, func(ctx context.Context) error {
+			calls++
+			if calls < 3 {
+				return errors.New("transient")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("expected success, got %v", err)
+		}
+		if stats.Attempts.Load() != 3 || stats.Retries.Load() != 2 || stats.Failures.Load() != 0 {
+			t.Errorf("unexpected stats: attempts=%d retries=%d failures=%d", stats.Attempts.Load(), stats.Retries.Load(), stats.Failures.Load())
+		}
+	})
+
+	t.Run("Stops On Non Retryable", func(t *testing.T) {
+		var stats NodeStats
+		calls := 0
+		err := fastPolicy(5).Do(ctx, &stats, func(ctx context.Context) error {
+			calls++
+			return fmt.Errorf("blocked: %w", ErrRobotsDisallowed)
+		})
+		if !errors.Is(err, ErrRobotsDisallowed) || calls != 1 {
+			t.Errorf("expected a single attempt, got %d calls, err=%v", calls, err)
+		}
+		if stats.Failures.Load() != 1 {
+			t.Errorf("expected failure to be counted, got %d", stats.Failures.Load())
+		}
+	})
+
+	t.Run("Zero Value Is Single Attempt", func(t *testing.T) {
+		calls := 0
+		_ = RetryPolicy{}.Do(ctx, nil, func(ctx context.Context) error {
+			calls++
+			return errors.New("fail")
+		})
+		if calls != 1 {
+			t.Errorf("expected 1 call, got %d", calls)
+		}
+	})
+
+	t.Run("RetryAfter Beyond MaxBackoff Gives Up", func(t *testing.T) {
+		calls := 0
+		_ = fastPolicy(5).Do(ctx, nil, func(ctx context.Context) error {
+			calls++
+			return &RetryableError{Err: errors.New("throttled"), RetryAfter: time.Hour}
+		})
+		if calls != 1 {
+			t.Errorf("expected to give up rather than sleep an hour, got %d calls", calls)
+		}
+	})
+
+	t.Run("Honours Context Cancellation", func(t *testing.T) {
+		cctx, cancel := context.WithCancel(ctx)
+		policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour}
+		calls := 0
+		done := make(chan error)
+		go func() {
+			done <- policy.Do(cctx, nil, func(ctx context.Context) error {
+				calls++
+				return errors.New("fail")
+			})
+		}()
+		cancel()
+
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Error("expected last error after cancellation")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("retry loop ignored context cancellation")
+		}
+	})
+
+	t.Run("Custom RetryOn", func(t *testing.T) {
+		calls := 0
+		policy := fastPolicy(4)
+		policy.RetryOn = func(err error) (bool, time.Duration) { return false, 0 }
+		_ = policy.Do(ctx, nil, func(ctx context.Context) error {
+			calls++
+			return errors.New("fail")
+		})
+		if calls != 1 {
+			t.Errorf("custom predicate should stop retries, got %d calls", calls)
+		}
+	})
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond, Multiplier: 2}
+
+	if d := p.backoff(1); d != 100*time.Millisecond {
+		t.Errorf("attempt 1: expected 100ms, got %v", d)
+	}
+	if d := p.backoff(2); d != 200*time.Millisecond {
+		t.Errorf("attempt 2: expected 200ms, got %v", d)
+	}
+	if d := p.backoff(5); d != 300*time.Millisecond {
+		t.Errorf("expected backoff capped at 300ms, got %v", d)
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		if d := p.backoff(1); d < 50*time.Millisecond || d > 150*time.Millisecond {
+			t.Fatalf("jittered delay out of bounds: %v", d)
+		}
+	}
+}
+
+type flakyProcessor struct {
+	failures int
+	calls    int
+}
+
+func (p *flakyProcessor) Process(ctx context.Context, in string) ([]string, error) {
+	p.calls++
+	if p.calls <= p.failures {
+		return nil, errors.New("flaky")
+	}
+	return []string{in}, nil
+}
+
+func TestGraphRunner_RetryPolicy(t *testing.T) {
+	src := &mockSource{items: []string{"input"}}
+	runner := NewGraphRunner("retry-test", src, 1)
+	sink := &mockSink{}
+	flaky := &flakyProcessor{failures: 2}
+
+	_ = runner.AddProcessor("start", flaky)
+	_ = runner.AddSink("end", sink)
+	_ = runner.Connect("start", "end")
+
+	if err := runner.SetRetryPolicy("start", fastPolicy(3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.SetRetryPolicy("missing", fastPolicy(3)); err == nil {
+		t.Error("expected error for unknown node")
+	}
+
+	if err := runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.received) != 1 {
+		t.Fatalf("expected item to survive retries, got %v", sink.received)
+	}
+	stats := runner.Nodes["start"].Stats()
+	if stats.Attempts.Load() != 3 || stats.Retries.Load() != 2 {
+		t.Errorf("unexpected node stats: attempts=%d retries=%d", stats.Attempts.Load(), stats.Retries.Load())
+	}
+}
+
+func TestGraphRunner_OptionalNodePassesItemOn(t *testing.T) {
+	src := &mockSource{items: []string{"input"}}
+	runner := NewGraphRunner("optional-test", src, 1)
+	sink := &mockSink{}
+	flaky := &flakyProcessor{failures: 5}
+
+	_ = runner.AddProcessor("start", flaky)
+	_ = runner.AddSink("end", sink)
+	_ = runner.Connect("start", "end")
+	_ = runner.SetRetryPolicy("start", fastPolicy(3))
+	if err := runner.SetOptional("start"); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.SetOptional("missing"); err == nil {
+		t.Error("expected error for unknown node")
+	}
+
+	if err := runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if flaky.calls != 3 {
+		t.Errorf("expected the retries to run first, got %d calls", flaky.calls)
+	}
+	if len(sink.received) != 1 || sink.received[0] != "input" {
+		t.Errorf("expected the unprocessed item downstream, got %v", sink.received)
+	}
+}
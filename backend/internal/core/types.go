@@ -5,6 +5,8 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"go.opentelemetry.io/otel/propagation"
 )
 
 type Document[T any] struct {
@@ -17,13 +19,17 @@ type Document[T any] struct {
 	CreatedAt      time.Time      `json:"created_at"`
 	Depth          int            `json:"depth"`
 	CT             *CompletionTracker
+	Trace          propagation.MapCarrier `json:"-"`
 }
 
 type CompletionTracker struct {
-	wg     sync.WaitGroup
-	failed atomic.Bool
-	ack    func()
-	nack   func()
+	wg         sync.WaitGroup
+	failed     atomic.Bool
+	retryAfter atomic.Int64
+	errMu      sync.Mutex
+	err        error
+	ack        func()
+	nack       func()
 }
 
 func NewCompletionTracker(ack, nack func()) *CompletionTracker {
@@ -48,6 +54,40 @@ func (ct *CompletionTracker) Fail() {
 	ct.failed.Store(true)
 }
 
+// FailAfter marks the tracker failed and asks for redelivery no sooner than d.
+// The longest delay requested by any branch wins.
+func (ct *CompletionTracker) FailAfter(d time.Duration) {
+	for {
+		cur := ct.retryAfter.Load()
+		if int64(d) <= cur || ct.retryAfter.CompareAndSwap(cur, int64(d)) {
+			break
+		}
+	}
+	ct.failed.Store(true)
+}
+
+func (ct *CompletionTracker) RetryAfter() time.Duration {
+	return time.Duration(ct.retryAfter.Load())
+}
+
+// SetErr records why the item failed. The first error wins: it is the root
+// cause, and later branches often fail only because of it.
+func (ct *CompletionTracker) SetErr(err error) {
+	ct.errMu.Lock()
+	defer ct.errMu.Unlock()
+	if ct.err == nil {
+		ct.err = err
+	}
+}
+
+// Err is the first error recorded for the item, whether or not it asked for
+// a redelivery.
+func (ct *CompletionTracker) Err() error {
+	ct.errMu.Lock()
+	defer ct.errMu.Unlock()
+	return ct.err
+}
+
 func (ct *CompletionTracker) WaitAndFinish() {
 	ct.wg.Wait()
 	if ct.failed.Load() {
@@ -61,6 +101,47 @@ func (ct *CompletionTracker) WaitAndFinish() {
 	}
 }
 
+// Tracked is implemented by items that carry a CompletionTracker.
+type Tracked interface {
+	Tracker() *CompletionTracker
+}
+
+func (d *Document[T]) Tracker() *CompletionTracker {
+	if d == nil {
+		return nil
+	}
+	return d.CT
+}
+
+// Traced is implemented by items that carry the trace context of the message
+// they arrived in. It travels in transport headers, not in the payload.
+type Traced interface {
+	TraceCarrier() propagation.MapCarrier
+}
+
+func (d *Document[T]) TraceCarrier() propagation.MapCarrier {
+	if d == nil {
+		return nil
+	}
+	return d.Trace
+}
+
+// Loggable is implemented by items that identify themselves in log records.
+type Loggable interface {
+	LogAttrs() []any
+}
+
+func (d *Document[T]) LogAttrs() []any {
+	if d == nil {
+		return nil
+	}
+	attrs := []any{"doc_id", d.ID}
+	if jobID, ok := d.Metadata["job_id"].(string); ok && jobID != "" {
+		attrs = append(attrs, "job_id", jobID)
+	}
+	return attrs
+}
+
 func (d *Document[T]) Clone() *Document[T] {
 	if d == nil {
 		return nil
@@ -85,6 +166,26 @@ func (d *Document[T]) Clone() *Document[T] {
 	return &newDoc
 }
 
+// Retype copies a document's envelope (ID, lineage, metadata, tracker) onto a
+// new content type, for stages that change what a document carries.
+func Retype[From, To any](d *Document[From], content To) *Document[To] {
+	if d == nil {
+		return nil
+	}
+	c := d.Clone()
+	return &Document[To]{
+		ID:        c.ID,
+		ParentID:  c.ParentID,
+		Source:    c.Source,
+		Content:   content,
+		Metadata:  c.Metadata,
+		CreatedAt: c.CreatedAt,
+		Depth:     c.Depth,
+		CT:        c.CT,
+		Trace:     c.Trace,
+	}
+}
+
 type Source[T any] interface {
 	Stream(ctx context.Context) (<-chan T, error)
 }
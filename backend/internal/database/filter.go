@@ -0,0 +1,95 @@
+package database
+
+import (
+	"slices"
+	"time"
+
+	"github.com/qdrant/go-client/qdrant"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// SearchFilter narrows a vector search to points whose payload matches. Zero
+// fields match every point.
+type SearchFilter struct {
+	Namespace string
+	Domain    string
+	JobID     string
+	Language  string
+	// PageURL keeps the chunks of a single page.
+	PageURL string
+	// CrawledAfter and CrawledBefore bound the crawl time, inclusively.
+	CrawledAfter  time.Time
+	CrawledBefore time.Time
+	// ChunkIndexes keeps chunks at any of these positions, e.g. {0} for
+	// the opening chunk of each page.
+	ChunkIndexes []int
+}
+
+// qdrantFilter builds the conditions for QdrantClient.Query, or nil when the
+// filter matches everything.
+func (f SearchFilter) qdrantFilter() *qdrant.Filter {
+	var must []*qdrant.Condition
+	for _, field := range []struct{ key, value string }{
+		{"namespace", f.Namespace},
+		{"domain", f.Domain},
+		{"job_id", f.JobID},
+		{"language", f.Language},
+		{"page_url", f.PageURL},
+	} {
+		if field.value != "" {
+			must = append(must, qdrant.NewMatchKeyword(field.key, field.value))
+		}
+	}
+	if !f.CrawledAfter.IsZero() || !f.CrawledBefore.IsZero() {
+		r := &qdrant.DatetimeRange{}
+		if !f.CrawledAfter.IsZero() {
+			r.Gte = timestamppb.New(f.CrawledAfter)
+		}
+		if !f.CrawledBefore.IsZero() {
+			r.Lte = timestamppb.New(f.CrawledBefore)
+		}
+		must = append(must, qdrant.NewDatetimeRange("crawled_at", r))
+	}
+	if len(f.ChunkIndexes) > 0 {
+		indexes := make([]int64, len(f.ChunkIndexes))
+		for i, n := range f.ChunkIndexes {
+			indexes[i] = int64(n)
+		}
+		must = append(must, qdrant.NewMatchInts("chunk_index", indexes...))
+	}
+	if len(must) == 0 {
+		return nil
+	}
+	return &qdrant.Filter{Must: must}
+}
+
+// Matches applies the filter to a point held in memory, with the same
+// semantics as the Qdrant conditions.
+func (f SearchFilter) Matches(p QdrantPoint) bool {
+	for _, field := range []struct{ want, got string }{
+		{f.Namespace, p.Namespace},
+		{f.Domain, p.Domain},
+		{f.JobID, p.JobID},
+		{f.Language, p.Language},
+		{f.PageURL, p.PageURL},
+	} {
+		if field.want != "" && field.want != field.got {
+			return false
+		}
+	}
+	if !f.CrawledAfter.IsZero() || !f.CrawledBefore.IsZero() {
+		if p.CrawledAt.IsZero() {
+			return false
+		}
+		if !f.CrawledAfter.IsZero() && p.CrawledAt.Before(f.CrawledAfter) {
+			return false
+		}
+		if !f.CrawledBefore.IsZero() && p.CrawledAt.After(f.CrawledBefore) {
+			return false
+		}
+	}
+	if len(f.ChunkIndexes) > 0 && !slices.Contains(f.ChunkIndexes, p.ChunkIndex) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// qdrantMatches evaluates the conditions SearchFilter sends to Qdrant against
+// the payload a point is stored with, so both filter paths see the same cases.
+func qdrantMatches(t *testing.T, f *qdrant.Filter, payload map[string]*qdrant.Value) bool {
+	t.Helper()
+	for _, c := range f.GetMust() {
+		field := c.GetField()
+		if field == nil {
+			t.Fatalf("unexpected condition %v", c)
+		}
+		v, ok := payload[field.GetKey()]
+		if !ok {
+			return false
+		}
+		switch {
+		case field.GetMatch() != nil:
+			switch m := field.GetMatch(); m.GetMatchValue().(type) {
+			case *qdrant.Match_Keyword:
+				if v.GetStringValue() != m.GetKeyword() {
+					return false
+				}
+			case *qdrant.Match_Integers:
+				if !slices.Contains(m.GetIntegers().GetIntegers(), v.GetIntegerValue()) {
+					return false
+				}
+			default:
+				t.Fatalf("unexpected match %v", m)
+			}
+		case field.GetDatetimeRange() != nil:
+			r := field.GetDatetimeRange()
+			at, err := time.Parse(time.RFC3339, v.GetStringValue())
+			if err != nil {
+				t.Fatalf("crawled_at is not RFC 3339: %v", err)
+			}
+			if r.Gte != nil && at.Before(r.Gte.AsTime()) || r.Lte != nil && at.After(r.Lte.AsTime()) {
+				return false
+			}
+		default:
+			t.Fatalf("unexpected field condition %v", field)
+		}
+	}
+	return true
+}
+
+func TestSearchFilter(t *testing.T) {
+	crawled := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	point := QdrantPoint{
+		URL:        "https://a.io/post#chunk2",
+		PageURL:    "https://a.io/post",
+		ChunkIndex: 2,
+		Namespace:  "docs",
+		Domain:     "a.io",
+		JobID:      "job-1",
+		Language:   "en",
+		CrawledAt:  crawled,
+		Vector:     []float32{1, 0},
+	}
+	undated := point
+	undated.CrawledAt = time.Time{}
+
+	tests := []struct {
+		name   string
+		filter SearchFilter
+		point  QdrantPoint
+		want   bool
+	}{
+		{"empty filter", SearchFilter{}, point, true},
+		{"keywords match", SearchFilter{Namespace: "docs", Domain: "a.io", JobID: "job-1", Language: "en", PageURL: "https://a.io/post"}, point, true},
+		{"namespace differs", SearchFilter{Namespace: "blog"}, point, false},
+		{"domain differs", SearchFilter{Domain: "b.io"}, point, false},
+		{"job differs", SearchFilter{JobID: "job-2"}, point, false},
+		{"language differs", SearchFilter{Language: "de"}, point, false},
+		{"page differs", SearchFilter{PageURL: "https://a.io/other"}, point, false},
+		{"after, inclusive", SearchFilter{CrawledAfter: crawled}, point, true},
+		{"after, too late", SearchFilter{CrawledAfter: crawled.Add(time.Second)}, point, false},
+		{"before, inclusive", SearchFilter{CrawledBefore: crawled}, point, true},
+		{"before, too early", SearchFilter{CrawledBefore: crawled.Add(-time.Second)}, point, false},
+		{"within range", SearchFilter{CrawledAfter: crawled.Add(-time.Hour), CrawledBefore: crawled.Add(time.Hour)}, point, true},
+		{"outside range", SearchFilter{CrawledAfter: crawled.Add(time.Hour), CrawledBefore: crawled.Add(2 * time.Hour)}, point, false},
+		{"range without crawl time", SearchFilter{CrawledAfter: crawled.Add(-time.Hour)}, undated, false},
+		{"chunk index listed", SearchFilter{ChunkIndexes: []int{0, 2}}, point, true},
+		{"chunk index not listed", SearchFilter{ChunkIndexes: []int{0, 1}}, point, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Matches(tt.point); got != tt.want {
+				t.Errorf("Matches = %v, want %v", got, tt.want)
+			}
+			f := tt.filter.qdrantFilter()
+			if (f == nil) != (tt.name == "empty filter") {
+				t.Errorf("expected a nil Qdrant filter only when nothing is set, got %v", f)
+			}
+			if got := qdrantMatches(t, f, qdrant.NewValueMap(tt.point.payload())); got != tt.want {
+				t.Errorf("Qdrant conditions match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,21 +1,28 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
 
+	"github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
+	"github.com/oranjParker/Rarefactor/internal/config"
 )
 
 type NatsConn struct {
 	Conn *nats.Conn
 	JS   jetstream.JetStream
+
+	server *server.Server
+	// tempDir is the store directory created for this run, removed on Close.
+	tempDir string
 }
 
-func NewNatsConnection() (*NatsConn, error) {
-	url := os.Getenv("NATS_URL")
+func NewNatsConnection(cfg config.NATS) (*NatsConn, error) {
+	url := cfg.URL
 	if url == "" {
 		url = nats.DefaultURL
 	}
@@ -42,8 +49,86 @@ func NewNatsConnection() (*NatsConn, error) {
 	}, nil
 }
 
+// NewEmbeddedNats starts an in-process JetStream server for the Lite profile
+// and connects to it without opening a network listener. Streams are kept in
+// storeDir, or in a temporary directory of their own when it is empty.
+func NewEmbeddedNats(storeDir string) (*NatsConn, error) {
+	var tempDir string
+	if storeDir == "" {
+		dir, err := os.MkdirTemp("", "rarefactor-lite-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create JetStream store dir: %w", err)
+		}
+		storeDir, tempDir = dir, dir
+	}
+	conn, err := startEmbeddedNats(storeDir)
+	if err != nil {
+		if tempDir != "" {
+			_ = os.RemoveAll(tempDir)
+		}
+		return nil, err
+	}
+	conn.tempDir = tempDir
+	return conn, nil
+}
+
+func startEmbeddedNats(storeDir string) (*NatsConn, error) {
+	ns, err := server.NewServer(&server.Options{
+		ServerName: "rarefactor-lite",
+		DontListen: true,
+		JetStream:  true,
+		StoreDir:   storeDir,
+		NoSigs:     true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedded NATS server: %w", err)
+	}
+
+	ns.Start()
+	if !ns.ReadyForConnections(10 * time.Second) {
+		ns.Shutdown()
+		return nil, fmt.Errorf("embedded NATS server did not start")
+	}
+
+	nc, err := nats.Connect("", nats.InProcessServer(ns))
+	if err != nil {
+		ns.Shutdown()
+		return nil, fmt.Errorf("failed to connect to embedded NATS: %w", err)
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		ns.Shutdown()
+		return nil, fmt.Errorf("failed to initialize JetStream: %w", err)
+	}
+
+	return &NatsConn{
+		Conn:   nc,
+		JS:     js,
+		server: ns,
+	}, nil
+}
+
+func (n *NatsConn) Ping(ctx context.Context) error {
+	if status := n.Conn.Status(); status != nats.CONNECTED {
+		return fmt.Errorf("nats connection is %s", status)
+	}
+	if _, err := n.JS.AccountInfo(ctx); err != nil {
+		return fmt.Errorf("jetstream unavailable: %w", err)
+	}
+	return nil
+}
+
 func (n *NatsConn) Close() {
 	if n.Conn != nil {
 		n.Conn.Close()
 	}
+	if n.server != nil {
+		n.server.Shutdown()
+		n.server.WaitForShutdown()
+	}
+	if n.tempDir != "" {
+		_ = os.RemoveAll(n.tempDir)
+	}
 }
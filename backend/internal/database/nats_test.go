@@ -0,0 +1,27 @@
+package database
+
+import (
+	"os"
+	"testing"
+)
+
+func TestNewEmbeddedNats_TempStoreDir(t *testing.T) {
+	a, err := NewEmbeddedNats("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewEmbeddedNats("")
+	if err != nil {
+		a.Close()
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if a.tempDir == "" || a.tempDir == b.tempDir {
+		t.Fatalf("expected each server to get its own store dir, got %q and %q", a.tempDir, b.tempDir)
+	}
+	a.Close()
+	if _, err := os.Stat(a.tempDir); !os.IsNotExist(err) {
+		t.Errorf("expected the store dir to be removed on close, got %v", err)
+	}
+}
@@ -3,23 +3,21 @@ package database
 import (
 	"context"
 	"fmt"
-	"os"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/oranjParker/Rarefactor/internal/config"
 )
 
-func NewPool(ctx context.Context) (*pgxpool.Pool, error) {
-	connStr := os.Getenv("DATABASE_URL")
-
-	config, err := pgxpool.ParseConfig(connStr)
+func NewPool(ctx context.Context, cfg config.Postgres) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(cfg.URL)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse DATABASE_URL: %v", err)
 	}
 
-	config.MaxConns = 20
-	config.MinConns = 5
+	poolConfig.MaxConns = cfg.MaxConns
+	poolConfig.MinConns = cfg.MinConns
 
-	pool, err := pgxpool.NewWithConfig(ctx, config)
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create connection pool: %v", err)
 	}
@@ -2,28 +2,46 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net"
-	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/oranjParker/Rarefactor/internal/config"
 	"github.com/qdrant/go-client/qdrant"
 )
 
+// DefaultSpecTTL is how long a collection's embedding spec is trusted before
+// Spec reads it again, and so how long an alias swap can go unnoticed.
+const DefaultSpecTTL = 10 * time.Second
+
 type QdrantClient struct {
 	Client *qdrant.Client
+	// SpecTTL bounds how stale the spec cache behind Spec may be.
+	SpecTTL time.Duration
+
+	mu    sync.Mutex
+	specs map[string]cachedSpec
+}
+
+type cachedSpec struct {
+	spec    EmbeddingSpec
+	fetched time.Time
 }
 
-func NewQdrantClient(ctx context.Context) (*QdrantClient, error) {
-	addr := os.Getenv("QDRANT_URL")
+func NewQdrantClient(ctx context.Context, cfg config.Qdrant) (*QdrantClient, error) {
+	addr := cfg.URL
 	if addr == "" {
-		fmt.Println("[Qdrant] WARNING: QDRANT_URL env is empty, defaulting to localhost:6334")
+		slog.Warn("qdrant url is empty, defaulting to localhost:6334", "component", "qdrant")
 		addr = "localhost:6334"
 	}
 
-	fmt.Printf("[Qdrant] Attempting to connect to: %s\n", addr)
+	slog.Info("connecting to qdrant", "component", "qdrant", "addr", addr)
 
 	host := "localhost"
 	port := 6334
@@ -50,10 +68,37 @@ func NewQdrantClient(ctx context.Context) (*QdrantClient, error) {
 		return nil, fmt.Errorf("failed to init qdrant client: %w", err)
 	}
 
-	return &QdrantClient{Client: client}, nil
+	return &QdrantClient{Client: client, SpecTTL: DefaultSpecTTL, specs: make(map[string]cachedSpec)}, nil
+}
+
+// EmbeddingSpec identifies the vector space a collection holds. Vectors
+// from different models, sizes or task prefixes do not compare, so they must
+// not share a collection.
+type EmbeddingSpec struct {
+	Model     string
+	Dimension uint64
+	Task      string
 }
 
-func (q *QdrantClient) EnsureCollection(ctx context.Context, name string) error {
+var ErrEmbeddingMismatch = errors.New("embedding does not match the collection")
+
+// Check returns ErrEmbeddingMismatch if vectors described by other cannot go
+// into a collection holding s. A collection created before models were
+// recorded has no model, and only its size is checked.
+func (s EmbeddingSpec) Check(other EmbeddingSpec) error {
+	if s.Dimension != other.Dimension {
+		return fmt.Errorf("%w: collection holds %d dims, got %d", ErrEmbeddingMismatch, s.Dimension, other.Dimension)
+	}
+	if s.Model != "" && (s.Model != other.Model || s.Task != other.Task) {
+		return fmt.Errorf("%w: collection holds %s (%s), got %s (%s)", ErrEmbeddingMismatch, s.Model, s.Task, other.Model, other.Task)
+	}
+	return nil
+}
+
+// EnsureCollection creates name for spec, or checks that the existing
+// collection (or the collection an alias of that name points at) holds the
+// same kind of vectors.
+func (q *QdrantClient) EnsureCollection(ctx context.Context, name string, spec EmbeddingSpec) error {
 	collections, err := q.Client.ListCollections(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to list collections: %w", err)
@@ -66,47 +111,297 @@ func (q *QdrantClient) EnsureCollection(ctx context.Context, name string) error
 			break
 		}
 	}
+	// After a reindex the configured name is an alias of a versioned
+	// collection; creating a collection under it would fail.
+	if !exists {
+		_, exists, err = q.ResolveAlias(ctx, name)
+		if err != nil {
+			return err
+		}
+	}
 
 	if exists {
-		fmt.Printf("[Qdrant] Collection '%s' verified\n", name)
-		return nil
+		current, err := q.CollectionSpec(ctx, name)
+		if err != nil {
+			return err
+		}
+		if err := current.Check(spec); err != nil {
+			return fmt.Errorf("collection %s: %w", name, err)
+		}
+		slog.Info("collection verified", "component", "qdrant", "collection", name, "model", current.Model, "dims", current.Dimension)
+		return q.ensurePayloadIndexes(ctx, name)
 	}
 
-	fmt.Printf("[Qdrant] Creating collection '%s' (768 dims)\n", name)
-	return q.Client.CreateCollection(ctx, &qdrant.CreateCollection{
+	slog.Info("creating collection", "component", "qdrant", "collection", name, "model", spec.Model, "dims", spec.Dimension)
+	err = q.Client.CreateCollection(ctx, &qdrant.CreateCollection{
 		CollectionName: name,
 		VectorsConfig: qdrant.NewVectorsConfig(&qdrant.VectorParams{
-			Size:     768,
+			Size:     spec.Dimension,
 			Distance: qdrant.Distance_Cosine,
 		}),
+		Metadata: qdrant.NewValueMap(map[string]any{
+			"embedding_model": spec.Model,
+			"embedding_task":  spec.Task,
+		}),
 	})
+	if err != nil {
+		return err
+	}
+	return q.ensurePayloadIndexes(ctx, name)
+}
+
+// payloadIndexes are the payload fields SearchFilter conditions on. Without
+// an index Qdrant scans every candidate's payload to apply a filter.
+var payloadIndexes = map[string]qdrant.FieldType{
+	"namespace":   qdrant.FieldType_FieldTypeKeyword,
+	"domain":      qdrant.FieldType_FieldTypeKeyword,
+	"job_id":      qdrant.FieldType_FieldTypeKeyword,
+	"language":    qdrant.FieldType_FieldTypeKeyword,
+	"page_url":    qdrant.FieldType_FieldTypeKeyword,
+	"crawled_at":  qdrant.FieldType_FieldTypeDatetime,
+	"chunk_index": qdrant.FieldType_FieldTypeInteger,
+}
+
+// ensurePayloadIndexes creates the payload indexes a collection is missing,
+// including on collections created before they were introduced.
+func (q *QdrantClient) ensurePayloadIndexes(ctx context.Context, name string) error {
+	info, err := q.Client.GetCollectionInfo(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to read collection %s: %w", name, err)
+	}
+	existing := info.GetPayloadSchema()
+	for field, fieldType := range payloadIndexes {
+		if _, ok := existing[field]; ok {
+			continue
+		}
+		_, err := q.Client.CreateFieldIndex(ctx, &qdrant.CreateFieldIndexCollection{
+			CollectionName: name,
+			Wait:           qdrant.PtrOf(true),
+			FieldName:      field,
+			FieldType:      fieldType.Enum(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to index %s on collection %s: %w", field, name, err)
+		}
+		slog.Info("payload index created", "component", "qdrant", "collection", name, "field", field)
+	}
+	return nil
+}
+
+// CollectionSpec reads the vector size and embedding model a collection was
+// created with.
+func (q *QdrantClient) CollectionSpec(ctx context.Context, name string) (EmbeddingSpec, error) {
+	info, err := q.Client.GetCollectionInfo(ctx, name)
+	if err != nil {
+		return EmbeddingSpec{}, fmt.Errorf("failed to read collection %s: %w", name, err)
+	}
+	metadata := info.GetConfig().GetMetadata()
+	return EmbeddingSpec{
+		Model:     metadata["embedding_model"].GetStringValue(),
+		Dimension: info.GetConfig().GetParams().GetVectorsConfig().GetParams().GetSize(),
+		Task:      metadata["embedding_task"].GetStringValue(),
+	}, nil
+}
+
+// Spec is CollectionSpec cached for SpecTTL, for checks on the read and
+// write paths. name may be an alias; once the cache expires it reflects
+// whichever collection the alias points at by then.
+func (q *QdrantClient) Spec(ctx context.Context, name string) (EmbeddingSpec, error) {
+	q.mu.Lock()
+	cached, ok := q.specs[name]
+	q.mu.Unlock()
+	if ok && time.Since(cached.fetched) < q.SpecTTL {
+		return cached.spec, nil
+	}
+
+	spec, err := q.CollectionSpec(ctx, name)
+	if err != nil {
+		return EmbeddingSpec{}, err
+	}
+	q.mu.Lock()
+	if q.specs == nil {
+		q.specs = make(map[string]cachedSpec)
+	}
+	q.specs[name] = cachedSpec{spec: spec, fetched: time.Now()}
+	q.mu.Unlock()
+	return spec, nil
+}
+
+func (q *QdrantClient) forgetSpec(name string) {
+	q.mu.Lock()
+	delete(q.specs, name)
+	q.mu.Unlock()
+}
+
+// ResolveAlias returns the collection alias points at.
+func (q *QdrantClient) ResolveAlias(ctx context.Context, alias string) (string, bool, error) {
+	aliases, err := q.Client.ListAliases(ctx)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to list aliases: %w", err)
+	}
+	for _, a := range aliases {
+		if a.GetAliasName() == alias {
+			return a.GetCollectionName(), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// NextCollection names the next versioned collection behind alias:
+// documents_v1, documents_v2, ...
+func (q *QdrantClient) NextCollection(ctx context.Context, alias string) (string, error) {
+	collections, err := q.Client.ListCollections(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list collections: %w", err)
+	}
+	prefix := alias + "_v"
+	latest := 0
+	for _, c := range collections {
+		version, ok := strings.CutPrefix(c, prefix)
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(version); err == nil && n > latest {
+			latest = n
+		}
+	}
+	return fmt.Sprintf("%s%d", prefix, latest+1), nil
+}
+
+// SwapAlias points alias at collection in one atomic alias update, so
+// searches and writes move from the old collection to the new one at once. A
+// collection still named like the alias (from before aliases were used) is
+// dropped first; that one switch is not atomic.
+func (q *QdrantClient) SwapAlias(ctx context.Context, alias, collection string) error {
+	legacy, err := q.Client.CollectionExists(ctx, alias)
+	if err != nil {
+		return fmt.Errorf("failed to check collection %s: %w", alias, err)
+	}
+	previous, aliased, err := q.ResolveAlias(ctx, alias)
+	if err != nil {
+		return err
+	}
+	if legacy && !aliased {
+		slog.Warn("dropping unversioned collection to free its name for the alias", "component", "qdrant", "collection", alias)
+		if err := q.Client.DeleteCollection(ctx, alias); err != nil {
+			return fmt.Errorf("failed to drop collection %s: %w", alias, err)
+		}
+	}
+
+	var actions []*qdrant.AliasOperations
+	if aliased {
+		actions = append(actions, &qdrant.AliasOperations{
+			Action: &qdrant.AliasOperations_DeleteAlias{DeleteAlias: &qdrant.DeleteAlias{AliasName: alias}},
+		})
+	}
+	actions = append(actions, &qdrant.AliasOperations{
+		Action: &qdrant.AliasOperations_CreateAlias{CreateAlias: &qdrant.CreateAlias{AliasName: alias, CollectionName: collection}},
+	})
+	if err := q.Client.UpdateAliases(ctx, actions); err != nil {
+		return fmt.Errorf("failed to swap alias %s: %w", alias, err)
+	}
+	q.forgetSpec(alias)
+	slog.Info("alias swapped", "component", "qdrant", "alias", alias, "from", previous, "to", collection)
+	return nil
+}
+
+type QdrantPoint struct {
+	URL     string
+	Title   string
+	Snippet string
+	Vector  []float32
+	// Model, Task and EmbeddedAt record how Vector was produced.
+	Model      string
+	Task       string
+	EmbeddedAt time.Time
+	// PageURL is the page a chunk was cut from, or URL itself for a page.
+	PageURL    string
+	ChunkIndex int
+	Namespace  string
+	Domain     string
+	JobID      string
+	Language   string
+	CrawledAt  time.Time
+}
+
+// Spec describes the vector space the point's vector belongs to.
+func (p QdrantPoint) Spec() EmbeddingSpec {
+	return EmbeddingSpec{Model: p.Model, Dimension: uint64(len(p.Vector)), Task: p.Task}
+}
+
+// payload is what Qdrant stores with the point; SearchFilter conditions
+// match against it.
+func (p QdrantPoint) payload() map[string]any {
+	payload := map[string]any{
+		"url":             p.URL,
+		"title":           p.Title,
+		"snippet":         p.Snippet,
+		"embedding_model": p.Model,
+		"embedding_dims":  len(p.Vector),
+		"embedding_task":  p.Task,
+		"page_url":        p.PageURL,
+		"chunk_index":     p.ChunkIndex,
+		"namespace":       p.Namespace,
+		"domain":          p.Domain,
+	}
+	if !p.EmbeddedAt.IsZero() {
+		payload["embedded_at"] = p.EmbeddedAt.UTC().Format(time.RFC3339)
+	}
+	if p.JobID != "" {
+		payload["job_id"] = p.JobID
+	}
+	if p.Language != "" {
+		payload["language"] = p.Language
+	}
+	if !p.CrawledAt.IsZero() {
+		payload["crawled_at"] = p.CrawledAt.UTC().Format(time.RFC3339)
+	}
+	return payload
 }
 
 func (q *QdrantClient) Upsert(ctx context.Context, collection, url, title, snippet string, vector []float32) error {
-	id := uuid.NewMD5(uuid.NameSpaceURL, []byte(url)).String()
+	return q.UpsertBatch(ctx, collection, []QdrantPoint{{URL: url, PageURL: url, Title: title, Snippet: snippet, Vector: vector}})
+}
+
+func (q *QdrantClient) UpsertBatch(ctx context.Context, collection string, points []QdrantPoint) error {
+	if len(points) == 0 {
+		return nil
+	}
+
+	structs := make([]*qdrant.PointStruct, 0, len(points))
+	for _, p := range points {
+		id := uuid.NewMD5(uuid.NameSpaceURL, []byte(p.URL)).String()
+		structs = append(structs, &qdrant.PointStruct{
+			Id:      qdrant.NewIDUUID(id),
+			Vectors: qdrant.NewVectors(p.Vector...),
+			Payload: qdrant.NewValueMap(p.payload()),
+		})
+	}
 
 	_, err := q.Client.Upsert(ctx, &qdrant.UpsertPoints{
 		CollectionName: collection,
-		Points: []*qdrant.PointStruct{
-			{
-				Id:      qdrant.NewIDUUID(id),
-				Vectors: qdrant.NewVectors(vector...),
-				Payload: qdrant.NewValueMap(map[string]any{
-					"url":     url,
-					"title":   title,
-					"snippet": snippet,
-				}),
-			},
-		},
+		Points:         structs,
 	})
 
 	return err
 }
 
-func (q *QdrantClient) Query(ctx context.Context, collection string, vector []float32, limit uint64) ([]*qdrant.ScoredPoint, error) {
+// Query searches collection for vector among the points filter matches. A
+// query vector from a different model size is refused rather than scored
+// against incomparable vectors; the size comes from the Spec cache.
+func (q *QdrantClient) Query(ctx context.Context, collection string, vector []float32, limit uint64, filter SearchFilter) ([]*qdrant.ScoredPoint, error) {
+	spec, err := q.Spec(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Dimension != uint64(len(vector)) {
+		return nil, fmt.Errorf("%w: collection %s holds %d dims, query has %d", ErrEmbeddingMismatch, collection, spec.Dimension, len(vector))
+	}
+
 	res, err := q.Client.Query(ctx, &qdrant.QueryPoints{
 		CollectionName: collection,
 		Query:          qdrant.NewQuery(vector...),
+		Filter:         filter.qdrantFilter(),
 		Limit:          &limit,
 		WithPayload:    qdrant.NewWithPayload(true),
 	})
@@ -116,6 +411,11 @@ func (q *QdrantClient) Query(ctx context.Context, collection string, vector []fl
 	return res, nil
 }
 
+func (q *QdrantClient) Ping(ctx context.Context) error {
+	_, err := q.Client.HealthCheck(ctx)
+	return err
+}
+
 func (q *QdrantClient) Close() error {
 	return q.Client.Close()
 }
@@ -3,25 +3,20 @@ package database
 import (
 	"context"
 	"fmt"
-	"os"
 	"time"
 
+	"github.com/oranjParker/Rarefactor/internal/config"
 	"github.com/redis/go-redis/v9"
 )
 
-func NewRedisClient(ctx context.Context) (*redis.Client, error) {
-	redisURL := os.Getenv("REDIS_URL")
-	if redisURL == "" {
-		redisURL = "redis://localhost:6379"
-	}
-
-	opts, err := redis.ParseURL(redisURL)
+func NewRedisClient(ctx context.Context, cfg config.Redis) (*redis.Client, error) {
+	opts, err := redis.ParseURL(cfg.URL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse redis url: %w", err)
 	}
 
-	opts.PoolSize = 20
-	opts.MinIdleConns = 5
+	opts.PoolSize = cfg.PoolSize
+	opts.MinIdleConns = cfg.MinIdleConns
 
 	client := redis.NewClient(opts)
 
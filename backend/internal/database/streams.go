@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/oranjParker/Rarefactor/internal/config"
+)
+
+const (
+	controlMaxAge = 24 * time.Hour
+	dlqMaxAge     = 14 * 24 * time.Hour
+)
+
+// ConsumerLimits bound how JetStream redelivers to a durable consumer.
+type ConsumerLimits struct {
+	MaxDeliver    int
+	AckWait       time.Duration
+	MaxAckPending int
+}
+
+func (l ConsumerLimits) Apply(c *jetstream.ConsumerConfig) {
+	c.MaxDeliver = l.MaxDeliver
+	c.AckWait = l.AckWait
+	c.MaxAckPending = l.MaxAckPending
+}
+
+// Topology is the set of streams the workers share: work queues for the
+// frontier and enrichment, and limits-based streams for control events and
+// dead letters. Every worker provisions it idempotently at startup.
+type Topology struct {
+	Frontier   jetstream.StreamConfig
+	Enrichment jetstream.StreamConfig
+	Control    jetstream.StreamConfig
+	DLQ        jetstream.StreamConfig
+	Consumers  ConsumerLimits
+
+	dlqSubject string
+}
+
+func NewTopology(cfg config.NATS) Topology {
+	discard := jetstream.DiscardOld
+	if cfg.DiscardNew {
+		discard = jetstream.DiscardNew
+	}
+
+	workQueue := func(name string, subjects ...string) jetstream.StreamConfig {
+		return jetstream.StreamConfig{
+			Name:       name,
+			Subjects:   subjects,
+			Retention:  jetstream.WorkQueuePolicy,
+			Storage:    jetstream.FileStorage,
+			MaxMsgs:    cfg.MaxMsgs,
+			MaxBytes:   cfg.MaxBytes,
+			Discard:    discard,
+			Duplicates: cfg.DuplicateWindow,
+		}
+	}
+
+	return Topology{
+		Frontier:   workQueue(cfg.FrontierStream, cfg.JobsSubject+".>"),
+		Enrichment: workQueue(cfg.EnrichmentStream, cfg.EnrichmentSubject, cfg.EnrichmentSubject+".>"),
+		Control: jetstream.StreamConfig{
+			Name:      cfg.ControlStream,
+			Subjects:  []string{cfg.ControlSubject + ".>"},
+			Retention: jetstream.LimitsPolicy,
+			Storage:   jetstream.FileStorage,
+			MaxAge:    controlMaxAge,
+		},
+		DLQ: jetstream.StreamConfig{
+			Name:      cfg.DLQStream,
+			Subjects:  []string{cfg.DLQSubject + ".>"},
+			Retention: jetstream.LimitsPolicy,
+			Storage:   jetstream.FileStorage,
+			MaxAge:    dlqMaxAge,
+			MaxBytes:  cfg.MaxBytes,
+			Discard:   jetstream.DiscardOld,
+		},
+		Consumers: ConsumerLimits{
+			MaxDeliver:    cfg.MaxDeliver,
+			AckWait:       cfg.AckWait,
+			MaxAckPending: cfg.MaxAckPending,
+		},
+		dlqSubject: cfg.DLQSubject,
+	}
+}
+
+// DeadLetterSubject is where messages from a stream go once they exhaust
+// MaxDeliver, e.g. crawl.dlq.CRAWL_JOBS.
+func (t Topology) DeadLetterSubject(stream string) string {
+	return t.dlqSubject + "." + stream
+}
+
+// Provision creates or updates every stream. The frontier goes first so an
+// older catch-all CRAWL_JOBS stream is narrowed before its subjects are
+// claimed by the others.
+//
+// Narrowing leaves messages on the dropped subjects (bare crawl.jobs, or
+// crawl.enrichment under the old crawl.> stream) in CRAWL_JOBS with no
+// consumer to read them, so Provision refuses while any are queued. To
+// upgrade, stop the API, let the previous workers drain the stream, then roll
+// out the new workers.
+func (t Topology) Provision(ctx context.Context, js jetstream.JetStream) error {
+	if err := t.checkStranded(ctx, js); err != nil {
+		return err
+	}
+	for _, cfg := range []jetstream.StreamConfig{t.Frontier, t.Enrichment, t.Control, t.DLQ} {
+		if _, err := js.CreateOrUpdateStream(ctx, cfg); err != nil {
+			return fmt.Errorf("stream %s setup failed: %w", cfg.Name, err)
+		}
+		slog.Debug("stream provisioned", "component", "nats", "stream", cfg.Name, "subjects", cfg.Subjects)
+	}
+	return nil
+}
+
+// checkStranded fails if the existing frontier stream holds messages on
+// subjects its new configuration no longer covers.
+func (t Topology) checkStranded(ctx context.Context, js jetstream.JetStream) error {
+	stream, err := js.Stream(ctx, t.Frontier.Name)
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stream %s lookup failed: %w", t.Frontier.Name, err)
+	}
+	info, err := stream.Info(ctx, jetstream.WithSubjectFilter(">"))
+	if err != nil {
+		return fmt.Errorf("stream %s lookup failed: %w", t.Frontier.Name, err)
+	}
+
+	var stranded []string
+	var count uint64
+	for subject, n := range info.State.Subjects {
+		if !slices.ContainsFunc(t.Frontier.Subjects, func(filter string) bool { return subjectMatches(filter, subject) }) {
+			stranded = append(stranded, subject)
+			count += n
+		}
+	}
+	if len(stranded) > 0 {
+		slices.Sort(stranded)
+		return fmt.Errorf("stream %s holds %d messages on %v, which the new subjects %v would strand: drain them with the previous workers before upgrading",
+			t.Frontier.Name, count, stranded, t.Frontier.Subjects)
+	}
+	return nil
+}
+
+// subjectMatches reports whether subject falls under filter, which may use
+// the * and > wildcards.
+func subjectMatches(filter, subject string) bool {
+	f, s := strings.Split(filter, "."), strings.Split(subject, ".")
+	for i, token := range f {
+		if token == ">" {
+			return len(s) > i
+		}
+		if i >= len(s) || token != "*" && token != s[i] {
+			return false
+		}
+	}
+	return len(f) == len(s)
+}
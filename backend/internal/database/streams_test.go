@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/oranjParker/Rarefactor/internal/config"
+)
+
+func TestSubjectMatches(t *testing.T) {
+	tests := []struct {
+		filter, subject string
+		want            bool
+	}{
+		{"crawl.jobs.>", "crawl.jobs.p0.3", true},
+		{"crawl.jobs.>", "crawl.jobs", false},
+		{"crawl.jobs", "crawl.jobs", true},
+		{"crawl.*", "crawl.jobs", true},
+		{"crawl.*", "crawl.jobs.p0", false},
+		{"crawl.enrichment", "crawl.jobs", false},
+	}
+	for _, tt := range tests {
+		if got := subjectMatches(tt.filter, tt.subject); got != tt.want {
+			t.Errorf("subjectMatches(%q, %q) = %v, want %v", tt.filter, tt.subject, got, tt.want)
+		}
+	}
+}
+
+func TestProvision_RefusesToStrandMessages(t *testing.T) {
+	ctx := context.Background()
+	nt, err := NewEmbeddedNats(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nt.Close()
+
+	// The stream as provisioned before the topology split.
+	cfg := config.Default().NATS
+	legacy, err := nt.JS.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:      cfg.FrontierStream,
+		Subjects:  []string{"crawl.>"},
+		Retention: jetstream.WorkQueuePolicy,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nt.JS.Publish(ctx, cfg.JobsSubject, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	topology := NewTopology(cfg)
+	err = topology.Provision(ctx, nt.JS)
+	if err == nil || !strings.Contains(err.Error(), cfg.JobsSubject) {
+		t.Fatalf("expected Provision to refuse while %s has messages, got %v", cfg.JobsSubject, err)
+	}
+
+	if err := legacy.Purge(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := topology.Provision(ctx, nt.JS); err != nil {
+		t.Fatalf("expected a drained stream to be narrowed, got %v", err)
+	}
+}
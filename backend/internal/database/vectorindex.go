@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+type ScoredPoint struct {
+	QdrantPoint
+	Score float32
+}
+
+// MemoryVectorIndex is an in-process stand-in for Qdrant used by the Lite
+// profile. Points are keyed by URL per collection and searched by brute-force
+// cosine similarity, which is fine for the few thousand pages of a laptop run.
+// Like a Qdrant collection, each collection takes the embedding of its first
+// point and refuses others.
+type MemoryVectorIndex struct {
+	mu          sync.RWMutex
+	collections map[string]map[string]QdrantPoint
+	specs       map[string]EmbeddingSpec
+}
+
+func NewMemoryVectorIndex() *MemoryVectorIndex {
+	return &MemoryVectorIndex{
+		collections: make(map[string]map[string]QdrantPoint),
+		specs:       make(map[string]EmbeddingSpec),
+	}
+}
+
+func (m *MemoryVectorIndex) UpsertBatch(ctx context.Context, collection string, points []QdrantPoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(points) == 0 {
+		return nil
+	}
+	spec, ok := m.specs[collection]
+	if !ok {
+		spec = points[0].Spec()
+	}
+	for _, p := range points {
+		if err := spec.Check(p.Spec()); err != nil {
+			return fmt.Errorf("collection %s: %w", collection, err)
+		}
+	}
+	m.specs[collection] = spec
+
+	c, ok := m.collections[collection]
+	if !ok {
+		c = make(map[string]QdrantPoint)
+		m.collections[collection] = c
+	}
+	for _, p := range points {
+		c[p.URL] = p
+	}
+	return nil
+}
+
+// Search scores the points filter matches against vector, best first.
+func (m *MemoryVectorIndex) Search(ctx context.Context, collection string, vector []float32, limit int, filter SearchFilter) ([]ScoredPoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if spec, ok := m.specs[collection]; ok && spec.Dimension != uint64(len(vector)) {
+		return nil, fmt.Errorf("%w: collection %s holds %d dims, query has %d", ErrEmbeddingMismatch, collection, spec.Dimension, len(vector))
+	}
+
+	results := make([]ScoredPoint, 0, len(m.collections[collection]))
+	for _, p := range m.collections[collection] {
+		if !filter.Matches(p) {
+			continue
+		}
+		results = append(results, ScoredPoint{QdrantPoint: p, Score: cosine(vector, p.Vector)})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (m *MemoryVectorIndex) Len(collection string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.collections[collection])
+}
+
+func cosine(a, b []float32) float32 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return float32(dot / (math.Sqrt(na) * math.Sqrt(nb)))
+}
@@ -0,0 +1,25 @@
+package frontier
+
+import (
+	"context"
+	"time"
+)
+
+// Store holds the crawl state shared by discovery workers: which URLs have
+// been claimed, how many pages each domain has used, and cached robots.txt
+// bodies. RedisStore coordinates a fleet; MemoryStore serves a single process.
+type Store interface {
+	// MarkVisited claims url and reports whether this caller was first.
+	MarkVisited(ctx context.Context, url string, ttl time.Duration) (bool, error)
+	ForgetVisited(ctx context.Context, url string) error
+
+	// AcquirePage takes one page of the domain's quota and returns the new
+	// count, or ok=false without changing it once limit is reached.
+	AcquirePage(ctx context.Context, domain string, limit int) (count int64, ok bool, err error)
+	ReleasePage(ctx context.Context, domain string) error
+
+	// Robots returns the cached robots.txt body for host. An empty body with
+	// found=true means the host has none.
+	Robots(ctx context.Context, host string) (body string, found bool, err error)
+	SetRobots(ctx context.Context, host, body string, ttl time.Duration) error
+}
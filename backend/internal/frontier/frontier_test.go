@@ -0,0 +1,222 @@
+package frontier
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeRedis implements RedisClient over maps, evaluating the acquire script
+// natively so RedisStore can be checked against the same suite as MemoryStore.
+type fakeRedis struct {
+	strings map[string]string
+	hashes  map[string]map[string]int64
+	evals   int
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{strings: map[string]string{}, hashes: map[string]map[string]int64{}}
+}
+
+func (f *fakeRedis) SetNX(ctx context.Context, key string, value interface{}, exp time.Duration) *redis.BoolCmd {
+	cmd := redis.NewBoolCmd(ctx)
+	if _, ok := f.strings[key]; ok {
+		cmd.SetVal(false)
+		return cmd
+	}
+	f.strings[key] = value.(string)
+	cmd.SetVal(true)
+	return cmd
+}
+
+func (f *fakeRedis) Get(ctx context.Context, key string) *redis.StringCmd {
+	cmd := redis.NewStringCmd(ctx)
+	v, ok := f.strings[key]
+	if !ok {
+		cmd.SetErr(redis.Nil)
+		return cmd
+	}
+	cmd.SetVal(v)
+	return cmd
+}
+
+func (f *fakeRedis) Set(ctx context.Context, key string, value interface{}, exp time.Duration) *redis.StatusCmd {
+	f.strings[key] = value.(string)
+	return redis.NewStatusCmd(ctx)
+}
+
+func (f *fakeRedis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	f.evals++
+	cmd := redis.NewCmd(ctx)
+	h := f.hashes[keys[0]]
+	if h == nil {
+		h = map[string]int64{}
+		f.hashes[keys[0]] = h
+	}
+	field, limit := args[0].(string), args[1].(int)
+	if h[field] >= int64(limit) {
+		cmd.SetVal(int64(-1))
+		return cmd
+	}
+	h[field]++
+	cmd.SetVal(h[field])
+	return cmd
+}
+
+func (f *fakeRedis) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	for _, k := range keys {
+		delete(f.strings, k)
+	}
+	return redis.NewIntCmd(ctx)
+}
+
+func (f *fakeRedis) HIncrBy(ctx context.Context, key, field string, incr int64) *redis.IntCmd {
+	if f.hashes[key] == nil {
+		f.hashes[key] = map[string]int64{}
+	}
+	f.hashes[key][field] += incr
+	return redis.NewIntCmd(ctx)
+}
+
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	t.Run("visited", func(t *testing.T) {
+		if first, err := s.MarkVisited(ctx, "https://a.io/", time.Hour); err != nil || !first {
+			t.Fatalf("expected first claim to win, got %v (%v)", first, err)
+		}
+		if first, _ := s.MarkVisited(ctx, "https://a.io/", time.Hour); first {
+			t.Error("expected second claim to lose")
+		}
+		if err := s.ForgetVisited(ctx, "https://a.io/"); err != nil {
+			t.Fatal(err)
+		}
+		if first, _ := s.MarkVisited(ctx, "https://a.io/", time.Hour); !first {
+			t.Error("expected a forgotten url to be claimable again")
+		}
+	})
+
+	t.Run("quota", func(t *testing.T) {
+		for i := 1; i <= 2; i++ {
+			count, ok, err := s.AcquirePage(ctx, "a.io", 2)
+			if err != nil || !ok || count != int64(i) {
+				t.Fatalf("acquire %d: got count=%d ok=%v err=%v", i, count, ok, err)
+			}
+		}
+		if _, ok, _ := s.AcquirePage(ctx, "a.io", 2); ok {
+			t.Fatal("expected quota to be exhausted")
+		}
+		if err := s.ReleasePage(ctx, "a.io"); err != nil {
+			t.Fatal(err)
+		}
+		if count, ok, _ := s.AcquirePage(ctx, "a.io", 2); !ok || count != 2 {
+			t.Errorf("expected a released page to be reusable, got count=%d ok=%v", count, ok)
+		}
+		if count, ok, _ := s.AcquirePage(ctx, "b.io", 2); !ok || count != 1 {
+			t.Errorf("expected domains to be counted separately, got count=%d", count)
+		}
+	})
+
+	t.Run("robots", func(t *testing.T) {
+		if _, found, err := s.Robots(ctx, "a.io"); err != nil || found {
+			t.Fatalf("expected a cache miss, got found=%v err=%v", found, err)
+		}
+		if err := s.SetRobots(ctx, "a.io", "", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if body, found, _ := s.Robots(ctx, "a.io"); !found || body != "" {
+			t.Errorf("expected a cached empty robots.txt, got %q found=%v", body, found)
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestRedisStore(t *testing.T) {
+	rdb := newFakeRedis()
+	testStore(t, NewRedisStore(rdb))
+
+	if rdb.evals == 0 {
+		t.Error("expected page quota to go through the Lua script")
+	}
+	if got := rdb.hashes[CountKey]["a.io"]; got != 2 {
+		t.Errorf("expected counts under %s, got %d", CountKey, got)
+	}
+}
+
+func TestMemoryStore_Expiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	_, _ = s.MarkVisited(ctx, "https://a.io/", time.Minute)
+	_ = s.SetRobots(ctx, "a.io", "User-agent: *", time.Minute)
+
+	now = now.Add(2 * time.Minute)
+	if first, _ := s.MarkVisited(ctx, "https://a.io/", time.Minute); !first {
+		t.Error("expected an expired visit to be claimable again")
+	}
+	if _, found, _ := s.Robots(ctx, "a.io"); found {
+		t.Error("expected robots.txt cache entry to expire")
+	}
+}
+
+func TestLevel(t *testing.T) {
+	cases := []struct {
+		name        string
+		depth       int
+		domainPages int64
+		priority    int
+		want        int
+	}{
+		{"seed", 0, 0, 0, 1},
+		{"urgent seed", 0, 0, 1, 0},
+		{"shallow page on a fresh domain", 1, 1, 0, 1},
+		{"two hops deep", 2, 5, 0, 2},
+		{"deep page on a giant site", 3, 5000, 0, 3},
+		{"deep page of an urgent job", 3, 50, 2, 1},
+		{"negative priority", 0, 0, -5, 3},
+	}
+	for _, tc := range cases {
+		if got := Level(tc.depth, tc.domainPages, tc.priority); got != tc.want {
+			t.Errorf("%s: Level(%d, %d, %d) = %d, want %d", tc.name, tc.depth, tc.domainPages, tc.priority, got, tc.want)
+		}
+	}
+}
+
+func TestSubjectFor(t *testing.T) {
+	route := SubjectFor("crawl.jobs", 8)
+	doc := &core.Document[string]{ID: "https://example.com/a", Depth: 2, Metadata: map[string]any{"domain_pages": float64(20), "priority": float64(1)}}
+	want := Subject("crawl.jobs", 2, Shard(doc.ID, 8))
+	if got := route(doc); got != want {
+		t.Errorf("expected decoded JSON metadata to be honoured, got %s want %s", got, want)
+	}
+}
+
+func TestShard(t *testing.T) {
+	if Shard("https://blog.example.com/a", 16) != Shard("https://www.example.com/b", 16) {
+		t.Error("expected hosts of one registrable domain to share a shard")
+	}
+	if got := Shard("https://example.com", 1); got != 0 {
+		t.Errorf("expected a single shard to be 0, got %d", got)
+	}
+
+	seen := map[int]bool{}
+	for i := 0; i < 200; i++ {
+		shard := Shard(fmt.Sprintf("https://site%d.org/", i), 8)
+		if shard < 0 || shard >= 8 {
+			t.Fatalf("shard %d out of range", shard)
+		}
+		seen[shard] = true
+	}
+	if len(seen) != 8 {
+		t.Errorf("expected distinct hosts to spread over all 8 shards, hit %d", len(seen))
+	}
+}
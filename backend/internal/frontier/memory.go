@@ -0,0 +1,98 @@
+package frontier
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type robotsEntry struct {
+	body    string
+	expires time.Time
+}
+
+// MemoryStore implements Store in process with the same semantics as the
+// Redis scripts, for tests and the Lite profile. State is lost on restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	visited map[string]time.Time
+	counts  map[string]int64
+	robots  map[string]robotsEntry
+	now     func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		visited: make(map[string]time.Time),
+		counts:  make(map[string]int64),
+		robots:  make(map[string]robotsEntry),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) MarkVisited(ctx context.Context, url string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if expires, ok := s.visited[url]; ok && (expires.IsZero() || now.Before(expires)) {
+		return false, nil
+	}
+	s.visited[url] = expiry(now, ttl)
+	return true, nil
+}
+
+func (s *MemoryStore) ForgetVisited(ctx context.Context, url string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.visited, url)
+	return nil
+}
+
+func (s *MemoryStore) AcquirePage(ctx context.Context, domain string, limit int) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.counts[domain] >= int64(limit) {
+		return 0, false, nil
+	}
+	s.counts[domain]++
+	return s.counts[domain], true, nil
+}
+
+func (s *MemoryStore) ReleasePage(ctx context.Context, domain string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[domain]--
+	return nil
+}
+
+func (s *MemoryStore) Robots(ctx context.Context, host string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.robots[host]
+	if !ok {
+		return "", false, nil
+	}
+	if !entry.expires.IsZero() && !s.now().Before(entry.expires) {
+		delete(s.robots, host)
+		return "", false, nil
+	}
+	return entry.body, true, nil
+}
+
+func (s *MemoryStore) SetRobots(ctx context.Context, host, body string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.robots[host] = robotsEntry{body: body, expires: expiry(s.now(), ttl)}
+	return nil
+}
+
+// expiry mirrors Redis, where a zero TTL means the key never expires.
+func expiry(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
@@ -0,0 +1,60 @@
+package frontier
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/oranjParker/Rarefactor/internal/core"
+)
+
+// Levels is the number of priority subjects (base.p0 .. base.p3); p0 is
+// served first.
+const Levels = 4
+
+// DefaultWeights is how many messages each level may take per round when all
+// levels have work, so lower levels are slowed rather than starved.
+var DefaultWeights = []int{8, 4, 2, 1}
+
+// Level ranks a page for the frontier. Seeds start at level 1; every two hops
+// of depth and every order of magnitude of pages already taken from the
+// domain push a page one level down, and each point of job priority lifts it
+// one level up.
+func Level(depth int, domainPages int64, jobPriority int) int {
+	level := 1 + depth/2 + int(math.Log10(float64(max(domainPages, 0))+1)) - jobPriority
+	return min(max(level, 0), Levels-1)
+}
+
+// Subject names the queue for a priority level and host shard, e.g.
+// crawl.jobs.p1.5.
+func Subject(base string, level, shard int) string {
+	return fmt.Sprintf("%s.p%d.%d", base, level, shard)
+}
+
+// LevelOf reads the inputs to Level from a document: its depth and the
+// "domain_pages" and "priority" metadata set by politeness and the API.
+func LevelOf(doc *core.Document[string]) int {
+	return Level(doc.Depth, int64(intValue(doc.Metadata["domain_pages"])), intValue(doc.Metadata["priority"]))
+}
+
+// SubjectFor routes documents to their priority level and host shard under
+// base.
+func SubjectFor(base string, shards int) func(doc *core.Document[string]) string {
+	return func(doc *core.Document[string]) string {
+		return Subject(base, LevelOf(doc), Shard(doc.ID, shards))
+	}
+}
+
+// intValue accepts both in-process ints and float64 from decoded JSON.
+func intValue(v any) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+package frontier
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	VisitedPrefix = "visited:"
+	RobotsPrefix  = "robots:"
+	CountKey      = "crawl_counts"
+)
+
+// acquireScript increments a domain's page count unless it has reached the
+// limit, in which case it returns -1.
+const acquireScript = `
+	local current = tonumber(redis.call("HGET", KEYS[1], ARGV[1]) or "0")
+	if current >= tonumber(ARGV[2]) then
+		return -1
+	end
+	return redis.call("HINCRBY", KEYS[1], ARGV[1], 1)
+`
+
+type RedisClient interface {
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	HIncrBy(ctx context.Context, key, field string, incr int64) *redis.IntCmd
+}
+
+type RedisStore struct {
+	client RedisClient
+}
+
+func NewRedisStore(client RedisClient) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) MarkVisited(ctx context.Context, url string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, VisitedPrefix+url, "1", ttl).Result()
+}
+
+func (s *RedisStore) ForgetVisited(ctx context.Context, url string) error {
+	return s.client.Del(ctx, VisitedPrefix+url).Err()
+}
+
+func (s *RedisStore) AcquirePage(ctx context.Context, domain string, limit int) (int64, bool, error) {
+	res, err := s.client.Eval(ctx, acquireScript, []string{CountKey}, domain, limit).Int64()
+	if err != nil {
+		return 0, false, err
+	}
+	if res == -1 {
+		return 0, false, nil
+	}
+	return res, true, nil
+}
+
+func (s *RedisStore) ReleasePage(ctx context.Context, domain string) error {
+	return s.client.HIncrBy(ctx, CountKey, domain, -1).Err()
+}
+
+func (s *RedisStore) Robots(ctx context.Context, host string) (string, bool, error) {
+	data, err := s.client.Get(ctx, RobotsPrefix+host).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return data, true, nil
+}
+
+func (s *RedisStore) SetRobots(ctx context.Context, host, body string, ttl time.Duration) error {
+	return s.client.Set(ctx, RobotsPrefix+host, body, ttl).Err()
+}
@@ -0,0 +1,31 @@
+package frontier
+
+import (
+	"hash/fnv"
+
+	"github.com/oranjParker/Rarefactor/internal/utils"
+)
+
+// DefaultShards is the number of host partitions per priority level. Workers
+// and the API must agree on it; lowering it strands messages in the dropped
+// shards until it is raised again.
+const DefaultShards = 8
+
+// DefaultSubject is the subject prefix seeds and discovered links are
+// published under when nats.jobs_subject is not configured.
+const DefaultSubject = "crawl.jobs"
+
+// Shard partitions URLs by registrable domain, the unit politeness limits, so
+// one busy site fills a single shard while the others stay eligible.
+func Shard(rawURL string, shards int) int {
+	if shards <= 1 {
+		return 0
+	}
+	domain, err := utils.GetBaseDomain(rawURL)
+	if err != nil || domain == "" {
+		domain = rawURL
+	}
+	h := fnv.New32a()
+	h.Write([]byte(domain))
+	return int(h.Sum32() % uint32(shards))
+}
@@ -0,0 +1,217 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	DefaultCheckTimeout = 2 * time.Second
+	DefaultStallTimeout = 5 * time.Minute
+)
+
+// ProgressReporter is satisfied by core.GraphRunner.
+type ProgressReporter interface {
+	Progress() (inFlight int64, last time.Time)
+}
+
+type CheckFunc func(ctx context.Context) error
+
+type namedCheck struct {
+	name string
+	fn   CheckFunc
+}
+
+type namedRunner struct {
+	name   string
+	runner ProgressReporter
+}
+
+// Checker backs the /readyz (dependencies) and /healthz (runner liveness)
+// endpoints. A runner is considered stuck when it has items in flight but has
+// not finished one within StallTimeout.
+type Checker struct {
+	CheckTimeout time.Duration
+	StallTimeout time.Duration
+
+	mu      sync.RWMutex
+	checks  []namedCheck
+	runners []namedRunner
+	now     func() time.Time
+}
+
+func NewChecker() *Checker {
+	return &Checker{
+		CheckTimeout: DefaultCheckTimeout,
+		StallTimeout: DefaultStallTimeout,
+		now:          time.Now,
+	}
+}
+
+func (c *Checker) AddCheck(name string, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, namedCheck{name: name, fn: fn})
+}
+
+func (c *Checker) AddRunner(name string, r ProgressReporter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.runners = append(c.runners, namedRunner{name: name, runner: r})
+}
+
+type RunnerStatus struct {
+	InFlight     int64     `json:"in_flight"`
+	LastProgress time.Time `json:"last_progress"`
+	Status       string    `json:"status"`
+}
+
+type Report struct {
+	Status  string                  `json:"status"`
+	Checks  map[string]string       `json:"checks,omitempty"`
+	Runners map[string]RunnerStatus `json:"runners,omitempty"`
+}
+
+func (r Report) OK() bool {
+	return r.Status == "ok"
+}
+
+// Ready runs every dependency check concurrently.
+func (c *Checker) Ready(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := append([]namedCheck(nil), c.checks...)
+	c.mu.RUnlock()
+
+	report := Report{Status: "ok", Checks: make(map[string]string, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, chk := range checks {
+		wg.Add(1)
+		go func(chk namedCheck) {
+			defer wg.Done()
+			err := c.run(ctx, chk.fn)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				report.Status = "fail"
+				report.Checks[chk.name] = err.Error()
+				return
+			}
+			report.Checks[chk.name] = "ok"
+		}(chk)
+	}
+	wg.Wait()
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, fn CheckFunc) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, c.CheckTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("check panicked: %v", r)
+			}
+		}()
+		done <- fn(ctx)
+	}()
+
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return errors.New("check timed out")
+	}
+}
+
+// Live reports whether every registered runner is making progress.
+func (c *Checker) Live() Report {
+	c.mu.RLock()
+	runners := append([]namedRunner(nil), c.runners...)
+	c.mu.RUnlock()
+
+	report := Report{Status: "ok", Runners: make(map[string]RunnerStatus, len(runners))}
+	for _, r := range runners {
+		inFlight, last := r.runner.Progress()
+		status := RunnerStatus{InFlight: inFlight, LastProgress: last, Status: "ok"}
+		if inFlight > 0 && !last.IsZero() && c.now().Sub(last) > c.StallTimeout {
+			status.Status = "stalled"
+			report.Status = "fail"
+		}
+		report.Runners[r.name] = status
+	}
+	return report
+}
+
+func (c *Checker) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, c.Live())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, c.Ready(r.Context()))
+	})
+	return mux
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	if !report.OK() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// Serve exposes /healthz and /readyz on addr until ctx is cancelled.
+func Serve(ctx context.Context, addr string, c *Checker) {
+	srv := &http.Server{Addr: addr, Handler: c.Handler(), ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("serving health endpoints", "component", "health", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("health server failed", "component", "health", "error", err)
+	}
+}
+
+// WatchGRPC keeps a gRPC health server's status for each service in step with
+// the readiness checks until ctx is cancelled.
+func WatchGRPC(ctx context.Context, hs *health.Server, c *Checker, interval time.Duration, services ...string) {
+	services = append([]string{""}, services...)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		status := healthpb.HealthCheckResponse_SERVING
+		if report := c.Ready(ctx); !report.OK() {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		for _, svc := range services {
+			hs.SetServingStatus(svc, status)
+		}
+
+		select {
+		case <-ctx.Done():
+			hs.Shutdown()
+			return
+		case <-ticker.C:
+		}
+	}
+}
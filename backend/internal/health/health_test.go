@@ -0,0 +1,126 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type fakeRunner struct {
+	inFlight int64
+	last     time.Time
+}
+
+func (f *fakeRunner) Progress() (int64, time.Time) { return f.inFlight, f.last }
+
+func TestChecker_Ready(t *testing.T) {
+	c := NewChecker()
+	c.CheckTimeout = 50 * time.Millisecond
+	c.AddCheck("postgres", func(ctx context.Context) error { return nil })
+	c.AddCheck("redis", func(ctx context.Context) error { return errors.New("connection refused") })
+	c.AddCheck("qdrant", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+
+	report := c.Ready(context.Background())
+	if report.OK() {
+		t.Fatal("expected readiness to fail")
+	}
+	if report.Checks["postgres"] != "ok" {
+		t.Errorf("postgres = %q, want ok", report.Checks["postgres"])
+	}
+	if report.Checks["redis"] != "connection refused" {
+		t.Errorf("redis = %q", report.Checks["redis"])
+	}
+	if report.Checks["qdrant"] != "check timed out" {
+		t.Errorf("qdrant = %q", report.Checks["qdrant"])
+	}
+}
+
+func TestChecker_Live(t *testing.T) {
+	now := time.Now()
+	c := NewChecker()
+	c.StallTimeout = time.Minute
+	c.now = func() time.Time { return now }
+
+	idle := &fakeRunner{inFlight: 0, last: now.Add(-time.Hour)}
+	c.AddRunner("idle", idle)
+	if report := c.Live(); !report.OK() {
+		t.Errorf("idle runner should be live: %+v", report)
+	}
+
+	stuck := &fakeRunner{inFlight: 3, last: now.Add(-2 * time.Minute)}
+	c.AddRunner("stuck", stuck)
+	report := c.Live()
+	if report.OK() || report.Runners["stuck"].Status != "stalled" || report.Runners["idle"].Status != "ok" {
+		t.Errorf("expected stuck runner to fail liveness: %+v", report)
+	}
+}
+
+func TestChecker_Handler(t *testing.T) {
+	c := NewChecker()
+	var failing atomic.Bool
+	c.AddCheck("nats", func(ctx context.Context) error {
+		if failing.Load() {
+			return errors.New("disconnected")
+		}
+		return nil
+	})
+	srv := httptest.NewServer(c.Handler())
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		path    string
+		failing bool
+		want    int
+	}{
+		{"/healthz", false, http.StatusOK},
+		{"/readyz", false, http.StatusOK},
+		{"/readyz", true, http.StatusServiceUnavailable},
+	} {
+		failing.Store(tc.failing)
+		resp, err := http.Get(srv.URL + tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s (failing=%v) = %d, want %d", tc.path, tc.failing, resp.StatusCode, tc.want)
+		}
+	}
+}
+
+func TestWatchGRPC(t *testing.T) {
+	c := NewChecker()
+	c.AddCheck("postgres", func(ctx context.Context) error { return errors.New("down") })
+	hs := health.NewServer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		WatchGRPC(ctx, hs, c, time.Hour, "crawler")
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		resp, err := hs.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "crawler"})
+		if err == nil && resp.Status == healthpb.HealthCheckResponse_NOT_SERVING {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected NOT_SERVING, got %v (%v)", resp, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+}
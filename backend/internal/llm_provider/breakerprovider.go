@@ -0,0 +1,32 @@
+package llm_provider
+
+import (
+	"context"
+
+	"github.com/oranjParker/Rarefactor/internal/core"
+)
+
+type generator interface {
+	Generate(ctx context.Context, prompt string) (string, error)
+}
+
+// BreakerProvider wraps any provider so an unreachable LLM fails fast instead
+// of every document waiting out the full request timeout.
+type BreakerProvider struct {
+	Provider generator
+	Breaker  *core.CircuitBreaker
+}
+
+func NewBreakerProvider(provider generator, breaker *core.CircuitBreaker) *BreakerProvider {
+	return &BreakerProvider{Provider: provider, Breaker: breaker}
+}
+
+func (b *BreakerProvider) Generate(ctx context.Context, prompt string) (string, error) {
+	var text string
+	err := b.Breaker.Execute(ctx, func(ctx context.Context) error {
+		var genErr error
+		text, genErr = b.Provider.Generate(ctx, prompt)
+		return genErr
+	})
+	return text, err
+}
@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "rarefactor"
+
+var (
+	NodeItemsIn = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "graph",
+		Name:      "node_items_in_total",
+		Help:      "Items received by a graph node.",
+	}, []string{"graph", "node"})
+
+	NodeItemsOut = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "graph",
+		Name:      "node_items_out_total",
+		Help:      "Items emitted by a graph node.",
+	}, []string{"graph", "node"})
+
+	NodeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "graph",
+		Name:      "node_errors_total",
+		Help:      "Node failures after retries, by error class.",
+	}, []string{"graph", "node", "class"})
+
+	NodeLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "graph",
+		Name:      "node_duration_seconds",
+		Help:      "Time spent in a node's processor and sink, including retries.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 16),
+	}, []string{"graph", "node"})
+
+	NodeInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "graph",
+		Name:      "node_in_flight",
+		Help:      "Items currently executing in a node.",
+	}, []string{"graph", "node"})
+
+	NatsMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "nats_source",
+		Name:      "messages_total",
+		Help:      "JetStream messages handled by a source, by outcome (delivered, in_progress, ack, nak, term, requeue, dead_letter).",
+	}, []string{"subject", "outcome"})
+
+	NatsRedeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "nats_source",
+		Name:      "redeliveries_total",
+		Help:      "Messages received with a delivery count above one.",
+	}, []string{"subject"})
+
+	NatsDeliveryCount = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "nats_source",
+		Name:      "delivery_count",
+		Help:      "JetStream delivery attempt number of received messages.",
+		Buckets:   []float64{1, 2, 3, 5, 10, 20},
+	}, []string{"subject"})
+
+	PostgresBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "postgres_sink",
+		Name:      "batch_size",
+		Help:      "Documents per flushed batch.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+	})
+
+	PostgresFlushLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "postgres_sink",
+		Name:      "flush_duration_seconds",
+		Help:      "Time to execute a flushed batch.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 16),
+	})
+
+	PostgresFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "postgres_sink",
+		Name:      "failed_items_total",
+		Help:      "Documents whose write failed.",
+	})
+
+	PostgresRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "postgres_sink",
+		Name:      "batch_retries_total",
+		Help:      "Batches re-sent after a transient error.",
+	})
+
+	PostgresBuffered = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "postgres_sink",
+		Name:      "buffered_items",
+		Help:      "Documents buffered or in flight, capped by postgres.max_buffered.",
+	})
+
+	PolitenessDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "politeness",
+		Name:      "decisions_total",
+		Help:      "Politeness outcomes (allowed, duplicate, delayed, robots_blocked, quota, depth).",
+	}, []string{"decision"})
+)
+
+// GraphObserver reports GraphRunner node events to Prometheus.
+type GraphObserver struct{}
+
+func (GraphObserver) ItemStarted(graph, node string) {
+	NodeItemsIn.WithLabelValues(graph, node).Inc()
+	NodeInFlight.WithLabelValues(graph, node).Inc()
+}
+
+func (GraphObserver) ItemFinished(graph, node string, outputs int, elapsed time.Duration, err error) {
+	NodeInFlight.WithLabelValues(graph, node).Dec()
+	NodeLatency.WithLabelValues(graph, node).Observe(elapsed.Seconds())
+	NodeItemsOut.WithLabelValues(graph, node).Add(float64(outputs))
+	if err != nil {
+		NodeErrors.WithLabelValues(graph, node, core.ErrorClass(err)).Inc()
+	}
+}
+
+// RegisterNodeStats exports each node's retry counters.
+func RegisterNodeStats(graph string, nodes map[string]core.Vertex) {
+	for name, v := range nodes {
+		stats := v.Stats()
+		labels := prometheus.Labels{"graph": graph, "node": name}
+		for metric, load := range map[string]func() int64{
+			"attempts": stats.Attempts.Load,
+			"retries":  stats.Retries.Load,
+			"failures": stats.Failures.Load,
+			"panics":   stats.Panics.Load,
+			"timeouts": stats.Timeouts.Load,
+		} {
+			load := load
+			prometheus.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Namespace:   namespace,
+				Subsystem:   "graph",
+				Name:        "node_" + metric + "_total",
+				Help:        "Per-node execution " + metric + ".",
+				ConstLabels: labels,
+			}, func() float64 { return float64(load()) }))
+		}
+	}
+}
+
+// Serve exposes /metrics on addr until ctx is cancelled.
+func Serve(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("serving prometheus metrics", "component", "metrics", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("metrics server failed", "component", "metrics", "error", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/oranjParker/Rarefactor/internal/core"
 )
@@ -33,14 +34,22 @@ func (p *ChunkerProcessor) Process(ctx context.Context, doc *core.Document[strin
 	rawChunks := p.splitRecursive(doc.Content, p.Delimiters)
 
 	filtered := filterEmptyChunks(rawChunks)
-	doc.CT.Add(len(filtered))
 
 	var processedChunks []*core.Document[string]
+	offset := 0
 	for i, chunkText := range filtered {
-		chunkID := fmt.Sprintf("%s#chunk%d", doc.ID, i)
+		// Chunks are substrings of the content in order; the fixed-size
+		// fallback may overlap the previous chunk by up to Overlap runes.
+		start := offset
+		if idx := strings.Index(doc.Content[offset:], chunkText); idx >= 0 {
+			start += idx
+		}
+		end := start + len(chunkText)
+		offset = min(max(start+1, end-utf8.UTFMax*p.Overlap), len(doc.Content))
+
 		newDoc := doc.Clone()
 
-		newDoc.ID = chunkID
+		newDoc.ID = ChunkID(doc.ID, i)
 		newDoc.ParentID = doc.ID
 		newDoc.Content = chunkText
 
@@ -52,15 +61,27 @@ func (p *ChunkerProcessor) Process(ctx context.Context, doc *core.Document[strin
 		newDoc.Metadata["is_chunk"] = true
 		newDoc.Metadata["chunk_index"] = i
 		newDoc.Metadata["chunk_size"] = len(chunkText)
+		newDoc.Metadata["chunk_start"] = start
+		newDoc.Metadata["chunk_end"] = end
+		newDoc.Metadata["token_count"] = EstimateTokens(chunkText)
 
 		processedChunks = append(processedChunks, newDoc)
 	}
 
-	go doc.CT.WaitAndFinish()
-
 	return processedChunks, nil
 }
 
+// ChunkID is the document ID of a page's i-th chunk.
+func ChunkID(pageID string, i int) string {
+	return fmt.Sprintf("%s#chunk%d", pageID, i)
+}
+
+// EstimateTokens approximates a model token count at four characters per
+// token, close enough to budget embedding and LLM inputs.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
 func (p *ChunkerProcessor) splitRecursive(text string, delimiters []string) []string {
 	if len(text) <= p.MaxChunkSize {
 		return []string{text}
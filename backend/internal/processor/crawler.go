@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -39,7 +40,7 @@ func (p *CrawlerProcessor) Process(ctx context.Context, doc *core.Document[strin
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("status %d", resp.StatusCode)
+		return nil, statusError(resp, fmt.Errorf("status %d", resp.StatusCode))
 	}
 
 	body, err := io.ReadAll(io.LimitReader(resp.Body, 5*1024*1024))
@@ -64,6 +65,46 @@ func (p *CrawlerProcessor) Process(ctx context.Context, doc *core.Document[strin
 	newDoc.Metadata["title"] = title
 	newDoc.Metadata["http_status"] = resp.StatusCode
 	newDoc.Metadata["crawled_at"] = time.Now().UTC().Unix()
+	if lang := pageLanguage(htmlDoc); lang != "" {
+		newDoc.Metadata["language"] = lang
+	}
 
 	return []*core.Document[string]{newDoc}, nil
 }
+
+// pageLanguage reads the primary subtag of <html lang>, e.g. "en" for
+// "en-US", or "" if the page does not declare one.
+func pageLanguage(doc *goquery.Document) string {
+	lang, _ := doc.Find("html").First().Attr("lang")
+	lang, _, _ = strings.Cut(strings.TrimSpace(lang), "-")
+	return strings.ToLower(lang)
+}
+
+// statusError classifies a non-200 response for the GraphRunner retry policy:
+// throttling and server errors are retried (honouring Retry-After), anything
+// else is permanent.
+func statusError(resp *http.Response, err error) error {
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		return &core.RetryableError{Err: err, RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	case resp.StatusCode >= 500:
+		return &core.RetryableError{Err: err}
+	default:
+		return &core.PermanentError{Err: err}
+	}
+}
+
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -3,13 +3,14 @@ package processor
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/url"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/logging"
+	"github.com/oranjParker/Rarefactor/internal/utils"
 )
 
 type DiscoveryProcessor struct{}
@@ -19,7 +20,7 @@ func NewDiscoveryProcessor() *DiscoveryProcessor {
 }
 
 func (p *DiscoveryProcessor) Process(ctx context.Context, doc *core.Document[string]) ([]*core.Document[string], error) {
-	log.Println("[Discovery] Processing document for links:", doc.ID)
+	logging.FromContext(ctx).Debug("scanning document for links")
 	if (doc.Source != "web" && doc.Source != "discovery" && doc.Source != "api_trigger") || doc.Content == "" {
 		return nil, nil
 	}
@@ -44,6 +45,8 @@ func (p *DiscoveryProcessor) Process(ctx context.Context, doc *core.Document[str
 		return nil, fmt.Errorf("failed to parse HTML for discovery: %w", err)
 	}
 
+	parentDomain, _ := utils.GetBaseDomain(doc.ID)
+
 	var discoveredLinks []*core.Document[string]
 
 	htmlDoc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
@@ -59,16 +62,36 @@ func (p *DiscoveryProcessor) Process(ctx context.Context, doc *core.Document[str
 				Source:    "discovery",
 				Depth:     doc.Depth + 1,
 				CreatedAt: time.Now(),
+				Metadata:  inheritedMetadata(doc.Metadata),
+			}
+			if domain, _ := utils.GetBaseDomain(resolved); domain == parentDomain {
+				if pages, ok := doc.Metadata["domain_pages"]; ok {
+					newDoc.Metadata["domain_pages"] = pages
+				}
 			}
 			discoveredLinks = append(discoveredLinks, newDoc)
 		}
 	})
 
-	log.Printf("[Discovery] Discovered %d links from %s.", len(discoveredLinks), doc.ID)
+	logging.FromContext(ctx).Info("discovered links", "count", len(discoveredLinks))
 
 	return discoveredLinks, nil
 }
 
+// jobMetadataKeys describe the crawl job rather than the page, so discovered
+// links carry them forward.
+var jobMetadataKeys = []string{"job_id", "namespace", "max_depth", "mode", "priority"}
+
+func inheritedMetadata(parent map[string]any) map[string]any {
+	meta := make(map[string]any, len(jobMetadataKeys)+1)
+	for _, k := range jobMetadataKeys {
+		if v, ok := parent[k]; ok {
+			meta[k] = v
+		}
+	}
+	return meta
+}
+
 func resolveURL(base, relative string) string {
 	if len(relative) > 2048 {
 		return ""
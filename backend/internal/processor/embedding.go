@@ -5,8 +5,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"math"
 	"net/http"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/oranjParker/Rarefactor/internal/core"
 )
@@ -15,6 +19,14 @@ type EmbeddingProcessor struct {
 	Endpoint   string
 	httpClient *http.Client
 	Model      string
+	// Task is the task prefix the model is asked to embed documents for.
+	Task string
+	// QueryTask is the prefix for search queries; nomic-embed models
+	// score queries against documents best with search_query.
+	QueryTask string
+	Breaker   *core.CircuitBreaker
+
+	embedFn func(ctx context.Context, task string, inputs []string) ([][]float32, error)
 }
 
 type EmbeddingRequest struct {
@@ -31,32 +43,170 @@ type EmbeddingResponse struct {
 
 func NewEmbeddingProcessor(endpoint string) *EmbeddingProcessor {
 	return &EmbeddingProcessor{
-		Endpoint: endpoint,
-		Model:    "nomic-ai/nomic-embed-text-v1.5",
+		Endpoint:  endpoint,
+		Model:     "nomic-ai/nomic-embed-text-v1.5",
+		Task:      "search_document",
+		QueryTask: "search_query",
 		httpClient: &http.Client{
 			Timeout: 15 * time.Second,
 		},
+		Breaker: core.NewCircuitBreaker("embedding", 5, 30*time.Second),
 	}
 }
 
+// NewHashEmbeddingProcessor embeds text in process by feature hashing, for
+// the Lite profile when no embedding service is configured. The vectors only
+// capture lexical overlap but need no model download.
+func NewHashEmbeddingProcessor(dims int) *EmbeddingProcessor {
+	p := &EmbeddingProcessor{
+		Model:   fmt.Sprintf("hashing-%d", dims),
+		Breaker: core.NewCircuitBreaker("embedding", 5, 30*time.Second),
+	}
+	p.embedFn = func(ctx context.Context, task string, inputs []string) ([][]float32, error) {
+		vectors := make([][]float32, len(inputs))
+		for i, in := range inputs {
+			vectors[i] = HashEmbed(in, dims)
+		}
+		return vectors, nil
+	}
+	return p
+}
+
+// HashEmbed maps lower-cased word tokens into a dims-sized, L2-normalised
+// vector using signed FNV feature hashing.
+func HashEmbed(text string, dims int) []float32 {
+	vector := make([]float32, dims)
+	if dims <= 0 {
+		return vector
+	}
+
+	tokens := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, tok := range tokens {
+		h := fnv.New64a()
+		h.Write([]byte(tok))
+		sum := h.Sum64()
+		sign := float32(1)
+		if sum>>63 == 1 {
+			sign = -1
+		}
+		vector[sum%uint64(dims)] += sign
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range vector {
+			vector[i] *= scale
+		}
+	}
+	return vector
+}
+
 func (p *EmbeddingProcessor) Process(ctx context.Context, doc *core.Document[string]) ([]*core.Document[string], error) {
-	newDoc := doc.Clone()
-	if newDoc.Metadata == nil {
-		newDoc.Metadata = make(map[string]any)
+	results, err := p.ProcessBatch(ctx, []*core.Document[string]{doc})
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// ProcessBatch embeds every document in a single request to the embedding service.
+func (p *EmbeddingProcessor) ProcessBatch(ctx context.Context, docs []*core.Document[string]) ([][]*core.Document[string], error) {
+	results := make([][]*core.Document[string], len(docs))
+	var inputs []string
+	var targets []*core.Document[string]
+
+	for i, doc := range docs {
+		newDoc := doc.Clone()
+		if newDoc.Metadata == nil {
+			newDoc.Metadata = make(map[string]any)
+		}
+		results[i] = []*core.Document[string]{newDoc}
+
+		textToEmbed := newDoc.CleanedContent
+		if textToEmbed == "" {
+			textToEmbed = newDoc.Content
+		}
+		if textToEmbed == "" {
+			continue
+		}
+		inputs = append(inputs, textToEmbed)
+		targets = append(targets, newDoc)
+	}
+
+	if len(inputs) == 0 {
+		return results, nil
 	}
-	textToEmbed := newDoc.CleanedContent
-	if textToEmbed == "" {
-		textToEmbed = newDoc.Content
+
+	var vectors [][]float32
+	err := p.Breaker.Execute(ctx, func(ctx context.Context) error {
+		var embedErr error
+		vectors, embedErr = p.embedder()(ctx, p.Task, inputs)
+		return embedErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Record how each vector was made, so a collection never mixes models
+	// and a reindex can tell stale vectors apart.
+	embeddedAt := time.Now().UTC()
+	for i, doc := range targets {
+		doc.Metadata["vector"] = vectors[i]
+		doc.Metadata["embedding_model"] = p.Model
+		doc.Metadata["embedding_dims"] = len(vectors[i])
+		doc.Metadata["embedding_task"] = p.Task
+		doc.Metadata["embedded_at"] = embeddedAt
 	}
 
-	if textToEmbed == "" {
-		return []*core.Document[string]{newDoc}, nil
+	return results, nil
+}
+
+// EmbedQuery embeds a single search query with the same model as documents
+// and the query task prefix.
+func (p *EmbeddingProcessor) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	var vectors [][]float32
+	err := p.Breaker.Execute(ctx, func(ctx context.Context) error {
+		var embedErr error
+		vectors, embedErr = p.embedder()(ctx, p.QueryTask, []string{text})
+		return embedErr
+	})
+	if err != nil {
+		return nil, err
 	}
+	return vectors[0], nil
+}
 
+// Dimensions reports the model's vector size by embedding a probe, so a new
+// collection can be sized for whatever model the endpoint serves.
+func (p *EmbeddingProcessor) Dimensions(ctx context.Context) (int, error) {
+	vector, err := p.EmbedQuery(ctx, "dimension probe")
+	if err != nil {
+		return 0, fmt.Errorf("dimension probe failed: %w", err)
+	}
+	if len(vector) == 0 {
+		return 0, fmt.Errorf("model %s returned an empty vector", p.Model)
+	}
+	return len(vector), nil
+}
+
+func (p *EmbeddingProcessor) embedder() func(ctx context.Context, task string, inputs []string) ([][]float32, error) {
+	if p.embedFn != nil {
+		return p.embedFn
+	}
+	return p.embed
+}
+
+func (p *EmbeddingProcessor) embed(ctx context.Context, task string, inputs []string) ([][]float32, error) {
 	reqBody, _ := json.Marshal(EmbeddingRequest{
-		Input: []string{textToEmbed},
+		Input: inputs,
 		Model: p.Model,
-		Task:  "search_document",
+		Task:  task,
 	})
 
 	url := p.Endpoint
@@ -77,7 +227,7 @@ func (p *EmbeddingProcessor) Process(ctx context.Context, doc *core.Document[str
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("embedding service returned status %d", resp.StatusCode)
+		return nil, statusError(resp, fmt.Errorf("embedding service returned status %d", resp.StatusCode))
 	}
 
 	var embResp EmbeddingResponse
@@ -85,9 +235,13 @@ func (p *EmbeddingProcessor) Process(ctx context.Context, doc *core.Document[str
 		return nil, fmt.Errorf("failed to decode embedding response: %w", err)
 	}
 
-	if len(embResp.Data) > 0 {
-		newDoc.Metadata["vector"] = embResp.Data[0].Embedding
+	if len(embResp.Data) != len(inputs) {
+		return nil, fmt.Errorf("embedding service returned %d vectors for %d inputs", len(embResp.Data), len(inputs))
 	}
 
-	return []*core.Document[string]{newDoc}, nil
+	vectors := make([][]float32, len(embResp.Data))
+	for i, d := range embResp.Data {
+		vectors[i] = d.Embedding
+	}
+	return vectors, nil
 }
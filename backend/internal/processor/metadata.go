@@ -4,10 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
-	"time"
 
 	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/logging"
 )
 
 type LLMProvider interface {
@@ -50,40 +49,30 @@ func (p *MetadataProcessor) Process(ctx context.Context, doc *core.Document[stri
 	`, textToAnalyze)
 
 	if len(prompt) > 10000 {
-		log.Printf("[Metadata] Processing large chunk (%d chars) for %s", len(prompt), doc.ID)
+		logging.FromContext(ctx).Info("processing large chunk", "prompt_chars", len(prompt))
 	}
 
-	var jsonText string
-	var err error
-
-	for i := 0; i < 3; i++ {
-		jsonText, err = p.Provider.Generate(ctx, prompt)
-		log.Printf("[Metadata] Generated JSON with Mistral: %s", jsonText)
-		if err == nil && jsonText != "" {
-			break
-		}
-		time.Sleep(time.Duration(1<<i) * time.Second)
+	jsonText, err := p.Provider.Generate(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("metadata generation failed for %s: %w", doc.ID, err)
 	}
+	logging.FromContext(ctx).Debug("llm metadata response", "response", jsonText)
 
 	if jsonText == "" {
-		log.Printf("[Metadata] Warning: Empty response from LLM for doc %s", doc.ID)
-		return []*core.Document[string]{newDoc}, nil
-	}
-
-	if err != nil {
-		log.Printf("[Metadata] LLM Failure after retries: %v", err)
-		return []*core.Document[string]{newDoc}, nil
+		return nil, fmt.Errorf("metadata generation failed for %s: empty response from LLM", doc.ID)
 	}
 
 	var result map[string]any
 	if err := json.Unmarshal([]byte(jsonText), &result); err != nil {
-		log.Printf("[Metadata] Parse error: %v | Raw: %s", err, jsonText)
+		logging.FromContext(ctx).Warn("llm metadata response is not valid json", "error", err, "response", jsonText)
 		return []*core.Document[string]{newDoc}, nil
 	}
 
 	for k, v := range result {
 		newDoc.Metadata[k] = v
 	}
+	// The sink only counts a chunk as enriched once this stage succeeded.
+	newDoc.Metadata["metadata_extracted"] = true
 
 	return []*core.Document[string]{newDoc}, nil
 }
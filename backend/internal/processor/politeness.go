@@ -11,36 +11,29 @@ import (
 
 	"github.com/jimsmart/grobotstxt"
 	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/frontier"
+	"github.com/oranjParker/Rarefactor/internal/logging"
+	"github.com/oranjParker/Rarefactor/internal/metrics"
 	"github.com/oranjParker/Rarefactor/internal/utils"
-	"github.com/redis/go-redis/v9"
 )
 
 const (
-	RobotsTTL     = 24 * time.Hour
-	VisitedPrefix = "visited:"
-	CountKey      = "crawl_counts"
+	RobotsTTL  = 24 * time.Hour
+	VisitedTTL = 30 * 24 * time.Hour
 )
 
 type PolitenessProcessor struct {
-	Redis             RedisClient
+	Frontier          frontier.Store
 	UserAgent         string
 	httpClient        *http.Client
 	MaxDepth          int
 	MaxPagesPerDomain int
 	BaseDelay         time.Duration
 }
-type RedisClient interface {
-	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
-	Get(ctx context.Context, key string) *redis.StringCmd
-	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
-	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd
-	Del(ctx context.Context, keys ...string) *redis.IntCmd
-	HIncrBy(ctx context.Context, key, field string, incr int64) *redis.IntCmd
-}
 
-func NewPolitenessProcessor(rdb RedisClient, ua string, maxDepth, maxPages int, allowInternal bool) *PolitenessProcessor {
+func NewPolitenessProcessor(store frontier.Store, ua string, maxDepth, maxPages int, allowInternal bool) *PolitenessProcessor {
 	return &PolitenessProcessor{
-		Redis:             rdb,
+		Frontier:          store,
 		UserAgent:         ua,
 		MaxDepth:          maxDepth,
 		MaxPagesPerDomain: maxPages,
@@ -59,48 +52,44 @@ func (p *PolitenessProcessor) Process(ctx context.Context, doc *core.Document[st
 	}
 
 	if doc.Depth > p.MaxDepth {
+		metrics.PolitenessDecisions.WithLabelValues("depth").Inc()
 		return nil, fmt.Errorf("max depth %d exceeded", p.MaxDepth)
 	}
 
 	domain, _ := utils.GetBaseDomain(doc.ID)
 
-	visitedKey := VisitedPrefix + doc.ID
-	isNew, err := p.Redis.SetNX(ctx, visitedKey, "1", 30*24*time.Hour).Result()
+	isNew, err := p.Frontier.MarkVisited(ctx, doc.ID, VisitedTTL)
 	if err != nil {
-		return nil, fmt.Errorf("redis visited check failed: %w", err)
+		return nil, fmt.Errorf("frontier visited check failed: %w", err)
 	}
 	if !isNew {
+		metrics.PolitenessDecisions.WithLabelValues("duplicate").Inc()
 		return nil, nil
 	}
 
 	robotsData, err := p.getRobotsData(ctx, u)
 	if err != nil {
-		fmt.Printf("[Politeness] robots.txt warning for %s: %v\n", u.Host, err)
+		logging.FromContext(ctx).Warn("robots.txt unavailable", "host", u.Host, "error", err)
 	} else if robotsData != "" {
 		if !grobotstxt.AgentAllowed(robotsData, p.UserAgent, u.Path) {
+			metrics.PolitenessDecisions.WithLabelValues("robots_blocked").Inc()
 			return nil, core.ErrRobotsDisallowed
 		}
 	}
 
-	script := `
-		local current = tonumber(redis.call("HGET", KEYS[1], ARGV[1]) or "0")
-		if current >= tonumber(ARGV[2]) then
-			return -1
-		end
-		return redis.call("HINCRBY", KEYS[1], ARGV[1], 1)
-	`
-	res, err := p.Redis.Eval(ctx, script, []string{CountKey}, domain, p.MaxPagesPerDomain).Int64()
+	res, ok, err := p.Frontier.AcquirePage(ctx, domain, p.MaxPagesPerDomain)
 	if err != nil {
-		p.Redis.Del(ctx, visitedKey)
+		_ = p.Frontier.ForgetVisited(ctx, doc.ID)
 		return nil, err
 	}
-	if res == -1 {
+	if !ok {
+		metrics.PolitenessDecisions.WithLabelValues("quota").Inc()
 		return nil, core.ErrQuotaExceeded
 	}
 
 	rollback := func() {
-		p.Redis.HIncrBy(ctx, CountKey, domain, -1)
-		p.Redis.Del(ctx, visitedKey)
+		_ = p.Frontier.ReleasePage(ctx, domain)
+		_ = p.Frontier.ForgetVisited(ctx, doc.ID)
 	}
 
 	baseDelayInSeconds := p.BaseDelay.Seconds()
@@ -111,23 +100,30 @@ func (p *PolitenessProcessor) Process(ctx context.Context, doc *core.Document[st
 
 		if elapsed < penaltySeconds {
 			rollback()
+			metrics.PolitenessDecisions.WithLabelValues("delayed").Inc()
 			return nil, fmt.Errorf("%w: wait %.2fs", core.ErrDelayRequired, penaltySeconds-elapsed)
 		}
 	}
 
-	return []*core.Document[string]{doc}, nil
+	metrics.PolitenessDecisions.WithLabelValues("allowed").Inc()
+
+	// Pages taken from the domain so far; the frontier ranks its links by it.
+	newDoc := doc.Clone()
+	if newDoc.Metadata == nil {
+		newDoc.Metadata = make(map[string]any)
+	}
+	newDoc.Metadata["domain_pages"] = res
+	return []*core.Document[string]{newDoc}, nil
 }
 
 func (p *PolitenessProcessor) getRobotsData(ctx context.Context, u *url.URL) (string, error) {
-	robotsKey := fmt.Sprintf("robots:%s", u.Host)
-
-	data, err := p.Redis.Get(ctx, robotsKey).Result()
-	if err == nil {
-		return data, nil
-	}
-	if err != redis.Nil {
+	data, found, err := p.Frontier.Robots(ctx, u.Host)
+	if err != nil {
 		return "", err
 	}
+	if found {
+		return data, nil
+	}
 
 	robotsURL := fmt.Sprintf("%s://%s/robots.txt", u.Scheme, u.Host)
 	req, err := http.NewRequestWithContext(ctx, "GET", robotsURL, nil)
@@ -143,7 +139,7 @@ func (p *PolitenessProcessor) getRobotsData(ctx context.Context, u *url.URL) (st
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusNotFound {
-		p.Redis.Set(ctx, robotsKey, "", RobotsTTL)
+		_ = p.Frontier.SetRobots(ctx, u.Host, "", RobotsTTL)
 		return "", nil
 	}
 
@@ -153,6 +149,6 @@ func (p *PolitenessProcessor) getRobotsData(ctx context.Context, u *url.URL) (st
 	}
 
 	robotsContent := string(body)
-	p.Redis.Set(ctx, robotsKey, robotsContent, RobotsTTL)
+	_ = p.Frontier.SetRobots(ctx, u.Host, robotsContent, RobotsTTL)
 	return robotsContent, nil
 }
@@ -12,52 +12,15 @@ import (
 	"time"
 
 	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/frontier"
 	"github.com/oranjParker/Rarefactor/internal/llm_provider"
 	"github.com/oranjParker/Rarefactor/internal/utils"
-	"github.com/redis/go-redis/v9"
 )
 
 // =========================================================================
 // MOCKS & HELPERS
 // =========================================================================
 
-// MockRedis implements the RedisClient interface for unit testing.
-type MockRedis struct {
-	Count int64
-}
-
-func (m *MockRedis) SetNX(ctx context.Context, key string, value interface{}, exp time.Duration) *redis.BoolCmd {
-	cmd := redis.NewBoolCmd(ctx)
-	cmd.SetVal(true)
-	return cmd
-}
-
-func (m *MockRedis) Get(ctx context.Context, key string) *redis.StringCmd {
-	cmd := redis.NewStringCmd(ctx)
-	cmd.SetErr(redis.Nil)
-	return cmd
-}
-
-func (m *MockRedis) Set(ctx context.Context, key string, val interface{}, exp time.Duration) *redis.StatusCmd {
-	return redis.NewStatusCmd(ctx)
-}
-
-func (m *MockRedis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
-	m.Count++
-	cmd := redis.NewCmd(ctx)
-	cmd.SetVal(m.Count)
-	return cmd
-}
-
-func (m *MockRedis) Del(ctx context.Context, keys ...string) *redis.IntCmd {
-	return redis.NewIntCmd(ctx)
-}
-
-func (m *MockRedis) HIncrBy(ctx context.Context, key, field string, incr int64) *redis.IntCmd {
-	m.Count += incr
-	return redis.NewIntCmd(ctx)
-}
-
 func contains(s, substr string) bool {
 	return strings.Contains(s, substr)
 }
@@ -68,9 +31,7 @@ func contains(s, substr string) bool {
 
 func TestPolitenessProcessor_Logic(t *testing.T) {
 	ctx := context.Background()
-	mockRDB := &MockRedis{}
-
-	proc := NewPolitenessProcessor(mockRDB, "TestBot", 3, 100, true)
+	proc := NewPolitenessProcessor(frontier.NewMemoryStore(), "TestBot", 3, 100, true)
 
 	t.Run("Allow First Hit", func(t *testing.T) {
 		doc := &core.Document[string]{
@@ -127,12 +88,48 @@ func TestPolitenessProcessor_Logic(t *testing.T) {
 	})
 }
 
+func TestPolitenessProcessor_FrontierState(t *testing.T) {
+	ctx := context.Background()
+	store := frontier.NewMemoryStore()
+	proc := NewPolitenessProcessor(store, "TestBot", 3, 2, true)
+	proc.BaseDelay = 0
+
+	newDoc := func(path string) *core.Document[string] {
+		return &core.Document[string]{ID: "https://rarefactor.io" + path, CreatedAt: time.Now().Add(-time.Minute)}
+	}
+	if err := store.SetRobots(ctx, "rarefactor.io", "", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := proc.Process(ctx, newDoc("/a"))
+	if err != nil || len(res) != 1 {
+		t.Fatalf("expected first visit to pass, got %v (%v)", res, err)
+	}
+	if res[0].Metadata["domain_pages"] != int64(1) {
+		t.Errorf("expected the domain page count to be recorded, got %v", res[0].Metadata["domain_pages"])
+	}
+	if res, err := proc.Process(ctx, newDoc("/a")); err != nil || len(res) != 0 {
+		t.Errorf("expected duplicate to be dropped silently, got %v (%v)", res, err)
+	}
+	if _, err := proc.Process(ctx, newDoc("/b")); err != nil {
+		t.Fatalf("expected second page within quota, got %v", err)
+	}
+	if _, err := proc.Process(ctx, newDoc("/c")); !errors.Is(err, core.ErrQuotaExceeded) {
+		t.Errorf("expected quota to be enforced, got %v", err)
+	}
+}
+
 // =========================================================================
 // EMBEDDING PROCESSOR TESTS
 // =========================================================================
 
 func TestEmbeddingProcessor_Process(t *testing.T) {
+	var lastTask string
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req EmbeddingRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		lastTask = req.Task
+
 		// The new processor uses the /v1/embeddings or /embeddings path
 		if !strings.HasSuffix(r.URL.Path, "/v1/embeddings") && !strings.HasSuffix(r.URL.Path, "/embeddings") {
 			t.Errorf("Unexpected path: %s", r.URL.Path)
@@ -172,6 +169,18 @@ func TestEmbeddingProcessor_Process(t *testing.T) {
 		if vector[0] != 0.1 {
 			t.Errorf("Expected 0.1, got %f", vector[0])
 		}
+		if lastTask != "search_document" {
+			t.Errorf("Expected documents to be embedded as search_document, got %q", lastTask)
+		}
+	})
+
+	t.Run("Queries Use Query Task", func(t *testing.T) {
+		if _, err := proc.EmbedQuery(ctx, "ingestion"); err != nil {
+			t.Fatalf("Query embedding failed: %v", err)
+		}
+		if lastTask != "search_query" {
+			t.Errorf("Expected queries to be embedded as search_query, got %q", lastTask)
+		}
 	})
 
 	t.Run("Network Failure Handling", func(t *testing.T) {
@@ -247,7 +256,7 @@ func TestSecurityProcessor_Logic(t *testing.T) {
 func TestCrawlerProcessor_Fetch(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/html")
-		fmt.Fprintln(w, "<html><head><title>Test Page</title></head><body><nav>Menu</nav><main>Real Content</main></body></html>")
+		fmt.Fprintln(w, "<html lang=\"en-GB\"><head><title>Test Page</title></head><body><nav>Menu</nav><main>Real Content</main></body></html>")
 	}))
 	defer ts.Close()
 
@@ -280,6 +289,9 @@ func TestCrawlerProcessor_Fetch(t *testing.T) {
 	if results[0].Metadata["title"] != "Test Page" {
 		t.Errorf("Expected title 'Test Page', got '%v'", results[0].Metadata["title"])
 	}
+	if results[0].Metadata["language"] != "en" {
+		t.Errorf("Expected language 'en', got '%v'", results[0].Metadata["language"])
+	}
 }
 
 // =========================================================================
@@ -429,6 +441,34 @@ func TestChunkerProcessor_Delimiters(t *testing.T) {
 	if results[1].Metadata["chunk_size"] != 20 {
 		t.Errorf("expected chunk size 20, got %d", results[1].Metadata["chunk_size"])
 	}
+	for _, r := range results {
+		start, end := r.Metadata["chunk_start"].(int), r.Metadata["chunk_end"].(int)
+		if doc.Content[start:end] != r.Content {
+			t.Errorf("expected offsets [%d:%d] to locate %q", start, end, r.Content)
+		}
+	}
+}
+
+func TestChunkerProcessor_OverlapOffsets(t *testing.T) {
+	proc := NewChunkerProcessor(8, 3)
+	proc.Delimiters = nil
+	doc := &core.Document[string]{Content: "héllo wörld, ünïcode everywhere"}
+
+	results, err := proc.Process(context.Background(), doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevStart := -1
+	for _, r := range results {
+		start, end := r.Metadata["chunk_start"].(int), r.Metadata["chunk_end"].(int)
+		if doc.Content[start:end] != r.Content || start <= prevStart {
+			t.Errorf("bad offsets [%d:%d] for %q", start, end, r.Content)
+		}
+		prevStart = start
+		if r.Metadata["token_count"] != EstimateTokens(r.Content) {
+			t.Errorf("expected token_count on %q", r.Content)
+		}
+	}
 }
 
 func TestChunkerProcessor_ReceivesChunk(t *testing.T) {
@@ -528,6 +568,58 @@ func TestDiscoveryProcessor_DepthUnderMax(t *testing.T) {
 	}
 }
 
+func TestDiscoveryProcessor_PropagatesNamespace(t *testing.T) {
+	proc := NewDiscoveryProcessor()
+	doc := &core.Document[string]{
+		Source:   "web",
+		ID:       "https://example.com",
+		Content:  "<html><body><a href='/a'>A</a><a href='http://external.com'>Ext</a></body></html>",
+		Metadata: map[string]any{"job_id": "job-1", "namespace": "docs", "max_depth": 5},
+	}
+
+	results, _ := proc.Process(context.Background(), doc)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 discovered links, got %d", len(results))
+	}
+	for _, child := range results {
+		if child.Metadata["namespace"] != "docs" {
+			t.Errorf("%s: expected the job namespace to reach discovered links, got %v", child.ID, child.Metadata["namespace"])
+		}
+	}
+}
+
+func TestDiscoveryProcessor_InheritsJobMetadata(t *testing.T) {
+	proc := NewDiscoveryProcessor()
+	doc := &core.Document[string]{
+		Source:  "web",
+		ID:      "https://example.com",
+		Content: "<html><body><a href='/link'>Link</a><a href='http://external.com'>Ext</a></body></html>",
+		Metadata: map[string]any{
+			"job_id": "job-1", "max_depth": 5, "priority": 1,
+			"domain_pages": int64(40), "title": "Parent",
+		},
+	}
+
+	results, _ := proc.Process(context.Background(), doc)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 discovered links, got %d", len(results))
+	}
+	for _, child := range results {
+		if child.Metadata["job_id"] != "job-1" || child.Metadata["priority"] != 1 {
+			t.Errorf("%s: expected job metadata to be inherited, got %v", child.ID, child.Metadata)
+		}
+		if _, ok := child.Metadata["title"]; ok {
+			t.Errorf("%s: page metadata should not be inherited", child.ID)
+		}
+	}
+	if results[0].Metadata["domain_pages"] != int64(40) {
+		t.Error("expected same-domain link to carry the domain page count")
+	}
+	if _, ok := results[1].Metadata["domain_pages"]; ok {
+		t.Error("expected external link to start with a fresh domain count")
+	}
+}
+
 func TestDiscoveryProcessor_MaxDepthZero(t *testing.T) {
 	proc := NewDiscoveryProcessor()
 	doc := &core.Document[string]{
@@ -741,3 +833,169 @@ func TestSPACrawlerProcessor_Process(t *testing.T) {
 		t.Errorf("Crawler lost valid content")
 	}
 }
+
+func TestEmbeddingProcessor_ProcessBatch(t *testing.T) {
+	var received EmbeddingRequest
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		resp := EmbeddingResponse{}
+		for i := range received.Input {
+			resp.Data = append(resp.Data, struct {
+				Embedding []float32 `json:"embedding"`
+			}{Embedding: []float32{float32(i)}})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer mockServer.Close()
+
+	proc := NewEmbeddingProcessor(mockServer.URL)
+	docs := []*core.Document[string]{
+		{ID: "a", Content: "first"},
+		{ID: "empty"},
+		{ID: "b", Content: "second", CleanedContent: "second cleaned"},
+	}
+
+	results, err := proc.ProcessBatch(context.Background(), docs)
+	if err != nil {
+		t.Fatalf("batch embedding failed: %v", err)
+	}
+
+	if len(received.Input) != 2 || received.Input[1] != "second cleaned" {
+		t.Errorf("expected one request with 2 inputs, got %v", received.Input)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected results aligned with 3 inputs, got %d", len(results))
+	}
+	if v := results[2][0].Metadata["vector"].([]float32); v[0] != 1 {
+		t.Errorf("vector routed to wrong document: %v", v)
+	}
+	if _, ok := results[1][0].Metadata["vector"]; ok {
+		t.Error("empty document should pass through without a vector")
+	}
+}
+
+func TestCrawlerProcessor_StatusClassification(t *testing.T) {
+	tests := []struct {
+		status    int
+		header    string
+		retryable bool
+		wait      time.Duration
+	}{
+		{http.StatusNotFound, "", false, 0},
+		{http.StatusInternalServerError, "", true, 0},
+		{http.StatusTooManyRequests, "7", true, 7 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("status %d", tt.status), func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.header != "" {
+					w.Header().Set("Retry-After", tt.header)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer ts.Close()
+
+			proc := &CrawlerProcessor{
+				client: utils.NewSafeHTTPClient(utils.ClientConfig{Timeout: 5 * time.Second, AllowInternal: true}),
+			}
+			_, err := proc.Process(context.Background(), &core.Document[string]{ID: ts.URL})
+			if err == nil {
+				t.Fatal("expected error for non-200 status")
+			}
+
+			retry, wait := core.IsRetryable(err)
+			if retry != tt.retryable || wait != tt.wait {
+				t.Errorf("expected retry=%v wait=%v, got retry=%v wait=%v", tt.retryable, tt.wait, retry, wait)
+			}
+		})
+	}
+}
+
+type failingLLM struct{}
+
+func (f *failingLLM) Generate(ctx context.Context, prompt string) (string, error) {
+	return "", errors.New("llm offline")
+}
+
+func TestMetadataProcessor_SurfacesProviderErrors(t *testing.T) {
+	proc := NewMetadataProcessor(&failingLLM{})
+	doc := &core.Document[string]{
+		Content: "This is a long enough text to trigger the metadata extraction logic in the processor.",
+	}
+
+	start := time.Now()
+	_, err := proc.Process(context.Background(), doc)
+	if err == nil {
+		t.Fatal("expected provider error to reach the runner's retry policy")
+	}
+	if time.Since(start) > time.Second {
+		t.Error("processor should not sleep between attempts itself")
+	}
+}
+
+func TestEmbeddingProcessor_CircuitBreaker(t *testing.T) {
+	calls := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer mockServer.Close()
+
+	proc := NewEmbeddingProcessor(mockServer.URL)
+	proc.Breaker = core.NewCircuitBreaker("embedding", 2, time.Minute)
+	doc := &core.Document[string]{Content: "text"}
+
+	for i := 0; i < 2; i++ {
+		if _, err := proc.Process(context.Background(), doc); err == nil {
+			t.Fatal("expected error from unavailable service")
+		}
+	}
+
+	_, err := proc.Process(context.Background(), doc)
+	if !errors.Is(err, core.ErrCircuitOpen) {
+		t.Errorf("expected fast failure once tripped, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected the open circuit to skip the HTTP call, got %d calls", calls)
+	}
+}
+
+func TestHashEmbeddingProcessor(t *testing.T) {
+	proc := NewHashEmbeddingProcessor(64)
+	results, err := proc.ProcessBatch(context.Background(), []*core.Document[string]{
+		{ID: "a", Content: "Go concurrency patterns"},
+		{ID: "b", Content: "go CONCURRENCY, patterns!"},
+	})
+	if err != nil {
+		t.Fatalf("hash embedding failed: %v", err)
+	}
+
+	a := results[0][0].Metadata["vector"].([]float32)
+	b := results[1][0].Metadata["vector"].([]float32)
+	if len(a) != 64 {
+		t.Fatalf("expected 64 dimensions, got %d", len(a))
+	}
+	if meta := results[0][0].Metadata; meta["embedding_model"] != "hashing-64" || meta["embedding_dims"] != 64 || meta["embedded_at"] == nil {
+		t.Errorf("expected the vector to be stamped with its model, got %v", meta)
+	}
+
+	var norm float32
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("expected case and punctuation to be ignored, vectors differ at %d", i)
+		}
+		norm += a[i] * a[i]
+	}
+	if norm < 0.999 || norm > 1.001 {
+		t.Errorf("expected a unit vector, got squared norm %f", norm)
+	}
+
+	query, err := proc.EmbedQuery(context.Background(), "go concurrency patterns")
+	if err != nil || len(query) != 64 || query[0] != a[0] {
+		t.Errorf("expected query embedding to match document embedding, got %v (%v)", query, err)
+	}
+	if dims, err := proc.Dimensions(context.Background()); err != nil || dims != 64 {
+		t.Errorf("expected the probe to detect 64 dimensions, got %d (%v)", dims, err)
+	}
+}
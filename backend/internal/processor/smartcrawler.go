@@ -2,11 +2,11 @@ package processor
 
 import (
 	"context"
-	"fmt"
 	"strings"
 	"time"
 
 	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/logging"
 )
 
 type SPAProcessor interface {
@@ -44,7 +44,7 @@ func (p *SmartCrawlerProcessor) Process(ctx context.Context, doc *core.Document[
 	}
 
 	if needsRender {
-		fmt.Printf("[SmartCrawler] Using Headless Chrome for %s\n", doc.ID)
+		logging.FromContext(ctx).Info("rendering with headless chrome")
 		doc.Metadata["crawler_type"] = "spa"
 		return p.SPA.Process(ctx, doc)
 	}
@@ -55,7 +55,7 @@ func (p *SmartCrawlerProcessor) Process(ctx context.Context, doc *core.Document[
 	if err == nil && len(results) > 0 {
 		content := results[0].Content
 		if len(content) < 200 || strings.Contains(content, "id=\"root\"") || strings.Contains(content, "id=\"app\"") {
-			fmt.Printf("[SmartCrawler] SPA detected or content sparse, falling back to SPA render for %s\n", doc.ID)
+			logging.FromContext(ctx).Info("spa detected or content sparse, falling back to headless render")
 			doc.Metadata["crawler_type"] = "spa"
 			return p.SPA.Process(ctx, doc)
 		}
@@ -0,0 +1,71 @@
+package reindex
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/oranjParker/Rarefactor/internal/database"
+)
+
+// Job is one reindex run, stored in reindex_jobs.
+type Job struct {
+	ID         string
+	Alias      string
+	Collection string
+	Model      string
+	Task       string
+	Dimension  int
+}
+
+// Spec is the embedding the job's collection holds.
+func (j Job) Spec() database.EmbeddingSpec {
+	return database.EmbeddingSpec{Model: j.Model, Dimension: uint64(j.Dimension), Task: j.Task}
+}
+
+// JobStore tracks reindex progress the way crawl_jobs tracks a crawl.
+type JobStore interface {
+	Start(ctx context.Context, job Job) error
+	Progress(ctx context.Context, id string, indexed, errors int) error
+	Finish(ctx context.Context, id, status, message string) error
+}
+
+type DBExecutor interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+type PostgresJobStore struct {
+	db DBExecutor
+}
+
+func NewPostgresJobStore(db DBExecutor) *PostgresJobStore {
+	return &PostgresJobStore{db: db}
+}
+
+func (s *PostgresJobStore) Start(ctx context.Context, job Job) error {
+	query := `
+		INSERT INTO reindex_jobs (id, alias, collection, model, dimension, status, started_at)
+		VALUES ($1, $2, $3, $4, $5, 'RUNNING', NOW())
+	`
+	_, err := s.db.Exec(ctx, query, job.ID, job.Alias, job.Collection, job.Model, job.Dimension)
+	return err
+}
+
+func (s *PostgresJobStore) Progress(ctx context.Context, id string, indexed, errors int) error {
+	query := `
+		UPDATE reindex_jobs
+		SET chunks_indexed = $2, errors_count = $3, updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := s.db.Exec(ctx, query, id, indexed, errors)
+	return err
+}
+
+func (s *PostgresJobStore) Finish(ctx context.Context, id, status, message string) error {
+	query := `
+		UPDATE reindex_jobs
+		SET status = $2, error_message = NULLIF($3, ''), finished_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := s.db.Exec(ctx, query, id, status, message)
+	return err
+}
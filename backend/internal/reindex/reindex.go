@@ -0,0 +1,257 @@
+// Package reindex re-embeds stored chunks into a new Qdrant collection when
+// the embedding model changes, then moves the serving alias onto it.
+package reindex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/database"
+	"github.com/oranjParker/Rarefactor/internal/sink"
+)
+
+const defaultBatchSize = 32
+
+// Embedder is satisfied by processor.EmbeddingProcessor.
+type Embedder interface {
+	ProcessBatch(ctx context.Context, docs []*core.Document[string]) ([][]*core.Document[string], error)
+	Dimensions(ctx context.Context) (int, error)
+}
+
+// Index is satisfied by database.QdrantClient.
+type Index interface {
+	sink.VectorStore
+	NextCollection(ctx context.Context, alias string) (string, error)
+	EnsureCollection(ctx context.Context, name string, spec database.EmbeddingSpec) error
+	SwapAlias(ctx context.Context, alias, collection string) error
+}
+
+// Catalog records the embedding each reindexed chunk now has. It is
+// satisfied by sink.PostgresSink.
+type Catalog interface {
+	RecordEmbeddings(ctx context.Context, docs []*core.Document[string]) error
+}
+
+// Chunks streams the chunks to index. Err reports why the stream ended
+// early once its channel is closed.
+type Chunks interface {
+	Stream(ctx context.Context) (<-chan *core.Document[string], error)
+	Err() error
+}
+
+type Reindexer struct {
+	Embedder Embedder
+	Index    Index
+	Jobs     JobStore
+	// Catalog, if set, is updated with each indexed chunk's new embedding
+	// once the alias has moved, so stored chunks describe the vectors being
+	// served.
+	Catalog Catalog
+	// Chunks opens a stream of the chunks to index, limited to those
+	// written at or after since when it is non-zero.
+	Chunks func(since time.Time) Chunks
+	// Alias is the name workers and search use, e.g. documents.
+	Alias string
+	Model string
+	// Task is the embedder's task prefix, recorded with the collection.
+	Task      string
+	BatchSize int
+	Retry     core.RetryPolicy
+	// Settle is how long to wait after the swap before the last catch-up:
+	// workers keep writing through the alias with the old model until their
+	// cached collection spec expires.
+	Settle time.Duration
+}
+
+func NewReindexer(embedder Embedder, index Index, jobs JobStore, chunks func(since time.Time) Chunks, alias, model string) *Reindexer {
+	return &Reindexer{
+		Embedder:  embedder,
+		Index:     index,
+		Jobs:      jobs,
+		Chunks:    chunks,
+		Alias:     alias,
+		Model:     model,
+		BatchSize: defaultBatchSize,
+		Retry:     core.DefaultRetryPolicy(),
+		Settle:    database.DefaultSpecTTL,
+	}
+}
+
+type progress struct {
+	indexed, errors int
+	// embedded holds the embedding of each indexed chunk, without its text
+	// or vector, for the Catalog.
+	embedded []*core.Document[string]
+}
+
+// Run embeds every chunk into a new versioned collection sized for the
+// model, catches up on chunks enriched meanwhile, swaps the alias and
+// catches up once more on chunks that reached the old collection around the
+// swap. The alias is left alone if any chunk could not be indexed before the
+// swap; the new collection stays behind for inspection.
+func (r *Reindexer) Run(ctx context.Context) (Job, error) {
+	dims, err := r.Embedder.Dimensions(ctx)
+	if err != nil {
+		return Job{}, err
+	}
+	collection, err := r.Index.NextCollection(ctx, r.Alias)
+	if err != nil {
+		return Job{}, err
+	}
+	spec := database.EmbeddingSpec{Model: r.Model, Dimension: uint64(dims), Task: r.Task}
+	if err := r.Index.EnsureCollection(ctx, collection, spec); err != nil {
+		return Job{}, fmt.Errorf("collection %s setup failed: %w", collection, err)
+	}
+
+	job := Job{ID: uuid.NewString(), Alias: r.Alias, Collection: collection, Model: r.Model, Task: r.Task, Dimension: dims}
+	if err := r.Jobs.Start(ctx, job); err != nil {
+		return job, fmt.Errorf("reindex job record failed: %w", err)
+	}
+	slog.Info("reindex started", "component", "reindex", "job_id", job.ID, "collection", collection, "model", r.Model, "dims", dims)
+
+	err = r.run(ctx, job)
+	status, message := "COMPLETED", ""
+	if err != nil {
+		status, message = "FAILED", err.Error()
+	}
+	// Record the outcome even if ctx was cancelled mid-run.
+	if finishErr := r.Jobs.Finish(context.WithoutCancel(ctx), job.ID, status, message); finishErr != nil {
+		slog.Error("reindex job update failed", "component", "reindex", "job_id", job.ID, "error", finishErr)
+	}
+	return job, err
+}
+
+func (r *Reindexer) run(ctx context.Context, job Job) error {
+	var p progress
+	started := time.Now()
+	if err := r.pass(ctx, job, time.Time{}, &p); err != nil {
+		return err
+	}
+	// Chunks enriched during the first pass went to the old collection.
+	caughtUp := time.Now()
+	if err := r.pass(ctx, job, started, &p); err != nil {
+		return err
+	}
+	if p.errors > 0 {
+		return fmt.Errorf("%d chunks could not be indexed, keeping alias %s", p.errors, r.Alias)
+	}
+	if err := r.Index.SwapAlias(ctx, r.Alias, job.Collection); err != nil {
+		return err
+	}
+	slog.Info("reindex alias swapped", "component", "reindex", "job_id", job.ID, "collection", job.Collection)
+
+	// Chunks enriched since the catch-up began still went to the old
+	// collection, until the swap and for as long as workers trusted their
+	// cached spec after it.
+	select {
+	case <-time.After(r.Settle):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	err := r.pass(ctx, job, caughtUp, &p)
+	// What was indexed is being served now, whatever the last pass did.
+	if r.Catalog != nil {
+		if recErr := r.record(context.WithoutCancel(ctx), p.embedded); recErr != nil {
+			err = errors.Join(err, fmt.Errorf("recording the new embeddings failed: %w", recErr))
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("alias %s moved to %s, but the final catch-up failed: %w", r.Alias, job.Collection, err)
+	}
+	if p.errors > 0 {
+		return fmt.Errorf("alias %s moved to %s, but %d chunks could not be indexed in the final catch-up; run backfill to re-enqueue them", r.Alias, job.Collection, p.errors)
+	}
+	slog.Info("reindex completed", "component", "reindex", "job_id", job.ID, "chunks", p.indexed)
+	return nil
+}
+
+// record stores the new embeddings in the Catalog, a batch at a time.
+func (r *Reindexer) record(ctx context.Context, docs []*core.Document[string]) error {
+	for batch := range slices.Chunk(docs, max(r.BatchSize, 1)) {
+		if err := r.Catalog.RecordEmbeddings(ctx, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Reindexer) pass(ctx context.Context, job Job, since time.Time, p *progress) error {
+	chunks := r.Chunks(since)
+	ch, err := chunks.Stream(ctx)
+	if err != nil {
+		return err
+	}
+
+	target := sink.NewQdrantSink(r.Index, job.Collection)
+	target.Spec = job.Spec()
+	batch := make([]*core.Document[string], 0, r.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		embedded, err := r.index(ctx, target, batch)
+		if err != nil {
+			slog.Warn("reindex batch failed", "component", "reindex", "job_id", job.ID, "chunks", len(batch), "error", err)
+			p.errors += len(batch)
+		} else {
+			p.indexed += len(batch)
+			for _, doc := range embedded {
+				p.embedded = append(p.embedded, embeddingRecord(doc))
+			}
+		}
+		batch = batch[:0]
+		if err := r.Jobs.Progress(ctx, job.ID, p.indexed, p.errors); err != nil {
+			slog.Warn("reindex progress update failed", "component", "reindex", "job_id", job.ID, "error", err)
+		}
+	}
+
+	for doc := range ch {
+		batch = append(batch, doc)
+		if len(batch) >= r.BatchSize {
+			flush()
+		}
+	}
+	flush()
+
+	if err := chunks.Err(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+func (r *Reindexer) index(ctx context.Context, target *sink.QdrantSink, docs []*core.Document[string]) ([]*core.Document[string], error) {
+	var embedded []*core.Document[string]
+	err := r.Retry.Do(ctx, nil, func(ctx context.Context) error {
+		results, err := r.Embedder.ProcessBatch(ctx, docs)
+		if err != nil {
+			return err
+		}
+		embedded = make([]*core.Document[string], 0, len(docs))
+		for _, out := range results {
+			embedded = append(embedded, out...)
+		}
+		return target.WriteBatch(ctx, embedded)
+	})
+	return embedded, err
+}
+
+// embeddingKeys are the metadata Catalog.RecordEmbeddings reads.
+var embeddingKeys = []string{"is_chunk", "chunk_index", "embedding_model", "embedding_dims", "embedding_task", "embedded_at"}
+
+// embeddingRecord keeps only what the Catalog needs of an indexed chunk, so
+// holding every chunk until the swap does not hold every vector.
+func embeddingRecord(doc *core.Document[string]) *core.Document[string] {
+	meta := make(map[string]any, len(embeddingKeys))
+	for _, key := range embeddingKeys {
+		if v, ok := doc.Metadata[key]; ok {
+			meta[key] = v
+		}
+	}
+	return &core.Document[string]{ID: doc.ID, ParentID: doc.ParentID, Metadata: meta}
+}
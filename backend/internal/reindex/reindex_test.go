@@ -0,0 +1,193 @@
+package reindex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/database"
+)
+
+type fakeEmbedder struct {
+	dims int
+	fail bool
+}
+
+func (e *fakeEmbedder) Dimensions(ctx context.Context) (int, error) {
+	return e.dims, nil
+}
+
+func (e *fakeEmbedder) ProcessBatch(ctx context.Context, docs []*core.Document[string]) ([][]*core.Document[string], error) {
+	if e.fail {
+		return nil, &core.PermanentError{Err: errors.New("model not loaded")}
+	}
+	out := make([][]*core.Document[string], len(docs))
+	for i, doc := range docs {
+		d := doc.Clone()
+		d.Metadata["vector"] = make([]float32, e.dims)
+		d.Metadata["embedding_model"] = "new-model"
+		out[i] = []*core.Document[string]{d}
+	}
+	return out, nil
+}
+
+type fakeIndex struct {
+	collections map[string]uint64
+	points      map[string]int
+	alias       string
+}
+
+func (f *fakeIndex) UpsertBatch(ctx context.Context, collection string, points []database.QdrantPoint) error {
+	f.points[collection] += len(points)
+	return nil
+}
+
+func (f *fakeIndex) NextCollection(ctx context.Context, alias string) (string, error) {
+	return fmt.Sprintf("%s_v%d", alias, len(f.collections)+1), nil
+}
+
+func (f *fakeIndex) EnsureCollection(ctx context.Context, name string, spec database.EmbeddingSpec) error {
+	f.collections[name] = spec.Dimension
+	return nil
+}
+
+func (f *fakeIndex) SwapAlias(ctx context.Context, alias, collection string) error {
+	f.alias = collection
+	return nil
+}
+
+type fakeJobs struct {
+	started  Job
+	indexed  int
+	status   string
+	messages []string
+}
+
+func (j *fakeJobs) Start(ctx context.Context, job Job) error {
+	j.started = job
+	return nil
+}
+
+func (j *fakeJobs) Progress(ctx context.Context, id string, indexed, errors int) error {
+	j.indexed = indexed
+	return nil
+}
+
+func (j *fakeJobs) Finish(ctx context.Context, id, status, message string) error {
+	j.status = status
+	j.messages = append(j.messages, message)
+	return nil
+}
+
+type fakeCatalog struct {
+	index  *fakeIndex
+	models map[string]any
+	early  bool
+}
+
+func (c *fakeCatalog) RecordEmbeddings(ctx context.Context, docs []*core.Document[string]) error {
+	c.early = c.early || c.index.alias == ""
+	for _, doc := range docs {
+		c.models[doc.ID] = doc.Metadata["embedding_model"]
+	}
+	return nil
+}
+
+type sliceChunks []*core.Document[string]
+
+func (s sliceChunks) Stream(ctx context.Context) (<-chan *core.Document[string], error) {
+	out := make(chan *core.Document[string], len(s))
+	for _, doc := range s {
+		out <- doc
+	}
+	close(out)
+	return out, nil
+}
+
+func (s sliceChunks) Err() error { return nil }
+
+func chunkDocs(from, n int) sliceChunks {
+	var docs sliceChunks
+	for i := from; i < from+n; i++ {
+		docs = append(docs, &core.Document[string]{
+			ID:       fmt.Sprintf("https://a.io/#chunk%d", i),
+			ParentID: "https://a.io/",
+			Content:  "text",
+			Metadata: map[string]any{"is_chunk": true, "chunk_index": i},
+		})
+	}
+	return docs
+}
+
+func newTestReindexer(embedder *fakeEmbedder, index *fakeIndex, jobs *fakeJobs, since *[]time.Time) *Reindexer {
+	chunks := func(s time.Time) Chunks {
+		*since = append(*since, s)
+		if s.IsZero() {
+			return chunkDocs(0, 5)
+		}
+		// One chunk was enriched during each earlier pass.
+		return chunkDocs(4+len(*since), 1)
+	}
+	r := NewReindexer(embedder, index, jobs, chunks, "documents", "new-model")
+	r.BatchSize = 2
+	r.Retry = core.RetryPolicy{MaxAttempts: 1}
+	r.Settle = 0
+	return r
+}
+
+func TestReindexer_SwapsAliasOnceComplete(t *testing.T) {
+	index := &fakeIndex{collections: map[string]uint64{}, points: map[string]int{}}
+	jobs := &fakeJobs{}
+	var since []time.Time
+	r := newTestReindexer(&fakeEmbedder{dims: 1024}, index, jobs, &since)
+	catalog := &fakeCatalog{index: index, models: map[string]any{}}
+	r.Catalog = catalog
+
+	job, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Collection != "documents_v1" || index.collections["documents_v1"] != 1024 {
+		t.Errorf("expected a new collection sized for the model, got %s (%v)", job.Collection, index.collections)
+	}
+	if index.points["documents_v1"] != 7 || jobs.indexed != 7 {
+		t.Errorf("expected every pass to be indexed, got %d points and progress %d", index.points["documents_v1"], jobs.indexed)
+	}
+	if len(since) != 3 || !since[0].IsZero() || since[1].IsZero() || since[2].Before(since[1]) {
+		t.Errorf("expected a full pass, a catch-up and a catch-up after the swap, got %v", since)
+	}
+	if index.alias != "documents_v1" || jobs.status != "COMPLETED" || jobs.started.Model != "new-model" {
+		t.Errorf("expected the alias to move and the job to complete, got alias=%q status=%q", index.alias, jobs.status)
+	}
+	if len(catalog.models) != 7 || catalog.models["https://a.io/#chunk6"] != "new-model" {
+		t.Errorf("expected every chunk's stored embedding to be updated, got %v", catalog.models)
+	}
+	if catalog.early {
+		t.Error("expected embeddings to be recorded only once the alias moved")
+	}
+}
+
+func TestReindexer_KeepsAliasOnFailure(t *testing.T) {
+	index := &fakeIndex{collections: map[string]uint64{}, points: map[string]int{}}
+	jobs := &fakeJobs{}
+	var since []time.Time
+	r := newTestReindexer(&fakeEmbedder{dims: 768, fail: true}, index, jobs, &since)
+	catalog := &fakeCatalog{index: index, models: map[string]any{}}
+	r.Catalog = catalog
+
+	if _, err := r.Run(context.Background()); err == nil {
+		t.Fatal("expected the reindex to fail")
+	}
+	if index.alias != "" {
+		t.Errorf("expected the alias to stay on the old collection, got %q", index.alias)
+	}
+	if len(catalog.models) != 0 {
+		t.Errorf("expected no embeddings to be recorded without a swap, got %v", catalog.models)
+	}
+	if jobs.status != "FAILED" || jobs.messages[0] == "" {
+		t.Errorf("expected the job to be marked failed with a message, got %q %v", jobs.status, jobs.messages)
+	}
+}
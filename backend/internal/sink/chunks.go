@@ -0,0 +1,270 @@
+package sink
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oranjParker/Rarefactor/internal/core"
+)
+
+// Chunk enrichment states, as stored in chunks.enrichment_status. Discovery
+// writes PENDING; the enrichment worker moves a chunk to ENRICHED once it is
+// embedded, or to FAILED when its last delivery fails.
+const (
+	EnrichmentPending  = "PENDING"
+	EnrichmentEnriched = "ENRICHED"
+	EnrichmentFailed   = "FAILED"
+)
+
+// maxLastError bounds the stored error; provider errors can carry whole
+// response bodies.
+const maxLastError = 1024
+
+// chunkEnrichmentKeys are the per-chunk LLM outputs kept with the chunk. The
+// rest of a chunk's metadata is an in-flight copy of its page's and is not
+// persisted again.
+var chunkEnrichmentKeys = []string{"summary", "keywords", "questions"}
+
+var chunkColumns = []string{
+	"document_id",
+	"chunk_index",
+	"content",
+	"start_offset",
+	"end_offset",
+	"token_count",
+	"enrichment_status",
+	"enrichment_attempts",
+	"last_error",
+	"enrichment",
+	"embedding_model",
+	"embedding_dims",
+	"embedding_task",
+	"embedded_at",
+}
+
+// A discovery rewrite of unchanged text must not undo a status that
+// enrichment has already recorded; the two stages race on every chunk. The
+// incoming enrichment_attempts is an increment, and new text starts the
+// count, the error and the embedding columns over.
+const chunkUpsertSet = `
+	ON CONFLICT (document_id, chunk_index) DO UPDATE SET
+		content = EXCLUDED.content,
+		start_offset = EXCLUDED.start_offset,
+		end_offset = EXCLUDED.end_offset,
+		token_count = EXCLUDED.token_count,
+		enrichment_status = CASE
+			WHEN EXCLUDED.enrichment_status = 'PENDING' AND chunks.content = EXCLUDED.content
+			THEN chunks.enrichment_status
+			ELSE EXCLUDED.enrichment_status
+		END,
+		enrichment_attempts = CASE
+			WHEN chunks.content = EXCLUDED.content
+			THEN chunks.enrichment_attempts + EXCLUDED.enrichment_attempts
+			ELSE EXCLUDED.enrichment_attempts
+		END,
+		last_error = CASE
+			WHEN EXCLUDED.enrichment_status = 'ENRICHED' OR chunks.content <> EXCLUDED.content
+			THEN EXCLUDED.last_error
+			ELSE COALESCE(EXCLUDED.last_error, chunks.last_error)
+		END,
+		enrichment = chunks.enrichment || EXCLUDED.enrichment,
+		embedding_model = CASE
+			WHEN EXCLUDED.embedded_at IS NOT NULL OR chunks.content <> EXCLUDED.content
+			THEN EXCLUDED.embedding_model
+			ELSE chunks.embedding_model
+		END,
+		embedding_dims = CASE
+			WHEN EXCLUDED.embedded_at IS NOT NULL OR chunks.content <> EXCLUDED.content
+			THEN EXCLUDED.embedding_dims
+			ELSE chunks.embedding_dims
+		END,
+		embedding_task = CASE
+			WHEN EXCLUDED.embedded_at IS NOT NULL OR chunks.content <> EXCLUDED.content
+			THEN EXCLUDED.embedding_task
+			ELSE chunks.embedding_task
+		END,
+		embedded_at = CASE
+			WHEN EXCLUDED.embedded_at IS NOT NULL OR chunks.content <> EXCLUDED.content
+			THEN EXCLUDED.embedded_at
+			ELSE chunks.embedded_at
+		END,
+		updated_at = NOW()
+`
+
+const chunkQuery = `
+	INSERT INTO chunks (
+		document_id, chunk_index, content, start_offset, end_offset, token_count,
+		enrichment_status, enrichment_attempts, last_error, enrichment,
+		embedding_model, embedding_dims, embedding_task, embedded_at
+	)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+` + chunkUpsertSet
+
+func isChunk(doc *core.Document[string]) bool {
+	chunk, _ := doc.Metadata["is_chunk"].(bool)
+	return chunk && doc.ParentID != ""
+}
+
+// chunkRow is the argument list for chunkQuery, in chunkColumns order. A
+// chunk is ENRICHED once it carries both its vector and the LLM metadata. A
+// vector without metadata means the optional metadata stage was skipped: the
+// row stays PENDING with that stage's error from the tracker, and the source
+// records the failed attempt when the message settles.
+func chunkRow(doc *core.Document[string]) []any {
+	_, embedded := doc.Metadata["vector"]
+	extracted, _ := doc.Metadata["metadata_extracted"].(bool)
+	switch {
+	case embedded && extracted:
+		return chunkStatusRow(doc, EnrichmentEnriched, 1, nil)
+	case embedded && doc.CT != nil:
+		return chunkStatusRow(doc, EnrichmentPending, 0, lastErrorText(doc.CT.Err()))
+	default:
+		return chunkStatusRow(doc, EnrichmentPending, 0, nil)
+	}
+}
+
+// chunkStatusRow is chunkRow with an explicit status, attempt increment and
+// error; lastError is nil or a string.
+func chunkStatusRow(doc *core.Document[string], status string, attempts int, lastError any) []any {
+	enrichment := make(map[string]any)
+	for _, key := range chunkEnrichmentKeys {
+		if v, ok := doc.Metadata[key]; ok {
+			enrichment[key] = v
+		}
+	}
+
+	return append([]any{
+		doc.ParentID,
+		metaInt(doc, "chunk_index"),
+		doc.Content,
+		metaInt(doc, "chunk_start"),
+		metaInt(doc, "chunk_end"),
+		metaInt(doc, "token_count"),
+		status,
+		attempts,
+		lastError,
+		enrichment,
+	}, embeddingColumns(doc)...)
+}
+
+// embeddingColumns records how the chunk's vector was made, or NULLs if it
+// has none. The upsert keeps earlier values when a write carries none.
+func embeddingColumns(doc *core.Document[string]) []any {
+	if _, ok := doc.Metadata["vector"]; !ok {
+		return []any{nil, nil, nil, nil}
+	}
+	return embeddingValues(doc)
+}
+
+// embeddingValues reads the embedding columns from the metadata the
+// embedding processor sets, defaulting embedded_at to now.
+func embeddingValues(doc *core.Document[string]) []any {
+	model, _ := doc.Metadata["embedding_model"].(string)
+	task, _ := doc.Metadata["embedding_task"].(string)
+
+	var at any
+	switch v := doc.Metadata["embedded_at"].(type) {
+	case time.Time:
+		at = v
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			at = t
+		}
+	}
+	if at == nil {
+		at = time.Now().UTC()
+	}
+	return []any{model, metaInt(doc, "embedding_dims"), task, at}
+}
+
+// RecordFailure stores a failed enrichment attempt on the chunk's row. A
+// final failure marks it FAILED; otherwise it stays PENDING for the
+// redelivery. Pages carry no enrichment state and are ignored.
+func (s *PostgresSink) RecordFailure(ctx context.Context, doc *core.Document[string], final bool, cause error) error {
+	if !isChunk(doc) {
+		return nil
+	}
+
+	status := EnrichmentPending
+	if final {
+		status = EnrichmentFailed
+	}
+	row := chunkStatusRow(doc, status, 1, lastErrorText(cause))
+	return s.Retry.Do(ctx, nil, func(ctx context.Context) error {
+		batch := &pgx.Batch{}
+		batch.Queue(chunkQuery, row...)
+		return s.db.SendBatch(ctx, batch).Close()
+	})
+}
+
+// lastErrorText is err as stored in chunks.last_error, or nil.
+func lastErrorText(err error) any {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if len(msg) > maxLastError {
+		msg = strings.ToValidUTF8(msg[:maxLastError], "")
+	}
+	return msg
+}
+
+// chunkEmbeddingQuery leaves updated_at alone: a reindex reads chunks updated
+// since it started in its catch-up pass, and must not pick up its own writes.
+const chunkEmbeddingQuery = `
+	UPDATE chunks
+	SET embedding_model = $3, embedding_dims = $4, embedding_task = $5, embedded_at = $6
+	WHERE document_id = $1 AND chunk_index = $2
+`
+
+// RecordEmbeddings stores how chunks were re-embedded outside the
+// enrichment graph, e.g. by a reindex, so the embedding columns describe the
+// vectors now indexed. Only the embedding metadata is read, so callers may
+// drop the vector first; documents without an embedding_model are skipped.
+func (s *PostgresSink) RecordEmbeddings(ctx context.Context, docs []*core.Document[string]) error {
+	batch := &pgx.Batch{}
+	for _, doc := range docs {
+		if _, ok := doc.Metadata["embedding_model"]; !ok || !isChunk(doc) {
+			continue
+		}
+		args := append([]any{doc.ParentID, metaInt(doc, "chunk_index")}, embeddingValues(doc)...)
+		batch.Queue(chunkEmbeddingQuery, args...)
+	}
+	if batch.Len() == 0 {
+		return nil
+	}
+	return s.Retry.Do(ctx, nil, func(ctx context.Context) error {
+		return s.db.SendBatch(ctx, batch).Close()
+	})
+}
+
+// metaInt reads an integer from metadata that may have been through JSON.
+func metaInt(doc *core.Document[string], key string) int {
+	switch v := doc.Metadata[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// pagesFirst orders a flush so each page row precedes its chunks.
+func pagesFirst(items []*core.Document[string]) []*core.Document[string] {
+	ordered := make([]*core.Document[string], 0, len(items))
+	for _, doc := range items {
+		if !isChunk(doc) {
+			ordered = append(ordered, doc)
+		}
+	}
+	for _, doc := range items {
+		if isChunk(doc) {
+			ordered = append(ordered, doc)
+		}
+	}
+	return ordered
+}
@@ -0,0 +1,69 @@
+package sink
+
+import (
+	"context"
+	"sync"
+
+	"github.com/oranjParker/Rarefactor/internal/core"
+)
+
+// MemorySink keeps pages and chunks in process, keyed by ID, in place of the
+// documents and chunks tables for the Lite profile. Writes upsert like
+// PostgresSink.
+type MemorySink struct {
+	mu    sync.RWMutex
+	docs  map[string]*core.Document[string]
+	pages map[string]map[string]bool
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{
+		docs:  make(map[string]*core.Document[string]),
+		pages: make(map[string]map[string]bool),
+	}
+}
+
+func (s *MemorySink) Write(ctx context.Context, doc *core.Document[string]) error {
+	stored := doc.Clone()
+	stored.CT = nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.docs[doc.ID] = stored
+
+	// Link pages to jobs like the job_documents table does.
+	for jobID, pages := range pagesByJob([]*core.Document[string]{doc}) {
+		if s.pages[jobID] == nil {
+			s.pages[jobID] = make(map[string]bool)
+		}
+		for _, page := range pages {
+			s.pages[jobID][page] = true
+		}
+	}
+	return nil
+}
+
+func (s *MemorySink) Get(id string) (*core.Document[string], bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	doc, ok := s.docs[id]
+	return doc, ok
+}
+
+func (s *MemorySink) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.docs)
+}
+
+// PagesCrawled reports how many pages have been stored for a job.
+func (s *MemorySink) PagesCrawled(jobID string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.pages[jobID])
+}
+
+func (s *MemorySink) Close() error {
+	return nil
+}
@@ -2,17 +2,36 @@ package sink
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"log"
 
+	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/logging"
+	"github.com/oranjParker/Rarefactor/internal/tracing"
 )
 
 type NatsSink struct {
 	JS      jetstream.JetStream
 	Subject string
+	// SubjectFor, when set, picks the subject per document (e.g. the
+	// frontier priority subject) instead of Subject.
+	SubjectFor func(doc *core.Document[string]) string
+	// Stage namespaces message IDs so the same document can move through
+	// several streams; it defaults to Subject.
+	Stage string
+}
+
+// MessageID is the Nats-Msg-Id for doc at stage. It is deterministic, so a
+// redelivered parent republishing its children within the stream's duplicate
+// window is dropped by JetStream instead of queueing the work twice.
+func MessageID(doc *core.Document[string], stage string) string {
+	jobID, _ := doc.Metadata["job_id"].(string)
+	h := sha256.Sum256([]byte(jobID + "\x00" + doc.ID + "\x00" + stage))
+	return hex.EncodeToString(h[:16])
 }
 
 func NewNatsSink(js jetstream.JetStream, subject string) *NatsSink {
@@ -28,12 +47,30 @@ func (n *NatsSink) Write(ctx context.Context, doc *core.Document[string]) error
 		return fmt.Errorf("nats marshal failed: %w", err)
 	}
 
-	_, err = n.JS.Publish(ctx, n.Subject, data)
+	subject := n.Subject
+	if n.SubjectFor != nil {
+		subject = n.SubjectFor(doc)
+	}
+
+	stage := n.Stage
+	if stage == "" {
+		stage = n.Subject
+	}
+
+	msg := &nats.Msg{Subject: subject, Data: data, Header: nats.Header{}}
+	msg.Header.Set(jetstream.MsgIDHeader, MessageID(doc, stage))
+	tracing.Inject(ctx, msg.Header)
+
+	ack, err := n.JS.PublishMsg(ctx, msg)
 	if err != nil {
 		return fmt.Errorf("nats publish failed: %w", err)
 	}
+	if ack.Duplicate {
+		logging.FromContext(ctx).Debug("duplicate publish dropped", "queued_id", doc.ID, "subject", subject)
+		return nil
+	}
 
-	log.Printf("[NATS Sink] Discovered link queued: %s -> %s", doc.ID, n.Subject)
+	logging.FromContext(ctx).Debug("document queued", "queued_id", doc.ID, "subject", subject)
 	return nil
 }
 
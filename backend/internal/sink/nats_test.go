@@ -0,0 +1,59 @@
+package sink
+
+import (
+	"context"
+	"testing"
+
+	"github.com/oranjParker/Rarefactor/internal/config"
+	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/database"
+)
+
+func TestNatsSink_DeduplicatesRepublishedDocuments(t *testing.T) {
+	ctx := context.Background()
+	nt, err := database.NewEmbeddedNats(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nt.Close()
+
+	cfg := config.Default().NATS
+	if err := database.NewTopology(cfg).Provision(ctx, nt.JS); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewNatsSink(nt.JS, cfg.EnrichmentSubject)
+	child := &core.Document[string]{ID: "https://a.io/x", Metadata: map[string]any{"job_id": "job-1"}}
+	// A redelivered parent republishes the same child.
+	for i := 0; i < 3; i++ {
+		if err := s.Write(ctx, child); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := &core.Document[string]{ID: "https://a.io/x", Metadata: map[string]any{"job_id": "job-2"}}
+	if err := s.Write(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := nt.JS.Stream(ctx, cfg.EnrichmentStream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := stream.Info(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State.Msgs != 2 {
+		t.Errorf("expected one message per job, got %d", info.State.Msgs)
+	}
+}
+
+func TestMessageID(t *testing.T) {
+	doc := &core.Document[string]{ID: "https://a.io/", Metadata: map[string]any{"job_id": "job-1"}}
+	if MessageID(doc, "crawl.jobs") != MessageID(doc.Clone(), "crawl.jobs") {
+		t.Error("expected message IDs to be deterministic")
+	}
+	if MessageID(doc, "crawl.jobs") == MessageID(doc, "crawl.enrichment") {
+		t.Error("expected stages to get distinct message IDs")
+	}
+}
@@ -4,48 +4,101 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/metrics"
 )
 
 const (
 	DefaultBatchSize    = 20
 	DefaultFlushTimeout = 10 * time.Second
+	// DefaultMaxBuffered is in batches: how many may be queued or in flight
+	// before Write blocks.
+	DefaultMaxBuffered = 10
+	closeFlushTimeout  = 30 * time.Second
 )
 
+var ErrSinkClosed = errors.New("postgres sink closed")
+
+// PostgresDB is the part of pgxpool.Pool the sink uses.
+type PostgresDB interface {
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// FlushStats counts batch executions. Items and Failed are documents;
+// Retries are re-sends after a transient error.
+type FlushStats struct {
+	Flushes atomic.Int64
+	Items   atomic.Int64
+	Failed  atomic.Int64
+	Retries atomic.Int64
+}
+
 type PostgresSink struct {
-	db            *pgxpool.Pool
+	db            PostgresDB
 	batchSize     int
 	flushInterval time.Duration
+	// Retry re-sends a batch after a transient error (lost connection,
+	// serialization failure). Rows the server rejects are not retried.
+	Retry core.RetryPolicy
+	// Ingest selects how a flush reaches the documents table.
+	Ingest IngestMode
 
 	buffer []*core.Document[string]
+	closed bool
 	mu     sync.Mutex
+	// slots holds one token per buffered or in-flight document, so Write
+	// blocks once Postgres falls behind instead of growing the buffer.
+	slots chan struct{}
+	stats FlushStats
 
+	ctx       context.Context
+	cancel    context.CancelFunc
 	closeChan chan struct{}
 	wg        sync.WaitGroup
 }
 
-func NewPostgresSink(db *pgxpool.Pool, batchSize int, interval time.Duration) *PostgresSink {
+func NewPostgresSink(db PostgresDB, batchSize int, interval time.Duration, maxBuffered int) *PostgresSink {
 	if batchSize <= 0 {
 		batchSize = DefaultBatchSize
 	}
 	if interval <= 0 {
 		interval = DefaultFlushTimeout
 	}
+	if maxBuffered < batchSize {
+		maxBuffered = batchSize * DefaultMaxBuffered
+	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	s := &PostgresSink{
 		db:            db,
 		batchSize:     batchSize,
 		flushInterval: interval,
-		buffer:        make([]*core.Document[string], 0, batchSize),
-		closeChan:     make(chan struct{}),
+		Ingest:        IngestBatch,
+		Retry: core.RetryPolicy{
+			MaxAttempts:    5,
+			InitialBackoff: 200 * time.Millisecond,
+			MaxBackoff:     5 * time.Second,
+			Multiplier:     2,
+			Jitter:         0.2,
+			RetryOn:        func(err error) (bool, time.Duration) { return isTransient(err), 0 },
+		},
+		buffer:    make([]*core.Document[string], 0, batchSize),
+		slots:     make(chan struct{}, maxBuffered),
+		ctx:       ctx,
+		cancel:    cancel,
+		closeChan: make(chan struct{}),
 	}
 
 	s.wg.Add(1)
@@ -54,19 +107,64 @@ func NewPostgresSink(db *pgxpool.Pool, batchSize int, interval time.Duration) *P
 	return s
 }
 
+func (s *PostgresSink) Stats() *FlushStats {
+	return &s.stats
+}
+
+// Write buffers doc and flushes once a batch is full. It returns an error
+// only for doc itself: the sink is closed, ctx ended while waiting for
+// buffer space or for the flush, or the flush it triggered could not persist
+// it. The flush carries other callers' documents, so it runs on the sink's
+// context and goes on after ctx ends.
 func (s *PostgresSink) Write(ctx context.Context, doc *core.Document[string]) error {
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.closeChan:
+		return ErrSinkClosed
+	}
+
 	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		<-s.slots
+		return ErrSinkClosed
+	}
+	// Hold the source message open until the buffered row is flushed.
+	if doc.CT != nil {
+		doc.CT.Add(1)
+	}
 	s.buffer = append(s.buffer, doc)
 	shouldFlush := len(s.buffer) >= s.batchSize
+	if shouldFlush {
+		// Close waits for the flush.
+		s.wg.Add(1)
+	}
 	s.mu.Unlock()
+	metrics.PostgresBuffered.Inc()
 
-	if shouldFlush {
-		return s.flush(ctx)
+	if !shouldFlush {
+		return nil
+	}
+	flushed := make(chan error, 1)
+	go func() {
+		defer s.wg.Done()
+		flushed <- s.flush(s.ctx)[doc]
+	}()
+	select {
+	case err := <-flushed:
+		if err != nil {
+			// The sink has already retried; another attempt is up to redelivery.
+			return &core.PermanentError{Err: err}
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return nil
 }
 
-func (s *PostgresSink) flush(ctx context.Context) error {
+func (s *PostgresSink) flush(ctx context.Context) map[*core.Document[string]]error {
 	s.mu.Lock()
 	if len(s.buffer) == 0 {
 		s.mu.Unlock()
@@ -80,118 +178,253 @@ func (s *PostgresSink) flush(ctx context.Context) error {
 	return s.executeBatch(ctx, pending)
 }
 
-func (s *PostgresSink) executeBatch(ctx context.Context, items []*core.Document[string]) error {
-	batch := &pgx.Batch{}
-	log.Printf("[PostgresSink] Executing batch of %d items\n", len(items))
-	query := `
-		INSERT INTO documents (
-			id, 
-			parent_id, 
-			namespace, 
-			domain, 
-			source, 
-			content, 
-			cleaned_content, 
-			title, 
-			summary, 
-			content_hash, 
-			metadata, 
-			crawled_at, 
-			last_seen_at
-		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW())
-		ON CONFLICT (id) DO UPDATE SET
-			content = EXCLUDED.content,
-			cleaned_content = EXCLUDED.cleaned_content,
-			title = EXCLUDED.title,
-			summary = EXCLUDED.summary,
-			content_hash = EXCLUDED.content_hash,
-			metadata = EXCLUDED.metadata,
-			last_seen_at = NOW()
-	`
-
-	jobQuery := `
-		UPDATE crawl_jobs 
-		SET pages_crawled = pages_crawled + $2, updated_at = NOW() 
-		WHERE id = $1
-	`
-
-	jobUpdates := make(map[string]int)
-
-	for _, doc := range items {
-		domain := extractDomain(doc.ID)
-
-		namespace, _ := doc.Metadata["namespace"].(string)
-		if namespace == "" {
-			namespace = "default"
+// executeBatch persists items and settles their trackers, returning the
+// documents that could not be written. The batch runs as one implicit
+// transaction, so a row the server rejects is dropped and the rest re-sent.
+func (s *PostgresSink) executeBatch(ctx context.Context, items []*core.Document[string]) map[*core.Document[string]]error {
+	defer func() {
+		for range items {
+			<-s.slots
 		}
-		title, _ := doc.Metadata["title"].(string)
-		summary, _ := doc.Metadata["summary"].(string)
-		jobID, _ := doc.Metadata["job_id"].(string)
-		contentHash := generateHash(doc.Content)
-
-		batch.Queue(query,
-			doc.ID,
-			doc.ParentID,
-			namespace,
-			domain,
-			doc.Source,
-			doc.Content,
-			doc.CleanedContent,
-			title,
-			summary,
-			contentHash,
-			doc.Metadata,
-			doc.CreatedAt,
-		)
-
-		if jobID != "" {
-			var chunkIdx int
-			if val, ok := doc.Metadata["chunk_index"]; ok {
-				switch v := val.(type) {
-				case int:
-					chunkIdx = v
-				case float64:
-					chunkIdx = int(v)
-				}
+		metrics.PostgresBuffered.Sub(float64(len(items)))
+	}()
+
+	slog.Debug("executing postgres batch", "component", "postgres_sink", "size", len(items))
+	metrics.PostgresBatchSize.Observe(float64(len(items)))
+	s.stats.Flushes.Add(1)
+	started := time.Now()
+	defer func() { metrics.PostgresFlushLatency.Observe(time.Since(started).Seconds()) }()
+
+	failed := make(map[*core.Document[string]]error)
+	pending := pagesFirst(items)
+	attempts := 0
+	copyRejected := false
+	err := s.Retry.Do(ctx, nil, func(ctx context.Context) error {
+		if attempts++; attempts > 1 {
+			s.stats.Retries.Add(1)
+			metrics.PostgresRetries.Inc()
+		}
+		if s.Ingest == IngestCopy && !copyRejected {
+			err := s.copyDocuments(ctx, pending)
+			var pgErr *pgconn.PgError
+			if err == nil || isTransient(err) || !errors.As(err, &pgErr) {
+				return err
 			}
-
-			isChunk := doc.ParentID != ""
-			if !isChunk || (isChunk && chunkIdx == 0) {
-				jobUpdates[jobID]++
+			// COPY cannot say which row was rejected; the batch path can.
+			slog.Warn("copy rejected, falling back to batch upserts", "component", "postgres_sink", "error", err)
+			copyRejected = true
+		}
+		for len(pending) > 0 {
+			idx, err := s.sendDocuments(ctx, pending)
+			if err == nil {
+				return nil
+			}
+			var pgErr *pgconn.PgError
+			if idx < 0 || isTransient(err) || !errors.As(err, &pgErr) {
+				return err
 			}
+			failed[pending[idx]] = err
+			pending = append(pending[:idx:idx], pending[idx+1:]...)
+		}
+		return nil
+	})
+	if err != nil {
+		for _, doc := range pending {
+			failed[doc] = err
 		}
 	}
 
-	for id, delta := range jobUpdates {
-		batch.Queue(jobQuery, id, delta)
+	var written []*core.Document[string]
+	for _, doc := range items {
+		if err, ok := failed[doc]; ok {
+			slog.Error("postgres batch item failed", append(doc.LogAttrs(), "component", "postgres_sink", "error", err)...)
+			metrics.PostgresFailures.Inc()
+			s.stats.Failed.Add(1)
+			if doc.CT != nil {
+				doc.CT.Fail()
+				doc.CT.Done()
+			}
+			continue
+		}
+		written = append(written, doc)
+		s.stats.Items.Add(1)
+		if doc.CT != nil {
+			doc.CT.Done()
+		}
 	}
 
-	br := s.db.SendBatch(ctx, batch)
-	defer br.Close()
+	s.recordJobs(ctx, written, failed)
+	return failed
+}
 
-	for i := 0; i < len(items); i++ {
-		_, err := br.Exec()
-		if err != nil {
-			log.Printf("[PostgresSink] Batch exec error for item %s: %v\n", items[i].ID, err)
-			if items[i].CT != nil {
-				items[i].CT.Fail()
-				items[i].CT.Done()
-			}
+const documentQuery = `
+	INSERT INTO documents (
+		id, 
+		parent_id, 
+		namespace, 
+		domain, 
+		source, 
+		content, 
+		cleaned_content, 
+		title, 
+		summary, 
+		content_hash, 
+		metadata, 
+		crawled_at, 
+		last_seen_at
+	)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW())
+	ON CONFLICT (id) DO UPDATE SET
+		content = EXCLUDED.content,
+		cleaned_content = EXCLUDED.cleaned_content,
+		title = EXCLUDED.title,
+		summary = EXCLUDED.summary,
+		content_hash = EXCLUDED.content_hash,
+		metadata = EXCLUDED.metadata,
+		last_seen_at = NOW()
+`
+
+// sendDocuments upserts pages into documents and chunks into chunks in one
+// batch. On failure it returns the index of the statement that failed, or -1
+// if the batch as a whole did.
+func (s *PostgresSink) sendDocuments(ctx context.Context, docs []*core.Document[string]) (int, error) {
+	batch := &pgx.Batch{}
+	for _, doc := range docs {
+		if isChunk(doc) {
+			batch.Queue(chunkQuery, chunkRow(doc)...)
 		} else {
-			if items[i].CT != nil {
-				items[i].CT.Done()
-			}
+			batch.Queue(documentQuery, documentRow(doc)...)
 		}
 	}
 
-	for i := 0; i < len(jobUpdates); i++ {
+	br := s.db.SendBatch(ctx, batch)
+	for i := range docs {
 		if _, err := br.Exec(); err != nil {
-			log.Printf("[PostgresSink] Job Stats update error: %v", err)
+			_ = br.Close()
+			return i, err
 		}
 	}
+	return -1, br.Close()
+}
 
-	return nil
+// documentRow is the argument list shared by documentQuery and the COPY
+// columns, in documentColumns order.
+func documentRow(doc *core.Document[string]) []any {
+	namespace, _ := doc.Metadata["namespace"].(string)
+	if namespace == "" {
+		namespace = "default"
+	}
+	title, _ := doc.Metadata["title"].(string)
+	summary, _ := doc.Metadata["summary"].(string)
+
+	return []any{
+		doc.ID,
+		doc.ParentID,
+		namespace,
+		extractDomain(doc.ID),
+		doc.Source,
+		doc.Content,
+		doc.CleanedContent,
+		title,
+		summary,
+		generateHash(doc.Content),
+		doc.Metadata,
+		doc.CreatedAt,
+	}
+}
+
+// A page counts once per job however many chunks, redeliveries or
+// enrichment rewrites reach the sink: the link row is the dedup key.
+const pagesQuery = `
+	WITH linked AS (
+		INSERT INTO job_documents (job_id, document_id)
+		SELECT id, unnest($2::text[]) FROM crawl_jobs WHERE id = $1::uuid
+		ON CONFLICT DO NOTHING
+		RETURNING 1
+	)
+	UPDATE crawl_jobs
+	SET pages_crawled = pages_crawled + (SELECT count(*) FROM linked), updated_at = NOW()
+	WHERE id = $1::uuid
+`
+
+const errorsQuery = `
+	UPDATE crawl_jobs
+	SET errors_count = errors_count + $2, updated_at = NOW()
+	WHERE id = $1::uuid
+`
+
+// recordJobs updates crawl_jobs counters after the documents are settled.
+// It is best effort: the link table makes a later replay count correctly.
+func (s *PostgresSink) recordJobs(ctx context.Context, written []*core.Document[string], failed map[*core.Document[string]]error) {
+	pages := pagesByJob(written)
+	jobErrors := make(map[string]int)
+	for doc := range failed {
+		if jobID, _ := doc.Metadata["job_id"].(string); jobID != "" {
+			jobErrors[jobID]++
+		}
+	}
+	if len(pages) == 0 && len(jobErrors) == 0 {
+		return
+	}
+
+	err := s.Retry.Do(ctx, nil, func(ctx context.Context) error {
+		batch := &pgx.Batch{}
+		for id, docs := range pages {
+			batch.Queue(pagesQuery, id, docs)
+		}
+		for id, n := range jobErrors {
+			batch.Queue(errorsQuery, id, n)
+		}
+		return s.db.SendBatch(ctx, batch).Close()
+	})
+	if err != nil {
+		slog.Error("job stats update failed", "component", "postgres_sink", "error", err)
+	}
+}
+
+// isTransient reports whether a failed batch is worth re-sending. Anything
+// the server did not reject outright (connection loss, timeouts) is, as are
+// the concurrency and availability classes of server errors.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return true
+	}
+	switch pgErr.Code {
+	case "40001", "40P01", // serialization_failure, deadlock_detected
+		"53300",                   // too_many_connections
+		"57P01", "57P02", "57P03": // admin_shutdown, crash_shutdown, cannot_connect_now
+		return true
+	}
+	return strings.HasPrefix(pgErr.Code, "08") // connection_exception
+}
+
+// pagesByJob maps each job to the distinct pages in items. A chunk stands
+// for its parent page.
+func pagesByJob(items []*core.Document[string]) map[string][]string {
+	seen := make(map[string]map[string]bool)
+	jobs := make(map[string][]string)
+	for _, doc := range items {
+		jobID, _ := doc.Metadata["job_id"].(string)
+		if jobID == "" {
+			continue
+		}
+		page := doc.ID
+		if doc.ParentID != "" {
+			page = doc.ParentID
+		}
+		if seen[jobID] == nil {
+			seen[jobID] = make(map[string]bool)
+		}
+		if !seen[jobID][page] {
+			seen[jobID][page] = true
+			jobs[jobID] = append(jobs[jobID], page)
+		}
+	}
+	return jobs
 }
 
 func (s *PostgresSink) runFlusher() {
@@ -202,8 +435,8 @@ func (s *PostgresSink) runFlusher() {
 	for {
 		select {
 		case <-ticker.C:
-			if err := s.flush(context.Background()); err != nil {
-				log.Printf("[PostgresSink] Scheduled flush failed: %v", err)
+			if failed := s.flush(s.ctx); len(failed) > 0 {
+				slog.Error("scheduled flush failed", "component", "postgres_sink", "failed", len(failed))
 			}
 		case <-s.closeChan:
 			return
@@ -212,9 +445,24 @@ func (s *PostgresSink) runFlusher() {
 }
 
 func (s *PostgresSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
 	close(s.closeChan)
 	s.wg.Wait()
-	return s.flush(context.Background())
+	defer s.cancel()
+
+	ctx, cancel := context.WithTimeout(s.ctx, closeFlushTimeout)
+	defer cancel()
+	if failed := s.flush(ctx); len(failed) > 0 {
+		return fmt.Errorf("final flush failed for %d documents", len(failed))
+	}
+	return nil
 }
 
 func generateHash(content string) string {
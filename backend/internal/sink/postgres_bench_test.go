@@ -0,0 +1,71 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oranjParker/Rarefactor/internal/config"
+	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/database"
+)
+
+// Compare the ingest paths against a migrated database:
+//
+//	DATABASE_URL=postgres://... go test ./internal/sink -run '^$' -bench PostgresSink
+func benchmarkIngest(b *testing.B, mode IngestMode, batchSize int) {
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		b.Skip("DATABASE_URL not set")
+	}
+
+	ctx := context.Background()
+	cfg := config.Default().Postgres
+	cfg.URL = url
+	pool, err := database.NewPool(ctx, cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer pool.Close()
+
+	prefix := fmt.Sprintf("bench://%s-%d/", mode, time.Now().UnixNano())
+	defer func() {
+		_, _ = pool.Exec(ctx, "DELETE FROM documents WHERE id LIKE $1", prefix+"%")
+	}()
+
+	s := NewPostgresSink(pool, batchSize, time.Hour, 0)
+	s.Ingest = mode
+	defer s.Close()
+
+	content := strings.Repeat("lorem ipsum dolor sit amet ", 40)
+	b.ResetTimer()
+	started := time.Now()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < batchSize; j++ {
+			doc := &core.Document[string]{
+				ID:        fmt.Sprintf("%s%d/%d", prefix, i, j),
+				Source:    "bench",
+				Content:   content,
+				CreatedAt: started,
+				Metadata:  map[string]any{"title": "bench", "chunk_index": j},
+			}
+			if err := s.Write(ctx, doc); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(b.N*batchSize)/time.Since(started).Seconds(), "docs/s")
+	if failed := s.Stats().Failed.Load(); failed > 0 {
+		b.Fatalf("%d documents failed", failed)
+	}
+}
+
+func BenchmarkPostgresSink_Batch50(b *testing.B)  { benchmarkIngest(b, IngestBatch, 50) }
+func BenchmarkPostgresSink_Copy50(b *testing.B)   { benchmarkIngest(b, IngestCopy, 50) }
+func BenchmarkPostgresSink_Batch500(b *testing.B) { benchmarkIngest(b, IngestBatch, 500) }
+func BenchmarkPostgresSink_Copy500(b *testing.B)  { benchmarkIngest(b, IngestCopy, 500) }
@@ -0,0 +1,143 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oranjParker/Rarefactor/internal/core"
+)
+
+type IngestMode string
+
+const (
+	// IngestBatch pipelines one INSERT ... ON CONFLICT per document.
+	IngestBatch IngestMode = "batch"
+	// IngestCopy streams a flush into staging tables with COPY and merges
+	// each with a single INSERT ... SELECT ... ON CONFLICT.
+	IngestCopy IngestMode = "copy"
+)
+
+var documentColumns = []string{
+	"id",
+	"parent_id",
+	"namespace",
+	"domain",
+	"source",
+	"content",
+	"cleaned_content",
+	"title",
+	"summary",
+	"content_hash",
+	"metadata",
+	"crawled_at",
+}
+
+// The staging tables live for the connection and are emptied at commit, so
+// pooled connections reuse them instead of creating them per flush.
+const createStagingQuery = `
+	CREATE TEMP TABLE IF NOT EXISTS documents_staging
+	(LIKE documents INCLUDING DEFAULTS)
+	ON COMMIT DELETE ROWS;
+	CREATE TEMP TABLE IF NOT EXISTS chunks_staging
+	(LIKE chunks INCLUDING DEFAULTS)
+	ON COMMIT DELETE ROWS
+`
+
+const mergeDocumentsQuery = `
+	INSERT INTO documents (
+		id, parent_id, namespace, domain, source, content, cleaned_content,
+		title, summary, content_hash, metadata, crawled_at, last_seen_at
+	)
+	SELECT
+		id, parent_id, namespace, domain, source, content, cleaned_content,
+		title, summary, content_hash, metadata, crawled_at, NOW()
+	FROM documents_staging
+	ON CONFLICT (id) DO UPDATE SET
+		content = EXCLUDED.content,
+		cleaned_content = EXCLUDED.cleaned_content,
+		title = EXCLUDED.title,
+		summary = EXCLUDED.summary,
+		content_hash = EXCLUDED.content_hash,
+		metadata = EXCLUDED.metadata,
+		last_seen_at = NOW()
+`
+
+const mergeChunksQuery = `
+	INSERT INTO chunks (
+		document_id, chunk_index, content, start_offset, end_offset, token_count,
+		enrichment_status, enrichment_attempts, last_error, enrichment,
+		embedding_model, embedding_dims, embedding_task, embedded_at
+	)
+	SELECT
+		document_id, chunk_index, content, start_offset, end_offset, token_count,
+		enrichment_status, enrichment_attempts, last_error, enrichment,
+		embedding_model, embedding_dims, embedding_task, embedded_at
+	FROM chunks_staging
+` + chunkUpsertSet
+
+// copyDocuments upserts docs with COPY into the staging tables and one merge
+// per table, pages first, all in a single transaction.
+func (s *PostgresSink) copyDocuments(ctx context.Context, docs []*core.Document[string]) error {
+	var pages, chunks []*core.Document[string]
+	for _, doc := range docs {
+		if isChunk(doc) {
+			chunks = append(chunks, doc)
+		} else {
+			pages = append(pages, doc)
+		}
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin failed: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, createStagingQuery); err != nil {
+		return fmt.Errorf("staging table setup failed: %w", err)
+	}
+
+	stages := []struct {
+		table   string
+		columns []string
+		rows    [][]any
+		merge   string
+	}{
+		{"documents_staging", documentColumns, stagingRows(pages, func(d *core.Document[string]) string { return d.ID }, documentRow), mergeDocumentsQuery},
+		{"chunks_staging", chunkColumns, stagingRows(chunks, chunkKey, chunkRow), mergeChunksQuery},
+	}
+	for _, st := range stages {
+		if len(st.rows) == 0 {
+			continue
+		}
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{st.table}, st.columns, pgx.CopyFromRows(st.rows)); err != nil {
+			return fmt.Errorf("copy into %s failed: %w", st.table, err)
+		}
+		if _, err := tx.Exec(ctx, st.merge); err != nil {
+			return fmt.Errorf("merge from %s failed: %w", st.table, err)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func chunkKey(doc *core.Document[string]) string {
+	return fmt.Sprintf("%s#%d", doc.ParentID, metaInt(doc, "chunk_index"))
+}
+
+// stagingRows keeps the last write per key: one INSERT ... ON CONFLICT cannot
+// update the same row twice, where the batch path simply applied both.
+func stagingRows(docs []*core.Document[string], key func(*core.Document[string]) string, row func(*core.Document[string]) []any) [][]any {
+	index := make(map[string]int, len(docs))
+	rows := make([][]any, 0, len(docs))
+	for _, doc := range docs {
+		k := key(doc)
+		if i, ok := index[k]; ok {
+			rows[i] = row(doc)
+			continue
+		}
+		index[k] = len(rows)
+		rows = append(rows, row(doc))
+	}
+	return rows
+}
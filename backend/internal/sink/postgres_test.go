@@ -0,0 +1,498 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/oranjParker/Rarefactor/internal/core"
+)
+
+// fakeDB executes document upserts as one implicit transaction, like a pgx
+// batch: a failing statement aborts everything queued with it.
+type fakeDB struct {
+	mu        sync.Mutex
+	dropConns int
+	reject    map[string]error
+	committed map[string]int
+	rows      map[string][]any
+	jobSQL    int
+	copies    int
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{reject: map[string]error{}, committed: map[string]int{}, rows: map[string][]any{}}
+}
+
+func (f *fakeDB) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	res := &fakeResults{}
+	if f.dropConns > 0 {
+		f.dropConns--
+		res.err = errors.New("unexpected EOF")
+		return res
+	}
+
+	var ids []string
+	rows := make(map[string][]any)
+	for _, q := range b.QueuedQueries {
+		var id string
+		switch q.SQL {
+		case documentQuery:
+			id = q.Arguments[0].(string)
+		case chunkQuery:
+			id = fmt.Sprintf("%s#%d", q.Arguments[0], q.Arguments[1])
+		case chunkEmbeddingQuery:
+			id = fmt.Sprintf("%s#%d/embedding", q.Arguments[0], q.Arguments[1])
+		default:
+			f.jobSQL++
+			continue
+		}
+		if err := f.reject[id]; err != nil {
+			res.failAt, res.err = len(ids), err
+			return res
+		}
+		ids = append(ids, id)
+		rows[id] = q.Arguments
+	}
+	res.failAt = -1
+	for _, id := range ids {
+		f.committed[id]++
+		f.rows[id] = rows[id]
+	}
+	return res
+}
+
+func (f *fakeDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dropConns > 0 {
+		f.dropConns--
+		return nil, errors.New("unexpected EOF")
+	}
+	return &fakeTx{db: f}, nil
+}
+
+// fakeTx supports the COPY path: staged rows land on commit.
+type fakeTx struct {
+	pgx.Tx
+	db     *fakeDB
+	staged []string
+	merged bool
+}
+
+func (tx *fakeTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	tx.merged = tx.merged || sql == mergeDocumentsQuery || sql == mergeChunksQuery
+	return pgconn.CommandTag{}, nil
+}
+
+func (tx *fakeTx) CopyFrom(ctx context.Context, table pgx.Identifier, columns []string, src pgx.CopyFromSource) (int64, error) {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	tx.db.copies++
+	for src.Next() {
+		values, _ := src.Values()
+		id := values[0].(string)
+		if len(columns) == len(chunkColumns) {
+			id = fmt.Sprintf("%s#%d", id, values[1])
+		}
+		if err := tx.db.reject[id]; err != nil {
+			return 0, err
+		}
+		tx.staged = append(tx.staged, id)
+	}
+	return int64(len(tx.staged)), nil
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	if tx.merged {
+		for _, id := range tx.staged {
+			tx.db.committed[id]++
+		}
+	}
+	return nil
+}
+
+func (tx *fakeTx) Rollback(ctx context.Context) error {
+	return nil
+}
+
+type fakeResults struct {
+	pgx.BatchResults
+	next   int
+	failAt int
+	err    error
+}
+
+func (r *fakeResults) Exec() (pgconn.CommandTag, error) {
+	defer func() { r.next++ }()
+	if r.err != nil && (r.failAt < 0 || r.next >= r.failAt) {
+		return pgconn.CommandTag{}, r.err
+	}
+	return pgconn.CommandTag{}, nil
+}
+
+func (r *fakeResults) Close() error {
+	return r.err
+}
+
+func trackedDoc(id string, outcome chan<- string) *core.Document[string] {
+	doc := &core.Document[string]{ID: id, Metadata: map[string]any{"job_id": "job-1"}}
+	doc.CT = core.NewCompletionTracker(func() { outcome <- id + ":ack" }, func() { outcome <- id + ":nack" })
+	return doc
+}
+
+func newTestPostgresSink(db PostgresDB, batchSize, maxBuffered int) *PostgresSink {
+	s := NewPostgresSink(db, batchSize, time.Hour, maxBuffered)
+	s.Retry.InitialBackoff = time.Millisecond
+	return s
+}
+
+func TestPagesByJob(t *testing.T) {
+	job := map[string]any{"job_id": "job-1"}
+	items := []*core.Document[string]{
+		{ID: "https://a.io/#chunk-0", ParentID: "https://a.io/", Metadata: job},
+		{ID: "https://a.io/#chunk-1", ParentID: "https://a.io/", Metadata: job},
+		{ID: "https://b.io/", Metadata: job},
+		{ID: "https://c.io/", Metadata: map[string]any{"job_id": "job-2"}},
+		{ID: "https://d.io/", Metadata: map[string]any{}},
+	}
+
+	got := pagesByJob(items)
+	if len(got) != 2 {
+		t.Fatalf("expected two jobs, got %v", got)
+	}
+	if pages := got["job-1"]; len(pages) != 2 || pages[0] != "https://a.io/" || pages[1] != "https://b.io/" {
+		t.Errorf("expected chunks to collapse onto their page, got %v", pages)
+	}
+}
+
+func TestMemorySink_PagesCrawledIsIdempotent(t *testing.T) {
+	s := NewMemorySink()
+	job := map[string]any{"job_id": "job-1"}
+	chunks := []*core.Document[string]{
+		{ID: "https://a.io/#chunk-0", ParentID: "https://a.io/", Metadata: job},
+		{ID: "https://a.io/#chunk-1", ParentID: "https://a.io/", Metadata: job},
+	}
+	// Discovery, a redelivery and the enrichment rewrite all land here.
+	for i := 0; i < 3; i++ {
+		for _, c := range chunks {
+			_ = s.Write(context.Background(), c)
+		}
+	}
+	if got := s.PagesCrawled("job-1"); got != 1 {
+		t.Errorf("expected one page, got %d", got)
+	}
+}
+
+func TestPostgresSink_RetriesLostConnection(t *testing.T) {
+	db := newFakeDB()
+	db.dropConns = 2
+	s := newTestPostgresSink(db, 2, 0)
+	defer s.Close()
+
+	outcome := make(chan string, 2)
+	for _, id := range []string{"https://a.io/", "https://b.io/"} {
+		doc := trackedDoc(id, outcome)
+		if err := s.Write(context.Background(), doc); err != nil {
+			t.Fatalf("write %s: %v", id, err)
+		}
+		go doc.CT.WaitAndFinish()
+	}
+
+	for i := 0; i < 2; i++ {
+		if got := <-outcome; got[len(got)-3:] != "ack" {
+			t.Errorf("expected acks after reconnecting, got %s", got)
+		}
+	}
+	if got := s.Stats().Retries.Load(); got != 2 {
+		t.Errorf("expected 2 retries, got %d", got)
+	}
+	if db.committed["https://a.io/"] != 1 || db.jobSQL == 0 {
+		t.Errorf("expected documents and job stats committed once, got %v (job statements %d)", db.committed, db.jobSQL)
+	}
+}
+
+func TestPostgresSink_RejectedRowDoesNotSinkBatch(t *testing.T) {
+	db := newFakeDB()
+	db.reject["https://bad.io/"] = &pgconn.PgError{Code: "22P05", Message: "unsupported unicode escape"}
+	s := newTestPostgresSink(db, 3, 0)
+	defer s.Close()
+
+	outcome := make(chan string, 3)
+	var errs []error
+	for _, id := range []string{"https://a.io/", "https://bad.io/", "https://c.io/"} {
+		doc := trackedDoc(id, outcome)
+		errs = append(errs, s.Write(context.Background(), doc))
+		go doc.CT.WaitAndFinish()
+	}
+
+	results := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		results[<-outcome] = true
+	}
+	if !results["https://a.io/:ack"] || !results["https://c.io/:ack"] || !results["https://bad.io/:nack"] {
+		t.Errorf("expected only the rejected row to fail, got %v", results)
+	}
+	if errs[2] != nil {
+		t.Errorf("expected the flushing write to succeed for its own document, got %v", errs[2])
+	}
+	if got := s.Stats().Retries.Load(); got != 0 {
+		t.Errorf("expected rejected rows not to be retried, got %d retries", got)
+	}
+}
+
+// stalledDB holds every batch until release is closed, like a saturated server.
+type stalledDB struct {
+	*fakeDB
+	stalled chan struct{}
+	release chan struct{}
+}
+
+func (d stalledDB) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	select {
+	case d.stalled <- struct{}{}:
+	default:
+	}
+	<-d.release
+	if err := ctx.Err(); err != nil {
+		return &fakeResults{failAt: -1, err: err}
+	}
+	return d.fakeDB.SendBatch(ctx, b)
+}
+
+func TestPostgresSink_Backpressure(t *testing.T) {
+	db := stalledDB{fakeDB: newFakeDB(), stalled: make(chan struct{}), release: make(chan struct{})}
+	s := newTestPostgresSink(db, 2, 2)
+	defer s.Close()
+
+	// The second write fills a batch whose flush stalls, holding both slots.
+	flushed := make(chan error, 1)
+	_ = s.Write(context.Background(), &core.Document[string]{ID: "https://a.io/"})
+	go func() { flushed <- s.Write(context.Background(), &core.Document[string]{ID: "https://b.io/"}) }()
+	<-db.stalled
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Write(ctx, &core.Document[string]{ID: "https://c.io/"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a full sink to block the writer, got %v", err)
+	}
+
+	close(db.release)
+	if err := <-flushed; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(context.Background(), &core.Document[string]{ID: "https://c.io/"}); err != nil {
+		t.Errorf("expected room once the flush completed, got %v", err)
+	}
+}
+
+func TestPostgresSink_FlushOutlivesTriggeringCaller(t *testing.T) {
+	db := stalledDB{fakeDB: newFakeDB(), stalled: make(chan struct{}), release: make(chan struct{})}
+	s := newTestPostgresSink(db, 2, 0)
+	defer s.Close()
+
+	outcome := make(chan string, 1)
+	first := trackedDoc("https://a.io/", outcome)
+	if err := s.Write(context.Background(), first); err != nil {
+		t.Fatal(err)
+	}
+	go first.CT.WaitAndFinish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	written := make(chan error, 1)
+	go func() { written <- s.Write(ctx, &core.Document[string]{ID: "https://b.io/"}) }()
+	<-db.stalled
+	cancel()
+	if err := <-written; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cancelled caller to stop waiting, got %v", err)
+	}
+
+	close(db.release)
+	if got := <-outcome; got != "https://a.io/:ack" {
+		t.Errorf("expected the batch to commit for the other caller, got %s", got)
+	}
+}
+
+func TestPostgresSink_WriteAfterClose(t *testing.T) {
+	s := newTestPostgresSink(newFakeDB(), 2, 0)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(context.Background(), &core.Document[string]{ID: "https://a.io/"}); !errors.Is(err, ErrSinkClosed) {
+		t.Errorf("expected ErrSinkClosed, got %v", err)
+	}
+}
+
+func TestPostgresSink_CopyIngest(t *testing.T) {
+	db := newFakeDB()
+	s := newTestPostgresSink(db, 3, 0)
+	s.Ingest = IngestCopy
+	defer s.Close()
+
+	outcome := make(chan string, 3)
+	// The same chunk twice in one flush must merge to a single row.
+	for _, id := range []string{"https://a.io/", "https://b.io/", "https://a.io/"} {
+		doc := trackedDoc(id, outcome)
+		if err := s.Write(context.Background(), doc); err != nil {
+			t.Fatal(err)
+		}
+		go doc.CT.WaitAndFinish()
+	}
+	for i := 0; i < 3; i++ {
+		<-outcome
+	}
+
+	if db.copies != 1 {
+		t.Errorf("expected one COPY per flush, got %d", db.copies)
+	}
+	if db.committed["https://a.io/"] != 1 || db.committed["https://b.io/"] != 1 {
+		t.Errorf("expected each document merged once, got %v", db.committed)
+	}
+}
+
+func TestPostgresSink_CopyFallsBackOnRejectedRow(t *testing.T) {
+	db := newFakeDB()
+	db.reject["https://bad.io/"] = &pgconn.PgError{Code: "22021", Message: "invalid byte sequence"}
+	s := newTestPostgresSink(db, 2, 0)
+	s.Ingest = IngestCopy
+	defer s.Close()
+
+	outcome := make(chan string, 2)
+	for _, id := range []string{"https://bad.io/", "https://a.io/"} {
+		doc := trackedDoc(id, outcome)
+		_ = s.Write(context.Background(), doc)
+		go doc.CT.WaitAndFinish()
+	}
+
+	results := map[string]bool{<-outcome: true, <-outcome: true}
+	if !results["https://a.io/:ack"] || !results["https://bad.io/:nack"] {
+		t.Errorf("expected the batch path to isolate the rejected row, got %v", results)
+	}
+}
+
+func TestStagingRows(t *testing.T) {
+	rows := stagingRows([]*core.Document[string]{
+		{ID: "a", Content: "v1"},
+		{ID: "b"},
+		{ID: "a", Content: "v2"},
+	}, func(d *core.Document[string]) string { return d.ID }, documentRow)
+	if len(rows) != 2 || rows[0][5] != "v2" {
+		t.Errorf("expected the last write per id to win, got %v", rows)
+	}
+	if len(rows[0]) != len(documentColumns) {
+		t.Errorf("expected %d columns per row, got %d", len(documentColumns), len(rows[0]))
+	}
+}
+
+func TestPostgresSink_SplitsPagesAndChunks(t *testing.T) {
+	db := newFakeDB()
+	s := newTestPostgresSink(db, 3, 0)
+	defer s.Close()
+
+	page := &core.Document[string]{ID: "https://a.io/", Content: "full page", Metadata: map[string]any{"title": "A"}}
+	chunk := func(i int, extra map[string]any) *core.Document[string] {
+		meta := map[string]any{"title": "A", "is_chunk": true, "chunk_index": float64(i)}
+		for k, v := range extra {
+			meta[k] = v
+		}
+		return &core.Document[string]{ID: fmt.Sprintf("https://a.io/#chunk%d", i), ParentID: "https://a.io/", Metadata: meta}
+	}
+
+	// Chunks may reach the sink ahead of their page within a flush.
+	for _, doc := range []*core.Document[string]{chunk(0, nil), page, chunk(1, nil)} {
+		if err := s.Write(context.Background(), doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if db.committed["https://a.io/"] != 1 || db.committed["https://a.io/#0"] != 1 || db.committed["https://a.io/#1"] != 1 {
+		t.Errorf("expected one page row and two chunk rows, got %v", db.committed)
+	}
+
+	row := chunkRow(chunk(2, map[string]any{"vector": []float32{1}, "summary": "s", "metadata_extracted": true, "namespace": "n", "embedding_model": "m", "embedding_dims": 1}))
+	if row[0] != "https://a.io/" || row[1] != 2 || row[6] != EnrichmentEnriched || row[7] != 1 {
+		t.Errorf("unexpected chunk row %v", row)
+	}
+	if row[10] != "m" || row[11] != 1 || row[13] == nil {
+		t.Errorf("expected the embedding model, size and time to be stored, got %v", row[10:])
+	}
+	if pending := chunkRow(chunk(3, nil)); pending[10] != nil || pending[13] != nil {
+		t.Errorf("expected no embedding columns before the chunk is embedded, got %v", pending[10:])
+	}
+	skipped := chunk(4, map[string]any{"vector": []float32{1}})
+	skipped.CT = core.NewCompletionTracker(nil, nil)
+	skipped.CT.SetErr(errors.New("llm unavailable"))
+	if row := chunkRow(skipped); row[6] != EnrichmentPending || row[7] != 0 || row[8] != "llm unavailable" || row[13] == nil {
+		t.Errorf("expected an embedded chunk without metadata to stay pending with the stage's error, got %v", row)
+	}
+	if enrichment := row[9].(map[string]any); len(enrichment) != 1 || enrichment["summary"] != "s" {
+		t.Errorf("expected only per-chunk enrichment to be kept, got %v", enrichment)
+	}
+	if ordered := pagesFirst([]*core.Document[string]{chunk(0, nil), page}); ordered[0] != page {
+		t.Error("expected the page to be written before its chunks")
+	}
+}
+
+func TestPostgresSink_RecordFailure(t *testing.T) {
+	db := newFakeDB()
+	s := newTestPostgresSink(db, 10, 0)
+	defer s.Close()
+
+	ctx := context.Background()
+	chunk := &core.Document[string]{ID: "https://a.io/#chunk0", ParentID: "https://a.io/", Content: "text", Metadata: map[string]any{"is_chunk": true, "chunk_index": float64(0)}}
+	if err := s.RecordFailure(ctx, chunk, false, errors.New("llm unavailable")); err != nil {
+		t.Fatal(err)
+	}
+	if row := db.rows["https://a.io/#0"]; row[6] != EnrichmentPending || row[7] != 1 || row[8] != "llm unavailable" {
+		t.Errorf("expected a retried chunk to stay pending with its error, got %v", row)
+	}
+
+	if err := s.RecordFailure(ctx, chunk, true, errors.New(strings.Repeat("x", 2*maxLastError))); err != nil {
+		t.Fatal(err)
+	}
+	if row := db.rows["https://a.io/#0"]; row[6] != EnrichmentFailed || len(row[8].(string)) != maxLastError {
+		t.Errorf("expected a final failure to be FAILED with a bounded error, got status %v", row[6])
+	}
+
+	page := &core.Document[string]{ID: "https://a.io/", Content: "page"}
+	if err := s.RecordFailure(ctx, page, true, errors.New("boom")); err != nil {
+		t.Fatal(err)
+	}
+	if db.committed["https://a.io/"] != 0 {
+		t.Error("expected pages to carry no enrichment state")
+	}
+}
+
+func TestPostgresSink_RecordEmbeddings(t *testing.T) {
+	db := newFakeDB()
+	s := newTestPostgresSink(db, 10, 0)
+	defer s.Close()
+
+	embeddedAt := time.Now().UTC()
+	chunk := &core.Document[string]{ID: "https://a.io/#chunk1", ParentID: "https://a.io/", Metadata: map[string]any{
+		"is_chunk": true, "chunk_index": 1, "vector": []float32{1, 0},
+		"embedding_model": "new-model", "embedding_dims": 2, "embedding_task": "search_document", "embedded_at": embeddedAt,
+	}}
+	unembedded := &core.Document[string]{ID: "https://a.io/#chunk2", ParentID: "https://a.io/", Metadata: map[string]any{"is_chunk": true, "chunk_index": 2}}
+
+	if err := s.RecordEmbeddings(context.Background(), []*core.Document[string]{chunk, unembedded}); err != nil {
+		t.Fatal(err)
+	}
+	row := db.rows["https://a.io/#1/embedding"]
+	if row == nil || row[2] != "new-model" || row[3] != 2 || row[4] != "search_document" || row[5] != embeddedAt {
+		t.Errorf("expected the new embedding to be recorded, got %v", row)
+	}
+	if _, ok := db.rows["https://a.io/#2/embedding"]; ok {
+		t.Error("expected chunks without an embedding to be skipped")
+	}
+}
@@ -2,33 +2,115 @@ package sink
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/oranjParker/Rarefactor/internal/core"
 	"github.com/oranjParker/Rarefactor/internal/database"
 )
 
+// VectorStore is satisfied by database.QdrantClient and the in-memory index
+// used by the Lite profile.
+type VectorStore interface {
+	UpsertBatch(ctx context.Context, collection string, points []database.QdrantPoint) error
+}
+
+// SpecSource reports the embedding a collection, or the collection an alias
+// points at, currently holds. database.QdrantClient caches it briefly.
+type SpecSource interface {
+	Spec(ctx context.Context, collection string) (database.EmbeddingSpec, error)
+}
+
 type QdrantSink struct {
-	client     *database.QdrantClient
+	client     VectorStore
 	collection string
+	// Spec is the collection's embedding. When set, vectors of another
+	// model or size are rejected instead of being mixed into it.
+	Spec    database.EmbeddingSpec
+	Breaker *core.CircuitBreaker
 }
 
-func NewQdrantSink(client *database.QdrantClient, collection string) *QdrantSink {
+func NewQdrantSink(client VectorStore, collection string) *QdrantSink {
 	return &QdrantSink{
 		client:     client,
 		collection: collection,
+		Breaker:    core.NewCircuitBreaker("qdrant", 5, 30*time.Second),
 	}
 }
 
 func (s *QdrantSink) Write(ctx context.Context, doc *core.Document[string]) error {
+	err := s.WriteBatch(ctx, []*core.Document[string]{doc})
+	var failed core.ItemErrors
+	if errors.As(err, &failed) {
+		return failed[0]
+	}
+	return err
+}
+
+// WriteBatch upserts all valid documents in a single Qdrant request. A
+// document without a usable vector, or whose embedding the collection does
+// not hold, is reported in core.ItemErrors while the rest are written.
+func (s *QdrantSink) WriteBatch(ctx context.Context, docs []*core.Document[string]) error {
+	specs := []database.EmbeddingSpec{}
+	if s.Spec.Dimension > 0 {
+		specs = append(specs, s.Spec)
+	}
+	// After a reindex swaps the alias, workers still on the old model must
+	// not write into the new collection.
+	if src, ok := s.client.(SpecSource); ok {
+		current, err := src.Spec(ctx, s.collection)
+		if err != nil {
+			return fmt.Errorf("qdrant collection check failed: %w", err)
+		}
+		specs = append(specs, current)
+	}
+
+	failed := core.ItemErrors{}
+	points := make([]database.QdrantPoint, 0, len(docs))
+	for i, doc := range docs {
+		point, err := toQdrantPoint(doc)
+		if err != nil {
+			failed[i] = err
+			continue
+		}
+		for _, spec := range specs {
+			if err := spec.Check(point.Spec()); err != nil {
+				failed[i] = &core.PermanentError{Err: fmt.Errorf("document %s: %w", doc.ID, err)}
+				break
+			}
+		}
+		if failed[i] == nil {
+			points = append(points, point)
+		}
+	}
+
+	if len(points) > 0 {
+		err := s.Breaker.Execute(ctx, func(ctx context.Context) error {
+			return s.client.UpsertBatch(ctx, s.collection, points)
+		})
+		if err != nil {
+			return fmt.Errorf("qdrant upsert failed: %w", err)
+		}
+	}
+
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// toQdrantPoint fails permanently for a document without a usable vector:
+// writing it again cannot succeed.
+func toQdrantPoint(doc *core.Document[string]) (database.QdrantPoint, error) {
 	val, ok := doc.Metadata["vector"]
 	if !ok {
-		return fmt.Errorf("document %s missing vector data", doc.ID)
+		return database.QdrantPoint{}, &core.PermanentError{Err: fmt.Errorf("document %s missing vector data", doc.ID)}
 	}
 
 	vector, ok := val.([]float32)
 	if !ok {
-		return fmt.Errorf("invalid vector type for document %s", doc.ID)
+		return database.QdrantPoint{}, &core.PermanentError{Err: fmt.Errorf("invalid vector type for document %s", doc.ID)}
 	}
 
 	summary := doc.Content
@@ -40,20 +122,41 @@ func (s *QdrantSink) Write(ctx context.Context, doc *core.Document[string]) erro
 	if t, ok := doc.Metadata["title"].(string); ok {
 		title = t
 	}
+	model, _ := doc.Metadata["embedding_model"].(string)
+	task, _ := doc.Metadata["embedding_task"].(string)
+	embeddedAt, _ := doc.Metadata["embedded_at"].(time.Time)
 
-	err := s.client.Upsert(
-		ctx,
-		s.collection,
-		doc.ID,
-		title,
-		summary,
-		vector,
-	)
-	if err != nil {
-		return fmt.Errorf("qdrant upsert failed: %w", err)
+	pageURL := doc.ID
+	if isChunk(doc) {
+		pageURL = doc.ParentID
+	}
+	namespace, _ := doc.Metadata["namespace"].(string)
+	if namespace == "" {
+		namespace = "default"
+	}
+	jobID, _ := doc.Metadata["job_id"].(string)
+	language, _ := doc.Metadata["language"].(string)
+	crawledAt := doc.CreatedAt
+	if secs := metaInt(doc, "crawled_at"); secs > 0 {
+		crawledAt = time.Unix(int64(secs), 0)
 	}
 
-	return nil
+	return database.QdrantPoint{
+		URL:        doc.ID,
+		Title:      title,
+		Snippet:    summary,
+		Vector:     vector,
+		Model:      model,
+		Task:       task,
+		EmbeddedAt: embeddedAt,
+		PageURL:    pageURL,
+		ChunkIndex: metaInt(doc, "chunk_index"),
+		Namespace:  namespace,
+		Domain:     extractDomain(pageURL),
+		JobID:      jobID,
+		Language:   language,
+		CrawledAt:  crawledAt,
+	}, nil
 }
 
 func (s *QdrantSink) Close() error {
@@ -0,0 +1,171 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/database"
+)
+
+func TestQdrantSink_RefusesOtherEmbeddings(t *testing.T) {
+	index := database.NewMemoryVectorIndex()
+	s := NewQdrantSink(index, "documents")
+	s.Spec = database.EmbeddingSpec{Model: "model-a", Dimension: 4, Task: "search_document"}
+
+	embedded := func(id, model string, dims int) *core.Document[string] {
+		return &core.Document[string]{ID: id, Metadata: map[string]any{
+			"vector":          make([]float32, dims),
+			"embedding_model": model,
+			"embedding_task":  "search_document",
+			"embedded_at":     time.Now(),
+		}}
+	}
+
+	if err := s.Write(context.Background(), embedded("https://a.io/#chunk0", "model-a", 4)); err != nil {
+		t.Fatal(err)
+	}
+	for _, doc := range []*core.Document[string]{
+		embedded("https://a.io/#chunk1", "model-b", 4),
+		embedded("https://a.io/#chunk2", "model-a", 8),
+	} {
+		err := s.Write(context.Background(), doc)
+		var pe *core.PermanentError
+		if !errors.As(err, &pe) || !errors.Is(err, database.ErrEmbeddingMismatch) {
+			t.Errorf("%s: expected a permanent mismatch error, got %v", doc.ID, err)
+		}
+	}
+	if index.Len("documents") != 1 {
+		t.Errorf("expected only the matching vector to be stored, got %d", index.Len("documents"))
+	}
+}
+
+func TestQdrantSink_StoresFilterablePayload(t *testing.T) {
+	index := database.NewMemoryVectorIndex()
+	s := NewQdrantSink(index, "documents")
+	crawled := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// Metadata as it arrives over NATS: numbers have been through JSON.
+	err := s.Write(context.Background(), &core.Document[string]{
+		ID:       "https://www.a.io/post#chunk2",
+		ParentID: "https://www.a.io/post",
+		Content:  "text",
+		Metadata: map[string]any{
+			"vector":      []float32{1, 0},
+			"is_chunk":    true,
+			"chunk_index": float64(2),
+			"namespace":   "docs",
+			"job_id":      "job-1",
+			"language":    "en",
+			"crawled_at":  float64(crawled.Unix()),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hits, err := index.Search(context.Background(), "documents", []float32{1, 0}, 10, database.SearchFilter{})
+	if err != nil || len(hits) != 1 {
+		t.Fatalf("expected one hit, got %v (%v)", hits, err)
+	}
+	p := hits[0].QdrantPoint
+	if p.PageURL != "https://www.a.io/post" || p.ChunkIndex != 2 || p.Domain != "a.io" || p.Namespace != "docs" ||
+		p.JobID != "job-1" || p.Language != "en" || !p.CrawledAt.Equal(crawled) {
+		t.Errorf("unexpected point fields %+v", p)
+	}
+
+	for _, tc := range []struct {
+		filter database.SearchFilter
+		hits   int
+	}{
+		{database.SearchFilter{Namespace: "docs", Domain: "a.io", ChunkIndexes: []int{0, 2}}, 1},
+		{database.SearchFilter{CrawledAfter: crawled.Add(-time.Hour), CrawledBefore: crawled}, 1},
+		{database.SearchFilter{Language: "de"}, 0},
+		{database.SearchFilter{ChunkIndexes: []int{0}}, 0},
+		{database.SearchFilter{CrawledAfter: crawled.Add(time.Second)}, 0},
+	} {
+		hits, err := index.Search(context.Background(), "documents", []float32{1, 0}, 10, tc.filter)
+		if err != nil || len(hits) != tc.hits {
+			t.Errorf("filter %+v: expected %d hits, got %d (%v)", tc.filter, tc.hits, len(hits), err)
+		}
+	}
+}
+
+func TestQdrantSink_FailsOnlyBadDocuments(t *testing.T) {
+	index := database.NewMemoryVectorIndex()
+	s := NewQdrantSink(index, "documents")
+	s.Spec = database.EmbeddingSpec{Model: "model-a", Dimension: 2}
+
+	docs := []*core.Document[string]{
+		{ID: "https://a.io/#chunk0", Metadata: map[string]any{"vector": []float32{1, 0}, "embedding_model": "model-a"}},
+		{ID: "https://a.io/#chunk1", Metadata: map[string]any{}},
+		{ID: "https://a.io/#chunk2", Metadata: map[string]any{"vector": []float32{0, 1}, "embedding_model": "model-b"}},
+		{ID: "https://a.io/#chunk3", Metadata: map[string]any{"vector": []float32{1, 1}, "embedding_model": "model-a"}},
+	}
+	err := s.WriteBatch(context.Background(), docs)
+
+	var failed core.ItemErrors
+	if !errors.As(err, &failed) || len(failed) != 2 || failed[1] == nil || failed[2] == nil {
+		t.Fatalf("expected items 1 and 2 to fail, got %v", err)
+	}
+	var pe *core.PermanentError
+	if !errors.As(failed[1], &pe) {
+		t.Errorf("expected the missing vector to be permanent, got %v", failed[1])
+	}
+	if !errors.As(failed[2], &pe) {
+		t.Errorf("expected the model mismatch to be permanent, got %v", failed[2])
+	}
+	if index.Len("documents") != 2 {
+		t.Errorf("expected the two valid chunks to be stored, got %d", index.Len("documents"))
+	}
+
+	// Behind a BatchingSink only the bad documents' writes fail.
+	batching := core.NewBatchingSink[*core.Document[string]](NewQdrantSink(database.NewMemoryVectorIndex(), "documents"), 2, time.Hour)
+	defer batching.Close()
+	errs := make(chan error, 2)
+	for _, doc := range docs[:2] {
+		go func(doc *core.Document[string]) { errs <- batching.Write(context.Background(), doc) }(doc)
+	}
+	var nils int
+	for range 2 {
+		if err := <-errs; err == nil {
+			nils++
+		}
+	}
+	if nils != 1 {
+		t.Errorf("expected exactly one write to succeed, got %d", nils)
+	}
+}
+
+// aliasedIndex reports a collection spec the way QdrantClient.Spec does once
+// a reindex has moved the alias to another model.
+type aliasedIndex struct {
+	*database.MemoryVectorIndex
+	spec database.EmbeddingSpec
+}
+
+func (a *aliasedIndex) Spec(ctx context.Context, collection string) (database.EmbeddingSpec, error) {
+	return a.spec, nil
+}
+
+func TestQdrantSink_ChecksCurrentCollection(t *testing.T) {
+	index := &aliasedIndex{
+		MemoryVectorIndex: database.NewMemoryVectorIndex(),
+		spec:              database.EmbeddingSpec{Model: "model-b", Dimension: 2},
+	}
+	s := NewQdrantSink(index, "documents")
+	s.Spec = database.EmbeddingSpec{Model: "model-a", Dimension: 2}
+
+	err := s.Write(context.Background(), &core.Document[string]{
+		ID:       "https://a.io/#chunk0",
+		Metadata: map[string]any{"vector": []float32{1, 0}, "embedding_model": "model-a"},
+	})
+	if !errors.Is(err, database.ErrEmbeddingMismatch) {
+		t.Errorf("expected an old-model write to be refused after the swap, got %v", err)
+	}
+	if index.Len("documents") != 0 {
+		t.Errorf("expected nothing to be stored, got %d", index.Len("documents"))
+	}
+}
@@ -0,0 +1,204 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/processor"
+)
+
+const (
+	defaultBacklogMinAge   = 10 * time.Minute
+	defaultBacklogPageSize = 500
+)
+
+// BacklogDB is the part of a pgx pool the backlog reads and updates through.
+type BacklogDB interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// The page row supplies what the chunker copied onto each chunk in flight.
+// Chunks are read in key order so a page of results resumes after the last.
+const backlogQuery = `
+	SELECT
+		c.document_id, c.chunk_index, c.content, c.start_offset, c.end_offset,
+		c.token_count, c.enrichment, d.namespace, d.source, d.metadata,
+		COALESCE(d.crawled_at, NOW())
+	FROM chunks c
+	JOIN documents d ON d.id = c.document_id
+	WHERE c.enrichment_status = ANY($1)
+		AND c.updated_at < $2
+		AND c.updated_at >= $3
+		AND (c.document_id, c.chunk_index) > ($4, $5)
+		AND (NOT $7 OR c.embedded_at IS NOT NULL OR c.enrichment_status = 'ENRICHED')
+	ORDER BY c.document_id, c.chunk_index
+	LIMIT $6
+`
+
+const markPendingQuery = `
+	UPDATE chunks
+	SET enrichment_status = 'PENDING', updated_at = NOW()
+	WHERE document_id = $1 AND chunk_index = $2 AND enrichment_status <> 'ENRICHED'
+`
+
+// ChunkBacklog streams stored chunks that still need enrichment, rebuilt as
+// the documents the chunker publishes, so they can be enqueued again.
+type ChunkBacklog struct {
+	DB BacklogDB
+	// Statuses selects which chunks are read, PENDING and FAILED by default.
+	Statuses []string
+	// MinAge skips chunks written more recently; they are likely still
+	// queued from the crawl that wrote them.
+	MinAge time.Duration
+	// UpdatedSince, if set, skips chunks last written before it.
+	UpdatedSince time.Time
+	// Embedded keeps only chunks that have a vector, whatever their status.
+	// ENRICHED chunks count even without embedding columns, which chunks
+	// embedded before those existed lack.
+	Embedded bool
+	PageSize int
+	// Limit caps the number of chunks streamed; zero streams them all.
+	Limit int
+
+	err error
+}
+
+func NewChunkBacklog(db BacklogDB) *ChunkBacklog {
+	return &ChunkBacklog{
+		DB:       db,
+		Statuses: []string{"PENDING", "FAILED"},
+		MinAge:   defaultBacklogMinAge,
+		PageSize: defaultBacklogPageSize,
+	}
+}
+
+// Stream reads the backlog as of the call. Err reports why it stopped early
+// once the channel is closed.
+func (b *ChunkBacklog) Stream(ctx context.Context) (<-chan *core.Document[string], error) {
+	out := make(chan *core.Document[string])
+	cutoff := time.Now().Add(-b.MinAge)
+
+	go func() {
+		defer close(out)
+
+		var (
+			lastID    string
+			lastIndex = -1
+			streamed  int
+		)
+		for {
+			docs, err := b.page(ctx, cutoff, lastID, lastIndex)
+			if err != nil {
+				slog.Error("backlog read failed", "component", "chunk_backlog", "error", err)
+				b.err = err
+				return
+			}
+			for _, doc := range docs {
+				if b.Limit > 0 && streamed >= b.Limit {
+					return
+				}
+				select {
+				case out <- doc:
+					streamed++
+				case <-ctx.Done():
+					b.err = ctx.Err()
+					return
+				}
+			}
+			if len(docs) < b.PageSize {
+				return
+			}
+			last := docs[len(docs)-1]
+			lastID, lastIndex = last.ParentID, metaIndex(last)
+		}
+	}()
+
+	return out, nil
+}
+
+func (b *ChunkBacklog) Err() error {
+	return b.err
+}
+
+// MarkPending records that a chunk was enqueued again: a FAILED chunk goes
+// back to PENDING, and the fresh updated_at keeps the next run from
+// re-enqueueing it before MinAge has passed.
+func (b *ChunkBacklog) MarkPending(ctx context.Context, doc *core.Document[string]) error {
+	_, err := b.DB.Exec(ctx, markPendingQuery, doc.ParentID, metaIndex(doc))
+	return err
+}
+
+func (b *ChunkBacklog) page(ctx context.Context, cutoff time.Time, afterID string, afterIndex int) ([]*core.Document[string], error) {
+	rows, err := b.DB.Query(ctx, backlogQuery, b.Statuses, cutoff, b.UpdatedSince, afterID, afterIndex, b.PageSize, b.Embedded)
+	if err != nil {
+		return nil, fmt.Errorf("backlog query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var docs []*core.Document[string]
+	for rows.Next() {
+		var (
+			c         backlogChunk
+			namespace string
+		)
+		if err := rows.Scan(&c.pageID, &c.index, &c.content, &c.start, &c.end, &c.tokens, &c.enrichment, &namespace, &c.source, &c.page, &c.crawledAt); err != nil {
+			return nil, fmt.Errorf("backlog scan failed: %w", err)
+		}
+		if c.page == nil {
+			c.page = make(map[string]any)
+		}
+		c.page["namespace"] = namespace
+		docs = append(docs, c.document())
+	}
+	return docs, rows.Err()
+}
+
+type backlogChunk struct {
+	pageID     string
+	index      int
+	content    string
+	start, end int
+	tokens     int
+	enrichment map[string]any
+	source     string
+	page       map[string]any
+	crawledAt  time.Time
+}
+
+// document rebuilds the chunk as the chunker emitted it: the page's
+// metadata plus the chunk's own fields and any enrichment already stored.
+func (c backlogChunk) document() *core.Document[string] {
+	meta := make(map[string]any, len(c.page)+len(c.enrichment)+6)
+	for k, v := range c.page {
+		meta[k] = v
+	}
+	for k, v := range c.enrichment {
+		meta[k] = v
+	}
+	meta["is_chunk"] = true
+	meta["chunk_index"] = c.index
+	meta["chunk_size"] = len(c.content)
+	meta["chunk_start"] = c.start
+	meta["chunk_end"] = c.end
+	meta["token_count"] = c.tokens
+
+	return &core.Document[string]{
+		ID:        processor.ChunkID(c.pageID, c.index),
+		ParentID:  c.pageID,
+		Source:    c.source,
+		Content:   c.content,
+		Metadata:  meta,
+		CreatedAt: c.crawledAt,
+	}
+}
+
+func metaIndex(doc *core.Document[string]) int {
+	i, _ := doc.Metadata["chunk_index"].(int)
+	return i
+}
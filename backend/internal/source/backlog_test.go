@@ -0,0 +1,36 @@
+package source
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBacklogChunk_Document(t *testing.T) {
+	c := backlogChunk{
+		pageID:     "https://a.io/",
+		index:      2,
+		content:    "third chunk",
+		start:      40,
+		end:        51,
+		tokens:     3,
+		enrichment: map[string]any{"summary": "s"},
+		source:     "web",
+		page:       map[string]any{"namespace": "docs", "job_id": "job-1", "title": "A"},
+		crawledAt:  time.Unix(100, 0),
+	}
+	doc := c.document()
+
+	if doc.ID != "https://a.io/#chunk2" || doc.ParentID != c.pageID || doc.Content != c.content {
+		t.Errorf("expected the chunker's identity, got id=%s parent=%s", doc.ID, doc.ParentID)
+	}
+	if doc.Metadata["is_chunk"] != true || metaIndex(doc) != 2 || doc.Metadata["chunk_end"] != 51 {
+		t.Errorf("expected chunk fields in metadata, got %v", doc.Metadata)
+	}
+	if doc.Metadata["job_id"] != "job-1" || doc.Metadata["namespace"] != "docs" || doc.Metadata["summary"] != "s" {
+		t.Errorf("expected page metadata and enrichment to be carried over, got %v", doc.Metadata)
+	}
+	doc.Metadata["title"] = "changed"
+	if c.page["title"] != "A" {
+		t.Error("expected the page metadata to be copied, not shared")
+	}
+}
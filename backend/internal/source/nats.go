@@ -3,94 +3,204 @@ package source
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"sync"
+	"time"
 
+	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/database"
+	"github.com/oranjParker/Rarefactor/internal/metrics"
+	"github.com/oranjParker/Rarefactor/internal/tracing"
 )
 
+// OriginalSubjectHeader records where a requeued or dead-lettered message was
+// first published.
+const OriginalSubjectHeader = "Rarefactor-Original-Subject"
+
+const (
+	republishTimeout = 5 * time.Second
+	// serverAckWait is JetStream's AckWait when the consumer leaves it unset.
+	serverAckWait = 30 * time.Second
+)
+
+// FailureRecorder is told about documents whose processing failed. final is
+// set when no redelivery will follow: the error was permanent or the message
+// was dead-lettered. err may be nil when a node failed without one.
+type FailureRecorder interface {
+	RecordFailure(ctx context.Context, doc *core.Document[string], final bool, err error) error
+}
+
 type NatsSource struct {
-	JS      jetstream.JetStream
-	Subject string
-	Queue   string
+	JS         jetstream.JetStream
+	StreamName string
+	Subject    string
+	Queue      string
+	// Limits are applied to the durable consumer; the zero value keeps the
+	// server defaults.
+	Limits database.ConsumerLimits
+	// HeartbeatInterval is how often a pending message is marked in progress
+	// so slow work (SPA renders, LLM calls) is not redelivered mid-flight.
+	// Zero derives it from Limits.AckWait.
+	HeartbeatInterval time.Duration
+	// DeadLetterSubject receives messages that fail their final delivery.
+	// Empty terminates them instead.
+	DeadLetterSubject string
+	// Failures, if set, is told about every failed delivery before the
+	// message is settled.
+	Failures FailureRecorder
+	// PullMaxMessages caps how many messages the consumer buffers ahead of
+	// the graph; zero keeps the client default.
+	PullMaxMessages int
+	// Gates are critical downstream dependencies. While any is not ready the
+	// source stops pulling so messages stay in the stream instead of being
+	// delivered, failed and redelivered in a loop.
+	Gates []core.Gate
 }
 
-func NewNatsSource(js jetstream.JetStream, subject, queue string) *NatsSource {
+func NewNatsSource(js jetstream.JetStream, stream, subject, queue string) *NatsSource {
 	return &NatsSource{
-		JS:      js,
-		Subject: subject,
-		Queue:   queue,
+		JS:         js,
+		StreamName: stream,
+		Subject:    subject,
+		Queue:      queue,
 	}
 }
 
 func (n *NatsSource) Stream(ctx context.Context) (<-chan *core.Document[string], error) {
 	out := make(chan *core.Document[string])
 
-	consumer, err := n.JS.CreateOrUpdateConsumer(ctx, "CRAWL_JOBS", jetstream.ConsumerConfig{
+	consumerCfg := jetstream.ConsumerConfig{
 		Durable:       n.Queue,
 		FilterSubject: n.Subject,
 		AckPolicy:     jetstream.AckExplicitPolicy,
-	})
+	}
+	n.Limits.Apply(&consumerCfg)
+
+	consumer, err := n.JS.CreateOrUpdateConsumer(ctx, n.StreamName, consumerCfg)
 	if err != nil {
 		return nil, fmt.Errorf("nats consumer setup failed: %w", err)
 	}
 
-	iter, err := consumer.Messages()
+	var pullOpts []jetstream.PullMessagesOpt
+	if n.PullMaxMessages > 0 {
+		pullOpts = append(pullOpts, jetstream.PullMaxMessages(n.PullMaxMessages))
+	}
+
+	iter, err := consumer.Messages(pullOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("nats consumer iterator failed: %w", err)
 	}
 
 	go func() {
 		defer close(out)
-		defer iter.Stop()
+		defer func() { iter.Stop() }()
 
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			default:
+				if !n.gatesReady() {
+					iter.Stop()
+					slog.Warn("downstream unavailable, pausing consumption", "component", "nats_source", "subject", n.Subject)
+					if err := n.waitForGates(ctx); err != nil {
+						return
+					}
+					slog.Info("downstream recovered, resuming consumption", "component", "nats_source", "subject", n.Subject)
+					iter, err = consumer.Messages(pullOpts...)
+					if err != nil {
+						slog.Error("failed to resume consumer iterator", "component", "nats_source", "subject", n.Subject, "error", err)
+						return
+					}
+				}
+
 				msg, err := iter.Next()
+				if errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+					slog.Warn("consumer iterator closed, stopping", "component", "nats_source", "subject", n.Subject)
+					return
+				}
 				if err != nil {
-					log.Printf("[NATS Source] NextMsg error: %v", err)
+					slog.Warn("next message failed", "component", "nats_source", "subject", n.Subject, "error", err)
 					continue
 				}
 
+				metrics.NatsMessages.WithLabelValues(n.Subject, "delivered").Inc()
+				var delivered uint64
+				if meta, err := msg.Metadata(); err == nil {
+					delivered = meta.NumDelivered
+					metrics.NatsDeliveryCount.WithLabelValues(n.Subject).Observe(float64(meta.NumDelivered))
+					if meta.NumDelivered > 1 {
+						metrics.NatsRedeliveries.WithLabelValues(n.Subject).Inc()
+					}
+				}
+
 				var doc core.Document[string]
 				msgData := msg.Data()
 				if err := json.Unmarshal(msgData, &doc); err != nil {
-					log.Printf("[NATS Source] Malformed JSON, Terminating msg: %v", err)
+					slog.Error("malformed message, terminating", "component", "nats_source", "subject", n.Subject, "error", err)
 					msg.Term()
+					metrics.NatsMessages.WithLabelValues(n.Subject, "term").Inc()
 					continue
 				}
 
 				if doc.Metadata == nil {
 					doc.Metadata = make(map[string]any)
 				}
+				doc.Trace = tracing.Extract(msg.Headers())
 
 				var once sync.Once
+				settled := make(chan struct{})
+				var ct *core.CompletionTracker
 				ack := func() {
 					once.Do(func() {
+						defer close(settled)
+						// A permanent error is acked, never to be retried.
+						if err := ct.Err(); err != nil {
+							n.recordFailure(ctx, &doc, true, err)
+						}
 						if err := msg.Ack(); err != nil {
-							log.Printf("[NATS Source] Failed to Ack msg for %s: %v", doc.ID, err)
+							slog.Error("ack failed", append(doc.LogAttrs(), "component", "nats_source", "error", err)...)
 						}
+						metrics.NatsMessages.WithLabelValues(n.Subject, "ack").Inc()
 					})
 				}
 
 				nack := func() {
 					once.Do(func() {
-						if err := msg.Nak(); err != nil {
-							log.Printf("[NATS Source] Failed to Nack msg for %s: %v", doc.ID, err)
+						defer close(settled)
+						final := n.finalDelivery(delivered) && ct.RetryAfter() == 0
+						n.recordFailure(ctx, &doc, final, ct.Err())
+						if n.finalDelivery(delivered) {
+							n.exhausted(ctx, msg, ct.RetryAfter(), doc.LogAttrs())
+							return
+						}
+
+						var err error
+						if delay := ct.RetryAfter(); delay > 0 {
+							err = msg.NakWithDelay(delay)
+						} else {
+							err = msg.Nak()
 						}
+						if err != nil {
+							slog.Error("nak failed", append(doc.LogAttrs(), "component", "nats_source", "error", err)...)
+						}
+						metrics.NatsMessages.WithLabelValues(n.Subject, "nak").Inc()
 					})
 				}
 
-				doc.CT = core.NewCompletionTracker(ack, nack)
+				ct = core.NewCompletionTracker(ack, nack)
+				doc.CT = ct
+				go n.heartbeat(msg, settled)
 
 				select {
 				case out <- &doc:
 				case <-ctx.Done():
+					// Never handed to the graph; leave it for redelivery.
+					once.Do(func() { close(settled) })
 					return
 				}
 			}
@@ -99,3 +209,114 @@ func (n *NatsSource) Stream(ctx context.Context) (<-chan *core.Document[string],
 
 	return out, nil
 }
+
+func (n *NatsSource) heartbeatInterval() time.Duration {
+	if n.HeartbeatInterval > 0 {
+		return n.HeartbeatInterval
+	}
+	ackWait := n.Limits.AckWait
+	if ackWait <= 0 {
+		ackWait = serverAckWait
+	}
+	// A third of AckWait leaves room for two missed beats before redelivery.
+	return ackWait / 3
+}
+
+// heartbeat resets the message's AckWait until it is acked or nacked. It
+// outlives the source context so documents still draining through the graph
+// on shutdown are not redelivered to another worker.
+func (n *NatsSource) heartbeat(msg jetstream.Msg, settled <-chan struct{}) {
+	ticker := time.NewTicker(n.heartbeatInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-settled:
+			return
+		case <-ticker.C:
+			if err := msg.InProgress(); err != nil {
+				slog.Warn("in-progress heartbeat failed", "component", "nats_source", "subject", n.Subject, "error", err)
+				continue
+			}
+			metrics.NatsMessages.WithLabelValues(n.Subject, "in_progress").Inc()
+		}
+	}
+}
+
+// recordFailure reports a failed delivery to Failures. Like republish it
+// outlives the source context, since the message is settled right after.
+func (n *NatsSource) recordFailure(ctx context.Context, doc *core.Document[string], final bool, err error) {
+	if n.Failures == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), republishTimeout)
+	defer cancel()
+	if recErr := n.Failures.RecordFailure(ctx, doc, final, err); recErr != nil {
+		slog.Warn("failure record failed", append(doc.LogAttrs(), "component", "nats_source", "error", recErr)...)
+	}
+}
+
+func (n *NatsSource) finalDelivery(delivered uint64) bool {
+	return n.Limits.MaxDeliver > 0 && delivered >= uint64(n.Limits.MaxDeliver)
+}
+
+// exhausted settles a message the server will not redeliver again. A
+// deferral (politeness delay) is not a failure, so it is republished as fresh
+// work; anything else is parked on the dead letter subject.
+func (n *NatsSource) exhausted(ctx context.Context, msg jetstream.Msg, delay time.Duration, attrs []any) {
+	if delay > 0 {
+		if err := n.republish(ctx, msg, msg.Subject()); err != nil {
+			slog.Error("requeue failed", append(attrs, "component", "nats_source", "error", err)...)
+			_ = msg.NakWithDelay(delay)
+			return
+		}
+		_ = msg.Ack()
+		metrics.NatsMessages.WithLabelValues(n.Subject, "requeue").Inc()
+		return
+	}
+
+	if n.DeadLetterSubject != "" {
+		if err := n.republish(ctx, msg, n.DeadLetterSubject); err != nil {
+			slog.Error("dead letter publish failed", append(attrs, "component", "nats_source", "error", err)...)
+		}
+	}
+	slog.Warn("max deliveries exhausted, dead-lettering", append(attrs, "component", "nats_source", "subject", n.Subject)...)
+	if err := msg.Term(); err != nil {
+		slog.Error("term failed", append(attrs, "component", "nats_source", "error", err)...)
+	}
+	metrics.NatsMessages.WithLabelValues(n.Subject, "dead_letter").Inc()
+}
+
+func (n *NatsSource) republish(ctx context.Context, msg jetstream.Msg, subject string) error {
+	out := &nats.Msg{Subject: subject, Data: msg.Data(), Header: nats.Header{}}
+	for k, v := range msg.Headers() {
+		out.Header[k] = v
+	}
+	out.Header.Set(OriginalSubjectHeader, msg.Subject())
+	out.Header.Del(jetstream.MsgIDHeader)
+
+	// The message is settled right after, so finish the publish even if the
+	// source is shutting down.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), republishTimeout)
+	defer cancel()
+	_, err := n.JS.PublishMsg(ctx, out)
+	return err
+}
+
+func (n *NatsSource) gatesReady() bool {
+	for _, g := range n.Gates {
+		if !g.Ready() {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *NatsSource) waitForGates(ctx context.Context) error {
+	for _, g := range n.Gates {
+		if err := g.WaitReady(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
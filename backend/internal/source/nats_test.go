@@ -0,0 +1,272 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/oranjParker/Rarefactor/internal/config"
+	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/database"
+)
+
+func newTestTopology(t *testing.T, opts ...func(*config.NATS)) (*database.NatsConn, config.NATS, database.Topology) {
+	t.Helper()
+	nt, err := database.NewEmbeddedNats(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nt.Close)
+
+	cfg := config.Default().NATS
+	cfg.MaxDeliver = 2
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	topology := database.NewTopology(cfg)
+	if err := topology.Provision(context.Background(), nt.JS); err != nil {
+		t.Fatal(err)
+	}
+	return nt, cfg, topology
+}
+
+func publishDoc(t *testing.T, js jetstream.JetStream, subject string, doc *core.Document[string]) {
+	t.Helper()
+	data, _ := json.Marshal(doc)
+	if _, err := js.Publish(context.Background(), subject, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTopology_Provision(t *testing.T) {
+	ctx := context.Background()
+	nt, err := database.NewEmbeddedNats(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nt.Close()
+
+	// The single catch-all stream from earlier releases must be narrowed in place.
+	_, err = nt.JS.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:      "CRAWL_JOBS",
+		Subjects:  []string{"crawl.>"},
+		Retention: jetstream.WorkQueuePolicy,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Default().NATS
+	topology := database.NewTopology(cfg)
+	for i := 0; i < 2; i++ {
+		if err := topology.Provision(ctx, nt.JS); err != nil {
+			t.Fatalf("provision %d: %v", i, err)
+		}
+	}
+
+	routes := map[string]string{
+		"crawl.jobs.p1.3":      cfg.FrontierStream,
+		"crawl.enrichment":     cfg.EnrichmentStream,
+		"crawl.control.cancel": cfg.ControlStream,
+		"crawl.dlq.CRAWL_JOBS": cfg.DLQStream,
+	}
+	for subject, want := range routes {
+		ack, err := nt.JS.Publish(ctx, subject, []byte("{}"))
+		if err != nil {
+			t.Fatalf("publish %s: %v", subject, err)
+		}
+		if ack.Stream != want {
+			t.Errorf("expected %s to land in %s, got %s", subject, want, ack.Stream)
+		}
+	}
+
+	stream, err := nt.JS.Stream(ctx, cfg.FrontierStream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := stream.CachedInfo(); info.Config.Discard != jetstream.DiscardNew || info.Config.MaxMsgs != cfg.MaxMsgs {
+		t.Errorf("expected work stream limits to be applied, got discard=%v max_msgs=%d", info.Config.Discard, info.Config.MaxMsgs)
+	}
+}
+
+func TestNatsSource_DeadLettersAfterMaxDeliver(t *testing.T) {
+	nt, cfg, topology := newTestTopology(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := NewNatsSource(nt.JS, cfg.EnrichmentStream, cfg.EnrichmentSubject, "test-group")
+	src.Limits = topology.Consumers
+	src.DeadLetterSubject = topology.DeadLetterSubject(cfg.EnrichmentStream)
+	ch, err := src.Stream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publishDoc(t, nt.JS, cfg.EnrichmentSubject, &core.Document[string]{ID: "https://a.io/"})
+	for i := 0; i < cfg.MaxDeliver; i++ {
+		select {
+		case doc := <-ch:
+			doc.CT.Fail()
+			doc.CT.WaitAndFinish()
+		case <-time.After(5 * time.Second):
+			t.Fatalf("delivery %d never arrived", i+1)
+		}
+	}
+
+	dlq, err := nt.JS.Stream(ctx, cfg.DLQStream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := dlq.GetLastMsgForSubject(ctx, src.DeadLetterSubject)
+	if err != nil {
+		t.Fatalf("expected the message on the DLQ: %v", err)
+	}
+	if got := msg.Header.Get(OriginalSubjectHeader); got != cfg.EnrichmentSubject {
+		t.Errorf("expected original subject header, got %q", got)
+	}
+
+	select {
+	case doc := <-ch:
+		t.Errorf("expected no redelivery after dead-lettering, got %s", doc.ID)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestNatsSource_RequeuesDeferredFinalDelivery(t *testing.T) {
+	nt, cfg, topology := newTestTopology(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	subject := cfg.JobsSubject + ".p1.0"
+	src := NewNatsSource(nt.JS, cfg.FrontierStream, subject, "test-group")
+	src.Limits = topology.Consumers
+	src.DeadLetterSubject = topology.DeadLetterSubject(cfg.FrontierStream)
+	ch, err := src.Stream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publishDoc(t, nt.JS, subject, &core.Document[string]{ID: "https://a.io/"})
+	for i := 0; i < cfg.MaxDeliver+1; i++ {
+		select {
+		case doc := <-ch:
+			doc.CT.FailAfter(time.Millisecond)
+			doc.CT.WaitAndFinish()
+		case <-time.After(5 * time.Second):
+			t.Fatalf("delivery %d never arrived; a politeness deferral must not be dropped", i+1)
+		}
+	}
+
+	dlq, _ := nt.JS.Stream(ctx, cfg.DLQStream)
+	if info, _ := dlq.Info(ctx); info.State.Msgs != 0 {
+		t.Errorf("expected deferred work to stay off the DLQ, found %d messages", info.State.Msgs)
+	}
+}
+
+func TestNatsSource_HeartbeatPreventsRedelivery(t *testing.T) {
+	nt, cfg, topology := newTestTopology(t, func(c *config.NATS) { c.AckWait = 300 * time.Millisecond })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := NewNatsSource(nt.JS, cfg.EnrichmentStream, cfg.EnrichmentSubject, "test-group")
+	src.Limits = topology.Consumers
+	ch, err := src.Stream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publishDoc(t, nt.JS, cfg.EnrichmentSubject, &core.Document[string]{ID: "https://slow.io/"})
+	var doc *core.Document[string]
+	select {
+	case doc = <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message never delivered")
+	}
+
+	// Hold the document for several AckWaits, as a slow SPA render would.
+	select {
+	case dup := <-ch:
+		t.Fatalf("expected no redelivery while the first attempt is in progress, got %s", dup.ID)
+	case <-time.After(4 * cfg.AckWait):
+	}
+
+	doc.CT.WaitAndFinish()
+	select {
+	case dup := <-ch:
+		t.Fatalf("expected acked message to stay settled, got %s", dup.ID)
+	case <-time.After(2 * cfg.AckWait):
+	}
+}
+
+type failure struct {
+	id    string
+	final bool
+	err   error
+}
+
+type recorder chan failure
+
+func (r recorder) RecordFailure(ctx context.Context, doc *core.Document[string], final bool, err error) error {
+	r <- failure{doc.ID, final, err}
+	return nil
+}
+
+func TestNatsSource_RecordsFailures(t *testing.T) {
+	nt, cfg, topology := newTestTopology(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	failures := make(recorder, 8)
+	src := NewNatsSource(nt.JS, cfg.EnrichmentStream, cfg.EnrichmentSubject, "test-group")
+	src.Limits = topology.Consumers
+	src.Failures = failures
+	ch, err := src.Stream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := func() *core.Document[string] {
+		t.Helper()
+		select {
+		case doc := <-ch:
+			return doc
+		case <-time.After(5 * time.Second):
+			t.Fatal("message never delivered")
+			return nil
+		}
+	}
+
+	publishDoc(t, nt.JS, cfg.EnrichmentSubject, &core.Document[string]{ID: "https://flaky.io/"})
+	for i := 0; i < cfg.MaxDeliver; i++ {
+		doc := next()
+		doc.CT.SetErr(&core.RetryableError{Err: errors.New("llm unavailable")})
+		doc.CT.Fail()
+		doc.CT.WaitAndFinish()
+	}
+
+	publishDoc(t, nt.JS, cfg.EnrichmentSubject, &core.Document[string]{ID: "https://bad.io/"})
+	doc := next()
+	doc.CT.SetErr(&core.PermanentError{Err: errors.New("unparseable")})
+	doc.CT.WaitAndFinish()
+
+	publishDoc(t, nt.JS, cfg.EnrichmentSubject, &core.Document[string]{ID: "https://ok.io/"})
+	next().CT.WaitAndFinish()
+
+	want := []failure{
+		{id: "https://flaky.io/", final: false},
+		{id: "https://flaky.io/", final: true},
+		{id: "https://bad.io/", final: true},
+	}
+	for _, w := range want {
+		got := <-failures
+		if got.id != w.id || got.final != w.final || got.err == nil {
+			t.Errorf("expected %s final=%v with an error, got %+v", w.id, w.final, got)
+		}
+	}
+	if len(failures) != 0 {
+		t.Errorf("expected a successful delivery not to be recorded, got %+v", <-failures)
+	}
+}
@@ -0,0 +1,156 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/frontier"
+)
+
+// PrioritySource merges one source per priority level. While several levels
+// have work, each round takes up to Weights[i] items from level i in order,
+// so lower levels keep moving but higher levels dominate.
+type PrioritySource[T any] struct {
+	Levels  []core.Source[T]
+	Weights []int
+}
+
+func NewPrioritySource[T any](weights []int, levels ...core.Source[T]) *PrioritySource[T] {
+	return &PrioritySource[T]{Levels: levels, Weights: weights}
+}
+
+// frontierPullMax bounds the messages buffered across all of a frontier's
+// consumers. Buffered messages are not heartbeated until the graph takes them,
+// so they must be few enough to be drained well within AckWait.
+const frontierPullMax = 64
+
+// NewFrontierSource consumes every priority level and host shard under base,
+// each with its own durable consumer named queue-p<level>-<shard>. Levels are
+// read in frontier.DefaultWeights order and shards within a level round-robin.
+// src.PullMaxMessages, or frontierPullMax if unset, is split between the
+// consumers so adding shards does not multiply the prefetch.
+func NewFrontierSource(src *NatsSource, base string, shards int) *PrioritySource[*core.Document[string]] {
+	shards = max(shards, 1)
+	budget := src.PullMaxMessages
+	if budget <= 0 {
+		budget = frontierPullMax
+	}
+	pullMax := max(budget/(frontier.Levels*shards), 1)
+
+	levels := make([]core.Source[*core.Document[string]], frontier.Levels)
+	for level := range levels {
+		shardSources := make([]core.Source[*core.Document[string]], shards)
+		weights := make([]int, shards)
+		for shard := range shardSources {
+			s := *src
+			s.Subject = frontier.Subject(base, level, shard)
+			s.Queue = fmt.Sprintf("%s-p%d-%d", src.Queue, level, shard)
+			s.PullMaxMessages = pullMax
+			shardSources[shard] = &s
+			weights[shard] = 1
+		}
+		levels[level] = NewPrioritySource(weights, shardSources...)
+	}
+	return NewPrioritySource(frontier.DefaultWeights, levels...)
+}
+
+func (p *PrioritySource[T]) Stream(ctx context.Context) (<-chan T, error) {
+	if len(p.Weights) != len(p.Levels) {
+		return nil, fmt.Errorf("priority source has %d levels but %d weights", len(p.Levels), len(p.Weights))
+	}
+
+	inputs := make([]<-chan T, len(p.Levels))
+	for i, src := range p.Levels {
+		ch, err := src.Stream(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("priority level %d: %w", i, err)
+		}
+		inputs[i] = ch
+	}
+
+	var schedule []int
+	for level, w := range p.Weights {
+		for j := 0; j < max(w, 1); j++ {
+			schedule = append(schedule, level)
+		}
+	}
+
+	out := make(chan T)
+	go func() {
+		defer close(out)
+
+		open := len(inputs)
+		for open > 0 {
+			took := false
+			for _, level := range schedule {
+				if inputs[level] == nil {
+					continue
+				}
+				select {
+				case item, ok := <-inputs[level]:
+					if !ok {
+						inputs[level] = nil
+						open--
+						continue
+					}
+					took = true
+					if !send(ctx, out, item) {
+						return
+					}
+				default:
+				}
+			}
+			if took || open == 0 {
+				continue
+			}
+
+			// Every level is empty: block until any of them delivers.
+			level, item, ok := waitAny(ctx, inputs)
+			if level < 0 {
+				return
+			}
+			if !ok {
+				inputs[level] = nil
+				open--
+				continue
+			}
+			if !send(ctx, out, item) {
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+func send[T any](ctx context.Context, out chan<- T, item T) bool {
+	select {
+	case out <- item:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// waitAny blocks on every open input and ctx; level is -1 once ctx is done.
+func waitAny[T any](ctx context.Context, inputs []<-chan T) (level int, item T, ok bool) {
+	cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}}
+	levels := []int{-1}
+	for i, ch := range inputs {
+		if ch != nil {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)})
+			levels = append(levels, i)
+		}
+	}
+
+	chosen, v, ok := reflect.Select(cases)
+	if chosen == 0 {
+		return -1, item, false
+	}
+	if ok {
+		item = v.Interface().(T)
+	}
+	return levels[chosen], item, ok
+}
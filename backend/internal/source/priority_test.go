@@ -0,0 +1,109 @@
+package source
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/oranjParker/Rarefactor/internal/core"
+	"github.com/oranjParker/Rarefactor/internal/frontier"
+)
+
+type sliceSource []string
+
+func (s sliceSource) Stream(ctx context.Context) (<-chan string, error) {
+	out := make(chan string, len(s))
+	for _, item := range s {
+		out <- item
+	}
+	close(out)
+	return out, nil
+}
+
+type idleSource struct{}
+
+func (idleSource) Stream(ctx context.Context) (<-chan string, error) {
+	return make(chan string), nil
+}
+
+func repeat(item string, n int) sliceSource {
+	s := make(sliceSource, n)
+	for i := range s {
+		s[i] = item
+	}
+	return s
+}
+
+func TestPrioritySource_WeightedOrder(t *testing.T) {
+	src := NewPrioritySource([]int{3, 1}, core.Source[string](repeat("high", 6)), core.Source[string](repeat("low", 4)))
+	ch, err := src.Stream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for item := range ch {
+		got = append(got, item)
+	}
+
+	want := []string{"high", "high", "high", "low", "high", "high", "high", "low", "low", "low"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d items, got %v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected weighted order %v, got %v", want, got)
+		}
+	}
+}
+
+func TestPrioritySource_StopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	src := NewPrioritySource([]int{1, 1}, core.Source[string](idleSource{}), core.Source[string](idleSource{}))
+	ch, err := src.Stream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("expected no items from idle levels")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("priority source did not stop after cancellation")
+	}
+}
+
+func TestPrioritySource_WeightMismatch(t *testing.T) {
+	src := NewPrioritySource([]int{1}, core.Source[string](idleSource{}), core.Source[string](idleSource{}))
+	if _, err := src.Stream(context.Background()); err == nil {
+		t.Error("expected an error when weights and levels differ")
+	}
+}
+
+func TestNewFrontierSource_SplitsPrefetch(t *testing.T) {
+	for _, tt := range []struct {
+		shards, budget, want int
+	}{
+		{8, 0, 2},
+		{1, 0, 16},
+		{8, 256, 8},
+		{64, 0, 1},
+	} {
+		src := NewFrontierSource(&NatsSource{Queue: "q", PullMaxMessages: tt.budget}, "crawl.jobs", tt.shards)
+		total := 0
+		for _, level := range src.Levels {
+			for _, shard := range level.(*PrioritySource[*core.Document[string]]).Levels {
+				if got := shard.(*NatsSource).PullMaxMessages; got != tt.want {
+					t.Errorf("shards=%d budget=%d: expected %d per consumer, got %d", tt.shards, tt.budget, tt.want, got)
+				}
+				total++
+			}
+		}
+		if total != frontier.Levels*tt.shards {
+			t.Errorf("expected %d consumers, got %d", frontier.Levels*tt.shards, total)
+		}
+	}
+}
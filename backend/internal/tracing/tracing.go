@@ -0,0 +1,71 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentation = "github.com/oranjParker/Rarefactor"
+
+// Setup installs the global tracer provider and W3C propagator. Spans are
+// exported over OTLP/gRPC when endpoint is set; otherwise only context
+// propagation is enabled. The returned func flushes pending spans.
+func Setup(ctx context.Context, service, endpoint string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if endpoint == "" {
+		slog.Info("no otlp endpoint configured, spans will not be exported", "component", "tracing")
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("otlp exporter setup failed: %w", err)
+	}
+
+	tp := NewProvider(service, sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(tp)
+	slog.Info("exporting spans over otlp", "component", "tracing", "service", service)
+	return tp.Shutdown, nil
+}
+
+// NewProvider builds a tracer provider tagged with the service name. Tests pass
+// sdktrace.WithSyncer(tracetest.NewInMemoryExporter()) to capture spans.
+func NewProvider(service string, opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	res := resource.NewSchemaless(attribute.String("service.name", service))
+	return sdktrace.NewTracerProvider(append([]sdktrace.TracerProviderOption{sdktrace.WithResource(res)}, opts...)...)
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Inject writes the span context carried by ctx into NATS message headers.
+func Inject(ctx context.Context, h nats.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(h))
+}
+
+// Extract returns the trace context found in NATS message headers as a map
+// that can ride along with a document through the graph.
+func Extract(h nats.Header) propagation.MapCarrier {
+	if len(h) == 0 {
+		return nil
+	}
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(h))
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
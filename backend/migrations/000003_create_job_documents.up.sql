@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS job_documents (
+    job_id UUID NOT NULL REFERENCES crawl_jobs(id) ON DELETE CASCADE,
+    document_id TEXT NOT NULL,
+    linked_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (job_id, document_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_documents_document_id ON job_documents(document_id);
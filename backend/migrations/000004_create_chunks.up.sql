@@ -0,0 +1,78 @@
+CREATE TABLE IF NOT EXISTS chunks (
+    document_id TEXT NOT NULL,
+    chunk_index INT NOT NULL,
+
+    content TEXT NOT NULL,
+    start_offset INT NOT NULL DEFAULT 0,
+    end_offset INT NOT NULL DEFAULT 0,
+    token_count INT NOT NULL DEFAULT 0,
+
+    enrichment JSONB NOT NULL DEFAULT '{}',
+    -- PENDING until the enrichment worker embeds the chunk (ENRICHED) or its
+    -- last delivery fails (FAILED).
+    enrichment_status TEXT NOT NULL DEFAULT 'PENDING'
+        CHECK (enrichment_status IN ('PENDING', 'ENRICHED', 'FAILED')),
+    enrichment_attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (document_id, chunk_index)
+);
+
+-- No foreign key to documents: a page and its chunks can land in different
+-- sink flushes that commit concurrently.
+
+-- Chunks used to be stored as documents rows ("url#chunkN", parent_id = url)
+-- and their pages were never stored. Move them over and rebuild each page
+-- from its chunks.
+WITH old AS (
+    SELECT *, COALESCE((metadata->>'chunk_index')::int, 0) AS idx
+    FROM documents
+    WHERE metadata->>'is_chunk' = 'true' AND COALESCE(parent_id, '') <> ''
+)
+INSERT INTO chunks (document_id, chunk_index, content, start_offset, end_offset, token_count, enrichment_status, enrichment, created_at)
+SELECT
+    parent_id,
+    idx,
+    content,
+    COALESCE(SUM(octet_length(content)) OVER w - octet_length(content), 0),
+    SUM(octet_length(content)) OVER w,
+    (char_length(content) + 3) / 4,
+    CASE WHEN metadata ? 'vector' THEN 'ENRICHED' ELSE 'PENDING' END,
+    jsonb_strip_nulls(jsonb_build_object(
+        'summary', metadata->'summary',
+        'keywords', metadata->'keywords',
+        'questions', metadata->'questions'
+    )),
+    crawled_at
+FROM old
+WINDOW w AS (PARTITION BY parent_id ORDER BY idx)
+ON CONFLICT (document_id, chunk_index) DO NOTHING;
+
+WITH pages AS (
+    SELECT
+        parent_id AS id,
+        min(namespace) AS namespace,
+        min(domain) AS domain,
+        min(source) AS source,
+        string_agg(content, '' ORDER BY COALESCE((metadata->>'chunk_index')::int, 0)) AS content,
+        min(title) AS title,
+        (array_agg(
+            metadata - 'is_chunk' - 'chunk_index' - 'chunk_size' - 'vector'
+                     - 'summary' - 'keywords' - 'questions' - 'enriched'
+            ORDER BY COALESCE((metadata->>'chunk_index')::int, 0)
+        ))[1] AS metadata,
+        min(crawled_at) AS crawled_at,
+        max(last_seen_at) AS last_seen_at
+    FROM documents
+    WHERE metadata->>'is_chunk' = 'true' AND COALESCE(parent_id, '') <> ''
+    GROUP BY parent_id
+)
+INSERT INTO documents (id, namespace, domain, source, content, title, content_hash, metadata, crawled_at, last_seen_at)
+SELECT id, namespace, domain, source, content, title, encode(sha256(convert_to(content, 'UTF8')), 'hex'), metadata, crawled_at, last_seen_at
+FROM pages
+ON CONFLICT (id) DO NOTHING;
+
+DELETE FROM documents WHERE metadata->>'is_chunk' = 'true';
@@ -0,0 +1,4 @@
+-- The backfill command re-enqueues chunks that are not ENRICHED, oldest
+-- first.
+CREATE INDEX IF NOT EXISTS idx_chunks_enrichment_backlog
+    ON chunks(enrichment_status, updated_at) WHERE enrichment_status <> 'ENRICHED';
@@ -0,0 +1,23 @@
+-- A reindex re-embeds every enriched chunk into a new versioned Qdrant
+-- collection and then swaps the alias. Progress is tracked per run, like a
+-- crawl job.
+CREATE TABLE IF NOT EXISTS reindex_jobs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+
+    alias TEXT NOT NULL,
+    collection TEXT NOT NULL,
+    model TEXT NOT NULL,
+    dimension INT NOT NULL,
+
+    status job_status NOT NULL DEFAULT 'PENDING',
+    chunks_indexed INT NOT NULL DEFAULT 0,
+    errors_count INT NOT NULL DEFAULT 0,
+    error_message TEXT,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_reindex_jobs_created_at ON reindex_jobs(created_at DESC);
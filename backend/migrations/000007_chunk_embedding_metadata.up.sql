@@ -0,0 +1,10 @@
+-- How each chunk's vector was produced. NULL until the chunk is embedded;
+-- a reindex compares these against the configured model to find stale
+-- vectors.
+ALTER TABLE chunks
+    ADD COLUMN IF NOT EXISTS embedding_model TEXT,
+    ADD COLUMN IF NOT EXISTS embedding_dims INT,
+    ADD COLUMN IF NOT EXISTS embedding_task TEXT,
+    ADD COLUMN IF NOT EXISTS embedded_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_chunks_embedding_model ON chunks(embedding_model);